@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+// BundleList lists the policy bundles loaded by the server
+type BundleList struct {
+	Bundles []Bundle `json:"bundles" yaml:"bundles"`
+}
+
+type Bundle struct {
+	Name       string   `json:"name" yaml:"name"`
+	Revision   string   `json:"revision,omitempty" yaml:"revision,omitempty"`
+	Entrypoint string   `json:"entrypoint" yaml:"entrypoint"`
+	Modules    []string `json:"modules" yaml:"modules"`
+}
+
+// runBundles lists the bundles that scan and evaluate accept with --bundle
+func runBundles(args []string) int {
+	fs := flag.NewFlagSet("bundles", flag.ContinueOnError)
+	var conn connOptions
+	conn.register(fs)
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+	res, err := client.ListBundles(ctx, &pb.ListBundlesRequest{})
+	if err != nil {
+		log.Printf("Listing bundles failed: %v", err)
+		return exitError
+	}
+
+	list := &BundleList{Bundles: []Bundle{}}
+	for _, b := range res.GetBundles() {
+		list.Bundles = append(list.Bundles, Bundle{Name: b.GetName(), Revision: b.GetRevision(), Entrypoint: b.GetEntrypoint(), Modules: b.GetModules()})
+	}
+	if err := writeOutput(os.Stdout, *output, list); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
+}
+
+func (l *BundleList) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "NAME\tREVISION\tENTRYPOINT\tMODULES")
+	for _, b := range l.Bundles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Name, orDash(b.Revision), b.Entrypoint, strings.Join(b.Modules, ", "))
+	}
+}
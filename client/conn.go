@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	pb "github-scanner/src/pb"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const defaultServer = "localhost:50051"
+
+var tracer trace.Tracer
+
+// connOptions are the connection flags shared by the commands talking to the server
+type connOptions struct {
+	server        string
+	useTLS        bool
+	caFile        string
+	certFile      string
+	keyFile       string
+	tlsServerName string
+	token         string
+	timeout       time.Duration
+}
+
+func (o *connOptions) register(fs *flag.FlagSet) {
+	server := os.Getenv("SCANNER_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+	fs.StringVar(&o.server, "server", server, "gRPC server address (defaults to $SCANNER_SERVER)")
+	fs.BoolVar(&o.useTLS, "tls", false, "connect to the server over TLS")
+	fs.StringVar(&o.caFile, "ca-file", "", "PEM CA bundle used to verify the server (defaults to the system pool)")
+	fs.StringVar(&o.certFile, "cert-file", "", "client certificate for mutual TLS")
+	fs.StringVar(&o.keyFile, "key-file", "", "client private key for mutual TLS")
+	fs.StringVar(&o.tlsServerName, "server-name", "", "override the server name checked against the certificate")
+	fs.StringVar(&o.token, "token", os.Getenv("SCANNER_TOKEN"), "bearer token sent to the server (defaults to $SCANNER_TOKEN)")
+	fs.DurationVar(&o.timeout, "timeout", 5*time.Minute, "deadline of each RPC")
+}
+
+// rpcContext returns a context carrying the RPC deadline
+func (o *connOptions) rpcContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), o.timeout)
+}
+
+// bearerToken attaches the token to every RPC
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// connect creates the PolicyService client. The connection is established
+// lazily and waited for within each RPC's deadline.
+func (o *connOptions) connect() (*grpc.ClientConn, pb.PolicyServiceClient, error) {
+	creds, err := o.transportCredentials()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+	}
+	if o.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(bearerToken(o.token)))
+	}
+
+	conn, err := grpc.NewClient(o.server, dialOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", o.server, err)
+	}
+	return conn, pb.NewPolicyServiceClient(conn), nil
+}
+
+// builds the transport credentials from the TLS flags
+func (o *connOptions) transportCredentials() (credentials.TransportCredentials, error) {
+	if !o.useTLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.tlsServerName}
+
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.caFile)
+		}
+	}
+
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// setupTracing starts a trace per RPC so the server's spans join it. Spans
+// are exported when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+func setupTracing() func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	opts := []sdktrace.TracerProviderOption{}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		exporter, err := otlptracegrpc.New(context.Background())
+		if err != nil {
+			log.Printf("Failed to create OTLP exporter, traces will not be exported: %v", err)
+		} else {
+			opts = append(opts, sdktrace.WithBatcher(exporter))
+		}
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer("github-scanner-client")
+	return provider.Shutdown
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+// Diff lists the repositories whose result differs between two scans
+type Diff struct {
+	Old     string      `json:"old" yaml:"old"`
+	New     string      `json:"new" yaml:"new"`
+	Changes []Change    `json:"changes" yaml:"changes"`
+	Summary DiffSummary `json:"summary" yaml:"summary"`
+}
+
+type Change struct {
+	Repository string `json:"repository" yaml:"repository"`
+	// empty when the repository is missing from that scan
+	Old string `json:"old" yaml:"old"`
+	New string `json:"new" yaml:"new"`
+}
+
+type DiffSummary struct {
+	Added   int `json:"added" yaml:"added"`
+	Removed int `json:"removed" yaml:"removed"`
+	Changed int `json:"changed" yaml:"changed"`
+	// repositories failing in the new scan that did not fail in the old one
+	NewViolations int `json:"new_violations" yaml:"new_violations"`
+	// repositories failing in the old scan that pass in the new one
+	Fixed int `json:"fixed" yaml:"fixed"`
+}
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: scanner-cli diff [flags] <old> <new>\n\n<old> and <new> are scan IDs, or files holding a scan as JSON (GET /v1/scans/{id}).")
+		fs.PrintDefaults()
+	}
+	var conn connOptions
+	conn.register(fs)
+	var filters stringList
+	fs.Var(&filters, "filter", "only compare repositories whose name matches this glob (repeatable)")
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var scans [2]*pb.PolicyResponse
+	for i, ref := range fs.Args() {
+		scan, err := loadScan(&conn, ref)
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		if scan.GetError() != "" {
+			log.Printf("Scan %s failed: %s", ref, scan.GetError())
+			return exitError
+		}
+		scans[i] = scan
+	}
+
+	diff := diffScans(scans[0], scans[1], filters)
+	diff.Old, diff.New = fs.Arg(0), fs.Arg(1)
+	if err := writeOutput(os.Stdout, *output, diff); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if diff.Summary.NewViolations > 0 {
+		return exitViolations
+	}
+	return exitOK
+}
+
+// loadScan reads a scan from a file, or fetches it from the server by ID
+func loadScan(conn *connOptions, ref string) (*pb.PolicyResponse, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return readScanFile(ref)
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer clientConn.Close()
+
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+	res, err := client.GetScan(ctx, &pb.GetScanRequest{ScanId: ref})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan %s: %w", ref, err)
+	}
+	return res, nil
+}
+
+// diffScans compares the results of the repositories of both scans
+func diffScans(oldScan, newScan *pb.PolicyResponse, filters []string) *Diff {
+	results := func(scan *pb.PolicyResponse) map[string]string {
+		m := make(map[string]string)
+		for _, repo := range scan.GetRepositories() {
+			if matchesFilters(repo.GetName(), filters) {
+				m[repo.GetFullName()], _ = classifyResult(repo.GetScanResult())
+			}
+		}
+		return m
+	}
+	oldResults, newResults := results(oldScan), results(newScan)
+
+	names := make(map[string]bool)
+	for name := range oldResults {
+		names[name] = true
+	}
+	for name := range newResults {
+		names[name] = true
+	}
+
+	diff := &Diff{Changes: []Change{}}
+	for name := range names {
+		oldResult, inOld := oldResults[name]
+		newResult, inNew := newResults[name]
+		if oldResult == newResult {
+			continue
+		}
+		diff.Changes = append(diff.Changes, Change{Repository: name, Old: oldResult, New: newResult})
+
+		switch {
+		case !inOld:
+			diff.Summary.Added++
+		case !inNew:
+			diff.Summary.Removed++
+		default:
+			diff.Summary.Changed++
+		}
+		if newResult == resultFail {
+			diff.Summary.NewViolations++
+		} else if oldResult == resultFail && newResult == resultPass {
+			diff.Summary.Fixed++
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Repository < diff.Changes[j].Repository
+	})
+	return diff
+}
+
+func (d *Diff) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "REPOSITORY\tOLD\tNEW")
+	for _, c := range d.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Repository, orDash(c.Old), orDash(c.New))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Added: %d, Removed: %d, Changed: %d, New violations: %d, Fixed: %d\n",
+		d.Summary.Added, d.Summary.Removed, d.Summary.Changed, d.Summary.NewViolations, d.Summary.Fixed)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pb "github-scanner/src/pb"
+)
+
+func TestDiffScans(t *testing.T) {
+	scan := func(repos ...*pb.RepositoryInfo) *pb.PolicyResponse {
+		return &pb.PolicyResponse{Repositories: repos}
+	}
+	tests := []struct {
+		name     string
+		old, new *pb.PolicyResponse
+		filters  []string
+		changes  []Change
+		summary  DiffSummary
+	}{
+		{
+			name:    "unchanged",
+			old:     scan(testRepo("api", "Success", ""), testRepo("web", "Failure", "high")),
+			new:     scan(testRepo("web", "Failure", "low"), testRepo("api", "Success", "")),
+			changes: []Change{},
+		},
+		{
+			name: "new violation and fix",
+			old:  scan(testRepo("api", "Success", ""), testRepo("web", "Failure", "high")),
+			new:  scan(testRepo("api", "Failure", "high"), testRepo("web", "Success", "")),
+			changes: []Change{
+				{Repository: "acme/api", Old: resultPass, New: resultFail},
+				{Repository: "acme/web", Old: resultFail, New: resultPass},
+			},
+			summary: DiffSummary{Changed: 2, NewViolations: 1, Fixed: 1},
+		},
+		{
+			name: "added and removed",
+			old:  scan(testRepo("legacy", "Failure", "high"), testRepo("api", "Success", "")),
+			new:  scan(testRepo("api", "Success", ""), testRepo("web", "Failure", "low"), testRepo("docs", "Success", "")),
+			changes: []Change{
+				{Repository: "acme/docs", New: resultPass},
+				{Repository: "acme/legacy", Old: resultFail},
+				{Repository: "acme/web", New: resultFail},
+			},
+			summary: DiffSummary{Added: 2, Removed: 1, NewViolations: 1},
+		},
+		{
+			name: "errors and waivers",
+			old:  scan(testRepo("api", "Failure", "high"), testRepo("web", "Waived", "high"), testRepo("docs", "Failure", "low")),
+			new:  scan(testRepo("api", "fetch error: 404 Not Found", ""), testRepo("web", "Failure", "high"), testRepo("docs", "Waived", "low")),
+			changes: []Change{
+				{Repository: "acme/api", Old: resultFail, New: resultError},
+				{Repository: "acme/docs", Old: resultFail, New: resultWaived},
+				{Repository: "acme/web", Old: resultWaived, New: resultFail},
+			},
+			summary: DiffSummary{Changed: 3, NewViolations: 1},
+		},
+		{
+			name:    "filtered out",
+			old:     scan(testRepo("api", "Success", ""), testRepo("web", "Success", "")),
+			new:     scan(testRepo("api", "Failure", "high"), testRepo("web", "Failure", "high"), testRepo("docs", "Failure", "high")),
+			filters: []string{"w*"},
+			changes: []Change{
+				{Repository: "acme/web", Old: resultPass, New: resultFail},
+			},
+			summary: DiffSummary{Changed: 1, NewViolations: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffScans(tt.old, tt.new, tt.filters)
+			if !reflect.DeepEqual(diff.Changes, tt.changes) {
+				t.Errorf("changes %+v, want %+v", diff.Changes, tt.changes)
+			}
+			if diff.Summary != tt.summary {
+				t.Errorf("summary %+v, want %+v", diff.Summary, tt.summary)
+			}
+		})
+	}
+}
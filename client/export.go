@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+)
+
+// runExport renders stored scans on the server, writing the report as it is
+// streamed (StreamExport)
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: scanner-cli export [flags] <scan id>...")
+		fs.PrintDefaults()
+	}
+	var conn connOptions
+	conn.register(fs)
+	format := fs.String("format", "sarif", "report format: "+strings.Join(export.Names(), ", "))
+	out := fs.String("out", "", "write the report to this file instead of stdout")
+	var previous stringList
+	fs.Var(&previous, "previous", "earlier scan ID that html reports compare against (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+	stream, err := client.StreamExport(ctx, &pb.ExportRequest{Format: *format, ScanIds: fs.Args(), PreviousScanIds: previous})
+	if err != nil {
+		log.Printf("Export failed: %v", err)
+		return exitError
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			log.Print(err)
+			return exitError
+		}
+	}
+	if err := receiveExport(stream, w); err != nil {
+		log.Printf("Export failed: %v", err)
+		if *out != "" {
+			w.Close()
+			os.Remove(*out)
+		}
+		return exitError
+	}
+	if *out != "" {
+		if err := w.Close(); err != nil {
+			log.Print(err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// receiveExport copies the chunks of an export stream to w
+func receiveExport(stream grpc.ServerStreamingClient[httpbody.HttpBody], w io.Writer) error {
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.GetData()); err != nil {
+			return err
+		}
+	}
+}
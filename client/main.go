@@ -0,0 +1,91 @@
+// scanner-cli runs policy scans against the GitHub scanner server and gates
+// CI pipelines on the results.
+//
+//	scanner-cli scan     --policy-dir policies/ --org my-org --output table
+//	scanner-cli evaluate --policy-file p.rego --scan-id <id>
+//	scanner-cli test     --policy-dir policies/
+//	scanner-cli diff     <old scan> <new scan>
+//	scanner-cli export   --format sarif <scan id>...
+//	scanner-cli bundles
+//	scanner-cli shadow   <scan id>
+//	scanner-cli waivers  list
+//	scanner-cli remediate --confirm <scan id>
+//	scanner-cli policies create --file p.rego my-policy
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Exit codes, so CI jobs can tell violations apart from broken scans
+const (
+	exitOK         = 0 // every repository is compliant
+	exitViolations = 1 // at least one repository violates a policy
+	exitError      = 2 // a scan, evaluation or policy failed
+	exitUsage      = 3 // invalid command line
+)
+
+const usage = `Usage: scanner-cli <command> [flags]
+
+Commands:
+  scan      scan an organization with one or more policies
+  evaluate  evaluate policies against the repositories of a stored scan or a file
+  test      run the Rego unit tests of policies locally
+  diff      compare the results of two scans
+  export    render stored scans in a report format (sarif, junit, html, csv, xlsx)
+  bundles   list the policy bundles loaded by the server
+  shadow    list the repositories whose decision a policy's shadow version would change
+  policies  manage the server's policy registry (list, get, create, update, shadow,
+            promote, delete)
+  waivers   manage the waivers exempting repositories from policies (list, create,
+            delete)
+  remediate plan the remediation actions of a stored scan, and apply them with --confirm
+
+Run "scanner-cli <command> -h" for the flags of a command.
+
+Exit codes: 0 compliant, 1 violations, 2 errors, 3 usage.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("scanner-cli: ")
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "scan":
+		return runScan(args[1:])
+	case "evaluate":
+		return runEvaluate(args[1:])
+	case "test":
+		return runTest(args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "bundles":
+		return runBundles(args[1:])
+	case "shadow":
+		return runShadow(args[1:])
+	case "waivers":
+		return runWaivers(args[1:])
+	case "policies":
+		return runPoliciesCommand(args[1:])
+	case "remediate":
+		return runRemediate(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
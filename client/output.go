@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github-scanner/src/export"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// tableWriter is implemented by results that can print themselves as a table
+type tableWriter interface {
+	writeTable(w *tabwriter.Writer)
+}
+
+// validateOutput accepts table, json and yaml, and with exports also the
+// report formats of the export package (sarif, junit, ...)
+func validateOutput(format string, exports bool) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	if exports {
+		if _, err := export.Lookup(format); err == nil {
+			return nil
+		}
+		return fmt.Errorf("--output must be %s, %s, %s or one of %s, got %q", outputTable, outputJSON, outputYAML, strings.Join(export.Names(), ", "), format)
+	}
+	return fmt.Errorf("--output must be %s, %s or %s, got %q", outputTable, outputJSON, outputYAML, format)
+}
+
+// reportOutputHelp describes --output of the commands producing reports
+func reportOutputHelp() string {
+	return "output format: table, json, yaml, " + strings.Join(export.Names(), ", ")
+}
+
+// writeOutput prints v in the requested format
+func writeOutput(w io.Writer, format string, v tableWriter) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		v.writeTable(tw)
+		return tw.Flush()
+	}
+}
+
+// writeTable lists every evaluated repository, then the totals of each policy
+func (r *Report) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "POLICY\tREPOSITORY\tVISIBILITY\tRESULT\tSEVERITY\tMESSAGE")
+	for _, p := range r.Policies {
+		if p.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t%s\t-\t%s\n", p.Policy, resultError, p.Error)
+		}
+		for _, repo := range p.Repositories {
+			if repo.Result == resultSkipped {
+				continue
+			}
+			message := repo.Message
+			if message == "" {
+				message = strings.Join(repo.Violations, "; ")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Policy, repo.FullName, repo.Visibility, repo.Result, orDash(repo.Severity), message)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "POLICY\tVERSION\tSCAN ID\tPASSED\tFAILED\tWAIVED\tERRORS\tSKIPPED\tRISK\tSCORE")
+	for _, p := range r.Policies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", p.Policy, orDash(p.Version), p.ScanID, p.Summary.Passed, p.Summary.Failed, p.Summary.Waived, p.Summary.Errors, p.Summary.Skipped, p.Summary.RiskScore, p.Summary.score())
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Summary.Passed, r.Summary.Failed, r.Summary.Waived, r.Summary.Errors, r.Summary.Skipped, r.Summary.RiskScore, r.Summary.score())
+
+	var orgs []PolicyReport
+	for _, p := range r.Policies {
+		if p.Organization != nil {
+			orgs = append(orgs, p)
+		}
+	}
+	if len(orgs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ORGANIZATION\tPOLICY\tRESULT\tSEVERITY\tVIOLATIONS")
+		for _, p := range orgs {
+			o := p.Organization
+			message := strings.Join(o.Violations, "; ")
+			if o.Message != "" {
+				message = o.Message
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", orDash(o.Org), p.Policy, o.Result, orDash(o.Severity), message)
+		}
+	}
+
+	if len(r.Risks) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "REPOSITORY\tRISK\tFAILURES")
+		for _, risk := range r.Risks {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", risk.FullName, risk.RiskScore, risk.failures())
+		}
+	}
+
+	var expired []Waiver
+	for _, p := range r.Policies {
+		expired = append(expired, p.ExpiredWaivers...)
+	}
+	if len(expired) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "EXPIRED WAIVER\tPOLICY\tREPOSITORY\tUSER\tEXPIRED\tAPPROVER")
+		for _, wv := range expired {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", wv.ID, wv.Policy, wv.Repository, orDash(wv.User), wv.ExpiresAt, wv.Approver)
+		}
+	}
+
+	var issues []TrackedIssue
+	for _, p := range r.Policies {
+		for _, i := range p.Issues {
+			if i.Action != "unchanged" {
+				issues = append(issues, i)
+			}
+		}
+	}
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ISSUE\tREPOSITORY\tACTION\tURL")
+		for _, i := range issues {
+			action := i.Action
+			if i.Error != "" {
+				action = "error: " + i.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", orDash(i.Issue), i.FullName, action, orDash(i.URL))
+		}
+	}
+
+	var shadows []*ShadowReport
+	for _, p := range r.Policies {
+		if p.Shadow != nil {
+			shadows = append(shadows, p.Shadow)
+		}
+	}
+	if len(shadows) > 0 {
+		fmt.Fprintln(w)
+		writeShadowTable(w, shadows)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// policyFile is a Rego policy read from disk, named after its file, or a
+// bundle or registered policy of the server
+type policyFile struct {
+	Name   string
+	Path   string
+	Source string
+	Bundle string
+	Ref    string
+	// Rego unit tests of the policy (<name>_test.rego next to it)
+	Tests []string
+}
+
+// policyFlags are the flags selecting the policies of a command
+type policyFlags struct {
+	files      stringList
+	dirs       stringList
+	bundles    stringList
+	refs       stringList
+	withServer bool
+}
+
+func (p *policyFlags) register(fs *flag.FlagSet) {
+	fs.Var(&p.files, "policy-file", "Rego policy file (repeatable)")
+	fs.Var(&p.dirs, "policy-dir", "directory of *.rego policies; *_test.rego files hold their tests (repeatable)")
+}
+
+// registerServerPolicies adds --bundle and --policy-ref, for the commands
+// evaluating on the server
+func (p *policyFlags) registerServerPolicies(fs *flag.FlagSet) {
+	fs.Var(&p.bundles, "bundle", "name of a policy bundle loaded by the server (repeatable)")
+	fs.Var(&p.refs, "policy-ref", "registered policy as policy_id@version, or policy_id for the active version (repeatable)")
+	p.withServer = true
+}
+
+// load reads the selected policies; at least one is required
+func (p *policyFlags) load() ([]policyFile, error) {
+	paths := append([]string(nil), p.files...)
+	for _, dir := range p.dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.rego"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no .rego files in %s", dir)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 && len(p.bundles) == 0 && len(p.refs) == 0 {
+		if p.withServer {
+			return nil, fmt.Errorf("at least one --policy-file, --policy-dir, --bundle or --policy-ref is required")
+		}
+		return nil, fmt.Errorf("at least one --policy-file or --policy-dir is required")
+	}
+
+	var policies []policyFile
+	tests := make(map[string][]string)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.rego") {
+			policyPath := strings.TrimSuffix(path, "_test.rego") + ".rego"
+			tests[policyPath] = append(tests[policyPath], path)
+			continue
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policyFile{
+			Name:   strings.TrimSuffix(filepath.Base(path), ".rego"),
+			Path:   path,
+			Source: string(source),
+		})
+	}
+	for i := range policies {
+		policies[i].Tests = tests[policies[i].Path]
+		delete(tests, policies[i].Path)
+	}
+	for policyPath := range tests {
+		return nil, fmt.Errorf("tests found for %s, but the policy is not selected", policyPath)
+	}
+	for _, name := range p.bundles {
+		policies = append(policies, policyFile{Name: name, Path: "bundle " + name, Bundle: name})
+	}
+	for _, ref := range p.refs {
+		id, _, _ := strings.Cut(ref, "@")
+		policies = append(policies, policyFile{Name: id, Path: "registry " + ref, Ref: ref})
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no policies selected, only tests")
+	}
+	return policies, nil
+}
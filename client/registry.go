@@ -0,0 +1,263 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+const policiesUsage = `Usage: scanner-cli policies <command> [flags]
+
+Commands:
+  list                          list the registered policies
+  get <policy_id>[@<version>]   show a version of a policy, the active one by
+                                default; --source prints only its Rego source
+  create <policy_id> --file f   register a policy as version 1
+  update <policy_id> --file f   add a version to a registered policy and activate
+                                it; --shadow evaluates it in shadow instead
+  shadow <policy_id> <version>  evaluate a version in shadow alongside the active
+                                one; version 0 stops
+  promote <policy_id>           activate the shadow version
+  delete <policy_id>            remove a policy with all its versions
+
+Flags go before the arguments.
+`
+
+// PolicyList lists registered policies or the versions of one
+type PolicyList struct {
+	Policies []RegisteredPolicy `json:"policies" yaml:"policies"`
+}
+
+type RegisteredPolicy struct {
+	ID            string          `json:"policy_id" yaml:"policy_id"`
+	Description   string          `json:"description,omitempty" yaml:"description,omitempty"`
+	LatestVersion int32           `json:"latest_version" yaml:"latest_version"`
+	ActiveVersion int32           `json:"active_version" yaml:"active_version"`
+	ShadowVersion int32           `json:"shadow_version,omitempty" yaml:"shadow_version,omitempty"`
+	UpdatedAt     string          `json:"updated_at" yaml:"updated_at"`
+	Version       PolicyVersion   `json:"version" yaml:"version"`
+	Versions      []PolicyVersion `json:"versions,omitempty" yaml:"versions,omitempty"`
+}
+
+type PolicyVersion struct {
+	Version   int32  `json:"version" yaml:"version"`
+	SHA256    string `json:"sha256" yaml:"sha256"`
+	Author    string `json:"author,omitempty" yaml:"author,omitempty"`
+	Comment   string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	CreatedAt string `json:"created_at" yaml:"created_at"`
+	Source    string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// runPoliciesCommand manages the server's policy registry
+func runPoliciesCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, policiesUsage)
+		return exitUsage
+	}
+	command, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("policies "+command, flag.ContinueOnError)
+	var conn connOptions
+	conn.register(fs)
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	var file, description, comment, author *string
+	printSource, shadow := new(bool), new(bool)
+	wantArgs := 1
+	switch command {
+	case "create", "update":
+		file = fs.String("file", "", "Rego source of the version")
+		description = fs.String("description", "", "what the policy enforces")
+		comment = fs.String("comment", "", "why this version was made")
+		author = fs.String("author", os.Getenv("USER"), "author of the version when the server doesn't authenticate callers")
+		if command == "update" {
+			shadow = fs.Bool("shadow", false, "evaluate the new version in shadow instead of activating it")
+		}
+	case "get":
+		printSource = fs.Bool("source", false, "print only the Rego source of the version")
+	case "list":
+		wantArgs = 0
+	case "shadow":
+		wantArgs = 2
+	case "promote", "delete":
+	case "help", "-h", "-help", "--help":
+		fmt.Print(policiesUsage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown policies command %q\n\n%s", command, policiesUsage)
+		return exitUsage
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if fs.NArg() != wantArgs {
+		fmt.Fprint(os.Stderr, policiesUsage)
+		return exitUsage
+	}
+	var source string
+	if file != nil {
+		if *file == "" {
+			log.Print("--file is required")
+			return exitUsage
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			log.Print(err)
+			return exitUsage
+		}
+		source = string(data)
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+
+	var policies []*pb.RegisteredPolicy
+	switch command {
+	case "list":
+		var res *pb.ListPoliciesResponse
+		res, err = client.ListPolicies(ctx, &pb.ListPoliciesRequest{})
+		policies = res.GetPolicies()
+	case "get":
+		id, version, found := strings.Cut(fs.Arg(0), "@")
+		var n int
+		if found {
+			if n, err = strconv.Atoi(version); err != nil || n < 1 {
+				log.Printf("invalid version %q", version)
+				return exitUsage
+			}
+		}
+		var res *pb.RegisteredPolicy
+		res, err = client.GetPolicy(ctx, &pb.GetPolicyRequest{PolicyId: id, Version: int32(n)})
+		policies = append(policies, res)
+	case "create":
+		var res *pb.RegisteredPolicy
+		res, err = client.CreatePolicy(ctx, &pb.CreatePolicyRequest{
+			PolicyId: fs.Arg(0), Description: *description, Source: source, Comment: *comment, Author: *author,
+		})
+		policies = append(policies, res)
+	case "update":
+		var res *pb.RegisteredPolicy
+		res, err = client.UpdatePolicy(ctx, &pb.UpdatePolicyRequest{
+			PolicyId: fs.Arg(0), Description: *description, Source: source, Comment: *comment, Author: *author, Shadow: *shadow,
+		})
+		policies = append(policies, res)
+	case "shadow":
+		version, convErr := strconv.Atoi(fs.Arg(1))
+		if convErr != nil || version < 0 {
+			log.Printf("invalid version %q", fs.Arg(1))
+			return exitUsage
+		}
+		var res *pb.RegisteredPolicy
+		res, err = client.SetShadowVersion(ctx, &pb.SetShadowVersionRequest{PolicyId: fs.Arg(0), Version: int32(version)})
+		policies = append(policies, res)
+	case "promote":
+		var res *pb.RegisteredPolicy
+		res, err = client.PromotePolicy(ctx, &pb.PromotePolicyRequest{PolicyId: fs.Arg(0)})
+		policies = append(policies, res)
+	case "delete":
+		_, err = client.DeletePolicy(ctx, &pb.DeletePolicyRequest{PolicyId: fs.Arg(0)})
+		if err == nil {
+			log.Printf("Deleted policy %s", fs.Arg(0))
+			return exitOK
+		}
+	}
+	if err != nil {
+		log.Printf("policies %s failed: %v", command, err)
+		return exitError
+	}
+
+	if *printSource {
+		fmt.Print(policies[0].GetVersion().GetSource())
+		return exitOK
+	}
+	list := &PolicyList{Policies: []RegisteredPolicy{}}
+	for _, p := range policies {
+		list.Policies = append(list.Policies, registeredPolicyFromProto(p))
+	}
+	if err := writeOutput(os.Stdout, *output, list); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
+}
+
+func registeredPolicyFromProto(p *pb.RegisteredPolicy) RegisteredPolicy {
+	policy := RegisteredPolicy{
+		ID:            p.GetPolicyId(),
+		Description:   p.GetDescription(),
+		LatestVersion: p.GetLatestVersion(),
+		ActiveVersion: p.GetActiveVersion(),
+		ShadowVersion: p.GetShadowVersion(),
+		UpdatedAt:     p.GetUpdatedAt(),
+		Version:       policyVersionFromProto(p.GetVersion()),
+	}
+	for _, v := range p.GetVersions() {
+		policy.Versions = append(policy.Versions, policyVersionFromProto(v))
+	}
+	return policy
+}
+
+func policyVersionFromProto(v *pb.PolicyVersion) PolicyVersion {
+	return PolicyVersion{
+		Version:   v.GetVersion(),
+		SHA256:    v.GetSha256(),
+		Author:    v.GetAuthor(),
+		Comment:   v.GetComment(),
+		CreatedAt: v.GetCreatedAt(),
+		Source:    v.GetSource(),
+	}
+}
+
+// writeTable lists the policies, then the history of a single one
+func (l *PolicyList) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "POLICY\tVERSION\tACTIVE\tSHADOW\tLATEST\tSHA256\tAUTHOR\tUPDATED\tDESCRIPTION")
+	for _, p := range l.Policies {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%s\t%s\t%s\t%s\n", p.ID, p.Version.Version, p.ActiveVersion, versionOrDash(p.ShadowVersion), p.LatestVersion, shortHash(p.Version.SHA256), orDash(p.Version.Author), p.UpdatedAt, p.Description)
+	}
+	if len(l.Policies) != 1 || len(l.Policies[0].Versions) == 0 {
+		return
+	}
+
+	p := l.Policies[0]
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "VERSION\tSTATE\tSHA256\tAUTHOR\tCREATED\tCOMMENT")
+	for _, v := range p.Versions {
+		state := "-"
+		switch v.Version {
+		case p.ActiveVersion:
+			state = "active"
+		case p.ShadowVersion:
+			state = "shadow"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", v.Version, state, shortHash(v.SHA256), orDash(v.Author), v.CreatedAt, v.Comment)
+	}
+}
+
+func versionOrDash(version int32) string {
+	if version == 0 {
+		return "-"
+	}
+	return strconv.Itoa(int(version))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
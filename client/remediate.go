@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+// RemediationPlan is printed by the remediate command
+type RemediationPlan struct {
+	ScanID  string              `json:"scan_id" yaml:"scan_id"`
+	DryRun  bool                `json:"dry_run" yaml:"dry_run"`
+	Changes []RemediationChange `json:"changes" yaml:"changes"`
+}
+
+type RemediationChange struct {
+	FullName    string `json:"full_name" yaml:"full_name"`
+	Action      string `json:"action" yaml:"action"`
+	Method      string `json:"method" yaml:"method"`
+	Path        string `json:"path" yaml:"path"`
+	Description string `json:"description" yaml:"description"`
+	// planned, applied or failed
+	Status string `json:"status" yaml:"status"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// runRemediate plans the remediations of a stored scan, and applies them
+// with --confirm
+func runRemediate(args []string) int {
+	fs := flag.NewFlagSet("remediate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: scanner-cli remediate [flags] <scan id>")
+		fs.PrintDefaults()
+	}
+	var conn connOptions
+	conn.register(fs)
+	var repos stringList
+	fs.Var(&repos, "repo", "only remediate this repository, by full name (repeatable)")
+	confirm := fs.Bool("confirm", false, "apply the changes; without it they are only planned")
+	endpoint := fs.String("endpoint", "", "named GitHub endpoint (defaults to the one serving each repository's owner)")
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+	res, err := client.Remediate(ctx, &pb.RemediateRequest{
+		ScanId:       fs.Arg(0),
+		Repositories: repos,
+		Confirm:      *confirm,
+		Endpoint:     *endpoint,
+	})
+	if err != nil {
+		log.Printf("Remediation of scan %s failed: %v", fs.Arg(0), err)
+		return exitError
+	}
+
+	plan := &RemediationPlan{ScanID: res.GetScanId(), DryRun: res.GetDryRun(), Changes: []RemediationChange{}}
+	code := exitOK
+	for _, c := range res.GetChanges() {
+		change := RemediationChange{
+			FullName:    c.GetRepository(),
+			Action:      c.GetAction().GetAction(),
+			Method:      c.GetMethod(),
+			Path:        c.GetPath(),
+			Description: c.GetDescription(),
+			Status:      "planned",
+			Error:       c.GetError(),
+		}
+		switch {
+		case c.GetApplied():
+			change.Status = "applied"
+		case c.GetError() != "":
+			change.Status = "failed"
+			code = exitError
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	if err := writeOutput(os.Stdout, *output, plan); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if plan.DryRun && len(plan.Changes) > 0 {
+		log.Print("Dry run: nothing was changed, run again with --confirm to apply these changes")
+	}
+	return code
+}
+
+func (p *RemediationPlan) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "REPOSITORY\tACTION\tREQUEST\tCHANGE\tSTATUS")
+	for _, c := range p.Changes {
+		status := c.Status
+		if c.Error != "" {
+			status += ": " + c.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%s\t%s\n", c.FullName, c.Action, c.Method, c.Path, c.Description, status)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// Repository results
+const (
+	resultPass    = "pass"
+	resultFail    = "fail"
+	resultError   = "error"
+	resultSkipped = "skipped"
+	resultWaived  = "waived"
+)
+
+// Report is the outcome of running one or more policies, as printed by the
+// scan and evaluate commands
+type Report struct {
+	Policies []PolicyReport `json:"policies" yaml:"policies"`
+	Summary  Summary        `json:"summary" yaml:"summary"`
+	// failing repositories by risk score across policies, the riskiest first
+	Risks []RepositoryRisk `json:"risks" yaml:"risks"`
+}
+
+// RepositoryRisk sums the risk scores of a repository's failures
+type RepositoryRisk struct {
+	FullName  string `json:"full_name" yaml:"full_name"`
+	RiskScore int    `json:"risk_score" yaml:"risk_score"`
+	// failed policies by severity
+	Failures map[string]int `json:"failures" yaml:"failures"`
+}
+
+type PolicyReport struct {
+	Policy string `json:"policy" yaml:"policy"`
+	File   string `json:"file" yaml:"file"`
+	ScanID string `json:"scan_id,omitempty" yaml:"scan_id,omitempty"`
+	// exact policy evaluated, as stamped by the server
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	SHA256  string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	// set when the scan as a whole failed
+	Error        string             `json:"error,omitempty" yaml:"error,omitempty"`
+	Repositories []RepositoryResult `json:"repositories" yaml:"repositories"`
+	Summary      Summary            `json:"summary" yaml:"summary"`
+	// decisions of the policy's shadow version that differ; they never
+	// count as failures
+	Shadow *ShadowReport `json:"shadow,omitempty" yaml:"shadow,omitempty"`
+	// waivers of these repositories that lapsed
+	ExpiredWaivers []Waiver `json:"expired_waivers,omitempty" yaml:"expired_waivers,omitempty"`
+	// GitHub issues the server opened, updated or closed for the violations
+	Issues []TrackedIssue `json:"issues,omitempty" yaml:"issues,omitempty"`
+	// decision of the policy's organization-level rules
+	Organization *OrganizationResult `json:"organization,omitempty" yaml:"organization,omitempty"`
+}
+
+type OrganizationResult struct {
+	Org      string `json:"org" yaml:"org"`
+	Result   string `json:"result" yaml:"result"`
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+	// messages of the policy's violations rule
+	Violations []string `json:"violations,omitempty" yaml:"violations,omitempty"`
+	// evaluation error, when Result is error
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+type TrackedIssue struct {
+	FullName string `json:"full_name" yaml:"full_name"`
+	// owner/name#number
+	Issue  string `json:"issue" yaml:"issue"`
+	URL    string `json:"url" yaml:"url"`
+	Action string `json:"action" yaml:"action"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type RepositoryResult struct {
+	Name       string `json:"name" yaml:"name"`
+	FullName   string `json:"full_name" yaml:"full_name"`
+	URL        string `json:"url" yaml:"url"`
+	Visibility string `json:"visibility" yaml:"visibility"`
+	Result     string `json:"result" yaml:"result"`
+	// of failed and waived repositories
+	Severity  string `json:"severity,omitempty" yaml:"severity,omitempty"`
+	RiskScore int    `json:"risk_score" yaml:"risk_score"`
+	// evaluation error, when Result is error, or the waivers, when waived
+	Message string   `json:"message,omitempty" yaml:"message,omitempty"`
+	Waivers []string `json:"waivers,omitempty" yaml:"waivers,omitempty"`
+	// messages of the policy's violations rule, of failed and waived repositories
+	Violations []string `json:"violations,omitempty" yaml:"violations,omitempty"`
+}
+
+type Summary struct {
+	Repositories int `json:"repositories" yaml:"repositories"`
+	Passed       int `json:"passed" yaml:"passed"`
+	Failed       int `json:"failed" yaml:"failed"`
+	Errors       int `json:"errors" yaml:"errors"`
+	Skipped      int `json:"skipped" yaml:"skipped"`
+	Waived       int `json:"waived" yaml:"waived"`
+	// severity-weighted: 100 when every evaluated repository complies
+	ComplianceScore float64 `json:"compliance_score" yaml:"compliance_score"`
+	RiskScore       int     `json:"risk_score" yaml:"risk_score"`
+	// repositories that passed, failed or were waived
+	Evaluated int `json:"evaluated" yaml:"evaluated"`
+}
+
+// score prints the compliance score, a dash when nothing was evaluated
+func (s Summary) score() string {
+	if s.Evaluated == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(s.ComplianceScore, 'f', 1, 64)
+}
+
+func (s *Summary) add(other Summary) {
+	s.Repositories += other.Repositories
+	s.Passed += other.Passed
+	s.Failed += other.Failed
+	s.Errors += other.Errors
+	s.Skipped += other.Skipped
+	s.Waived += other.Waived
+	s.RiskScore += other.RiskScore
+	s.Evaluated += other.Evaluated
+	s.ComplianceScore = export.ComplianceScore(int32(s.RiskScore), int32(s.Evaluated))
+}
+
+func (s *Summary) count(result RepositoryResult) {
+	s.Repositories++
+	switch result.Result {
+	case resultPass:
+		s.Passed++
+		s.Evaluated++
+	case resultFail:
+		s.Failed++
+		s.Evaluated++
+		s.RiskScore += result.RiskScore
+	case resultError:
+		s.Errors++
+	case resultSkipped:
+		s.Skipped++
+	case resultWaived:
+		s.Waived++
+		s.Evaluated++
+	}
+	s.ComplianceScore = export.ComplianceScore(int32(s.RiskScore), int32(s.Evaluated))
+}
+
+// newPolicyReport converts a server response; repositories whose name
+// matches none of the filters are reported as skipped
+func newPolicyReport(policy policyFile, res *pb.PolicyResponse, filters []string) PolicyReport {
+	report := PolicyReport{
+		Policy:  policy.Name,
+		File:    policy.Path,
+		ScanID:  res.GetScanId(),
+		Version: res.GetPolicyVersion(),
+		SHA256:  res.GetPolicySha256(),
+		Error:   res.GetError(),
+		Shadow:  newShadowReport(res, filters),
+	}
+	if report.Error != "" {
+		report.Summary.Errors++
+	}
+
+	for _, repo := range res.GetRepositories() {
+		result := RepositoryResult{
+			Name:       repo.GetName(),
+			FullName:   repo.GetFullName(),
+			URL:        repo.GetRepoUrl(),
+			Visibility: repo.GetVisibility(),
+		}
+		if matchesFilters(repo.GetName(), filters) {
+			result.Result, result.Message = classifyResult(repo.GetScanResult())
+			if result.Result == resultWaived {
+				result.Message = export.WaiverSummary(export.Waivers(res, repo))
+				result.Waivers = repo.GetWaiverIds()
+			}
+			if result.Result == resultFail || result.Result == resultWaived {
+				result.Severity = repo.GetSeverity()
+				result.Violations = repo.GetViolations()
+			}
+			result.RiskScore = int(export.RiskScore(repo))
+		} else {
+			result.Result = resultSkipped
+		}
+		report.Summary.count(result)
+		report.Repositories = append(report.Repositories, result)
+	}
+	for _, i := range res.GetIssues() {
+		if !matchesFilters(path.Base(i.GetRepository()), filters) {
+			continue
+		}
+		issue := TrackedIssue{FullName: i.GetRepository(), URL: i.GetUrl(), Action: i.GetAction(), Error: i.GetError()}
+		if i.GetNumber() > 0 {
+			issue.Issue = fmt.Sprintf("%s#%d", i.GetIssueRepository(), i.GetNumber())
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	if o := res.GetOrganization(); o != nil {
+		org := &OrganizationResult{Org: o.GetSettings().GetLogin(), Violations: o.GetViolations()}
+		org.Result, org.Message = classifyResult(o.GetScanResult())
+		switch org.Result {
+		case resultFail:
+			org.Severity = o.GetSeverity()
+		case resultError:
+			report.Summary.Errors++
+		}
+		report.Organization = org
+	}
+	for _, w := range res.GetExpiredWaivers() {
+		if matchesFilters(path.Base(w.GetRepository()), filters) {
+			report.ExpiredWaivers = append(report.ExpiredWaivers, waiverFromProto(w))
+		}
+	}
+	return report
+}
+
+// classifyResult maps the server's scan_result to a result and message
+func classifyResult(scanResult string) (string, string) {
+	switch strings.ToLower(scanResult) {
+	case "success":
+		return resultPass, ""
+	case "failure":
+		return resultFail, ""
+	case "waived":
+		return resultWaived, ""
+	default:
+		return resultError, scanResult
+	}
+}
+
+func matchesFilters(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if ok, _ := path.Match(filter, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reportFlags order and gate the results of scan and evaluate
+type reportFlags struct {
+	sort     string
+	failOn   string
+	minScore float64
+}
+
+func (f *reportFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.sort, "sort", "", "order the repositories of each policy by name or risk (default: as scanned)")
+	fs.StringVar(&f.failOn, "fail-on", export.SeverityLow, "lowest severity of the violations that fail the command: "+strings.Join(export.Severities, ", "))
+	fs.Float64Var(&f.minScore, "min-score", 0, "fail the command when the compliance score is below this (0-100)")
+}
+
+func (f *reportFlags) validate() error {
+	if f.sort != "" && f.sort != "name" && f.sort != "risk" {
+		return fmt.Errorf("--sort must be name or risk, got %q", f.sort)
+	}
+	severity, ok := export.ParseSeverity(f.failOn)
+	if !ok {
+		return fmt.Errorf("--fail-on must be one of %s, got %q", strings.Join(export.Severities, ", "), f.failOn)
+	}
+	f.failOn = severity
+	if f.minScore < 0 || f.minScore > 100 {
+		return fmt.Errorf("--min-score must be between 0 and 100, got %v", f.minScore)
+	}
+	return nil
+}
+
+// finish sorts the repositories and sums their risk across policies
+func (r *Report) finish(flags reportFlags) {
+	for _, p := range r.Policies {
+		repos := p.Repositories
+		switch flags.sort {
+		case "name":
+			sort.SliceStable(repos, func(i, j int) bool { return repos[i].FullName < repos[j].FullName })
+		case "risk":
+			sort.SliceStable(repos, func(i, j int) bool { return repos[i].RiskScore > repos[j].RiskScore })
+		}
+	}
+
+	risks := make(map[string]*RepositoryRisk)
+	r.Risks = []RepositoryRisk{}
+	for _, p := range r.Policies {
+		for _, repo := range p.Repositories {
+			if repo.Result != resultFail {
+				continue
+			}
+			risk, ok := risks[repo.FullName]
+			if !ok {
+				risk = &RepositoryRisk{FullName: repo.FullName, Failures: map[string]int{}}
+				risks[repo.FullName] = risk
+			}
+			risk.RiskScore += repo.RiskScore
+			risk.Failures[repo.Severity]++
+		}
+	}
+	for _, risk := range risks {
+		r.Risks = append(r.Risks, *risk)
+	}
+	sort.Slice(r.Risks, func(i, j int) bool {
+		if r.Risks[i].RiskScore != r.Risks[j].RiskScore {
+			return r.Risks[i].RiskScore > r.Risks[j].RiskScore
+		}
+		return r.Risks[i].FullName < r.Risks[j].FullName
+	})
+}
+
+// failures lists the failure counts from the most severe, e.g. "high: 2, low: 1"
+func (r RepositoryRisk) failures() string {
+	var parts []string
+	for i := len(export.Severities) - 1; i >= 0; i-- {
+		if n := r.Failures[export.Severities[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", export.Severities[i], n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// exitCode gates CI: errors win over violations. Only violations of at
+// least the --fail-on severity count, and a compliance score below
+// --min-score counts as a violation.
+func (r *Report) exitCode(flags reportFlags) int {
+	if r.Summary.Errors > 0 {
+		return exitError
+	}
+	for _, p := range r.Policies {
+		if o := p.Organization; o != nil && o.Result == resultFail && export.SeverityWeight(o.Severity) >= export.SeverityWeight(flags.failOn) {
+			return exitViolations
+		}
+		for _, repo := range p.Repositories {
+			severity := repo.Severity
+			if severity == "" {
+				// servers that predate severities
+				severity = export.DefaultSeverity
+			}
+			if repo.Result == resultFail && export.SeverityWeight(severity) >= export.SeverityWeight(flags.failOn) {
+				return exitViolations
+			}
+		}
+	}
+	if flags.minScore > 0 && r.Summary.Evaluated > 0 && r.Summary.ComplianceScore < flags.minScore {
+		return exitViolations
+	}
+	return exitOK
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+func testRepo(name, scanResult, severity string) *pb.RepositoryInfo {
+	return &pb.RepositoryInfo{Name: name, FullName: "acme/" + name, ScanResult: scanResult, Severity: severity}
+}
+
+// testReport builds the report of scans as the scan command does
+func testReport(filters []string, scans ...*pb.PolicyResponse) *Report {
+	report := &Report{}
+	for _, res := range scans {
+		p := newPolicyReport(policyFile{Name: res.GetPolicyName()}, res, filters)
+		report.Policies = append(report.Policies, p)
+		report.Summary.add(p.Summary)
+	}
+	report.finish(reportFlags{})
+	return report
+}
+
+func TestExitCode(t *testing.T) {
+	scan := func(repos ...*pb.RepositoryInfo) *pb.PolicyResponse {
+		return &pb.PolicyResponse{PolicyName: "p", Repositories: repos}
+	}
+	organization := func(scanResult, severity string) *pb.PolicyResponse {
+		res := scan(testRepo("api", "Success", ""))
+		res.Organization = &pb.OrganizationResult{ScanResult: scanResult, Severity: severity}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		scans    []*pb.PolicyResponse
+		filters  []string
+		failOn   string
+		minScore float64
+		want     int
+	}{
+		{
+			name:  "compliant",
+			scans: []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Success", ""))},
+			want:  exitOK,
+		},
+		{
+			name:  "violation",
+			scans: []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Failure", export.SeverityLow))},
+			want:  exitViolations,
+		},
+		{
+			name:   "violation below --fail-on",
+			scans:  []*pb.PolicyResponse{scan(testRepo("web", "Failure", export.SeverityMedium))},
+			failOn: export.SeverityHigh,
+			want:   exitOK,
+		},
+		{
+			name:   "violation at --fail-on",
+			scans:  []*pb.PolicyResponse{scan(testRepo("web", "Failure", export.SeverityMedium), testRepo("api", "Failure", export.SeverityHigh))},
+			failOn: export.SeverityHigh,
+			want:   exitViolations,
+		},
+		{
+			name:   "violation without severity is medium",
+			scans:  []*pb.PolicyResponse{scan(testRepo("web", "Failure", ""))},
+			failOn: export.SeverityMedium,
+			want:   exitViolations,
+		},
+		{
+			name:   "violation without severity below --fail-on",
+			scans:  []*pb.PolicyResponse{scan(testRepo("web", "Failure", ""))},
+			failOn: export.SeverityHigh,
+			want:   exitOK,
+		},
+		{
+			name:  "errors win over violations",
+			scans: []*pb.PolicyResponse{scan(testRepo("web", "Failure", export.SeverityCritical), testRepo("api", export.FetchErrorPrefix+"404 Not Found", ""))},
+			want:  exitError,
+		},
+		{
+			name: "failed scan",
+			scans: []*pb.PolicyResponse{
+				scan(testRepo("web", "Failure", export.SeverityCritical)),
+				{PolicyName: "q", Error: "failed to fetch repositories"},
+			},
+			want: exitError,
+		},
+		{
+			name:  "waived violation",
+			scans: []*pb.PolicyResponse{scan(testRepo("web", "Waived", export.SeverityCritical))},
+			want:  exitOK,
+		},
+		{
+			name:    "skipped violation and error",
+			scans:   []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Failure", export.SeverityCritical), testRepo("docs", "boom", ""))},
+			filters: []string{"api"},
+			want:    exitOK,
+		},
+		{
+			name:   "organization violation",
+			scans:  []*pb.PolicyResponse{organization("Failure", export.SeverityHigh)},
+			failOn: export.SeverityHigh,
+			want:   exitViolations,
+		},
+		{
+			name:   "organization violation below --fail-on",
+			scans:  []*pb.PolicyResponse{organization("Failure", export.SeverityMedium)},
+			failOn: export.SeverityHigh,
+			want:   exitOK,
+		},
+		{
+			name:  "organization error",
+			scans: []*pb.PolicyResponse{organization(export.FetchErrorPrefix+"403 Forbidden", "")},
+			want:  exitError,
+		},
+		{
+			// one low failure out of two: 100 * (1 - 1/20) = 95
+			name:     "score below --min-score",
+			scans:    []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Failure", export.SeverityLow))},
+			failOn:   export.SeverityCritical,
+			minScore: 95.5,
+			want:     exitViolations,
+		},
+		{
+			name:     "score at --min-score",
+			scans:    []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Failure", export.SeverityLow))},
+			failOn:   export.SeverityCritical,
+			minScore: 95,
+			want:     exitOK,
+		},
+		{
+			name:     "waivers count as compliant for --min-score",
+			scans:    []*pb.PolicyResponse{scan(testRepo("api", "Success", ""), testRepo("web", "Waived", export.SeverityCritical))},
+			minScore: 100,
+			want:     exitOK,
+		},
+		{
+			name:     "--min-score without evaluated repositories",
+			scans:    []*pb.PolicyResponse{scan(testRepo("web", "Failure", export.SeverityCritical))},
+			filters:  []string{"api"},
+			minScore: 100,
+			want:     exitOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := reportFlags{failOn: tt.failOn, minScore: tt.minScore}
+			if flags.failOn == "" {
+				flags.failOn = export.SeverityLow
+			}
+			if got := testReport(tt.filters, tt.scans...).exitCode(flags); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// policyCall runs one policy on the server
+type policyCall func(ctx context.Context, client pb.PolicyServiceClient, policy policyFile) (*pb.PolicyResponse, error)
+
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	var conn connOptions
+	conn.register(fs)
+	var policyOpts policyFlags
+	policyOpts.register(fs)
+	policyOpts.registerServerPolicies(fs)
+	org := fs.String("org", "", "organization to scan (defaults to the server's)")
+	endpoint := fs.String("endpoint", "", "named GitHub endpoint (defaults to the one serving the org)")
+	backend := fs.String("backend", "", "fetch backend, rest or graphql (defaults to the server's)")
+	orgPolicy := fs.String("organization-policy", "", "Rego file of organization-level rules (package organization), evaluated once with the first policy that isn't a bundle")
+	var filters stringList
+	fs.Var(&filters, "filter", "only report repositories whose name matches this glob (repeatable)")
+	var previous stringList
+	fs.Var(&previous, "previous", "earlier scan, by ID or JSON file, that html reports compare against (repeatable)")
+	output := fs.String("output", outputTable, reportOutputHelp())
+	var reportOpts reportFlags
+	reportOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, true); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if err := reportOpts.validate(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	policies, err := policyOpts.load()
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	var orgSource string
+	if *orgPolicy != "" {
+		source, err := os.ReadFile(*orgPolicy)
+		if err != nil {
+			log.Print(err)
+			return exitUsage
+		}
+		orgSource = string(source)
+		if !slices.ContainsFunc(policies, func(p policyFile) bool { return p.Bundle == "" }) {
+			log.Print("--organization-policy needs a policy that isn't a bundle")
+			return exitUsage
+		}
+	}
+
+	return runPolicies(&conn, policies, filters, previous, *output, reportOpts, func(ctx context.Context, client pb.PolicyServiceClient, policy policyFile) (*pb.PolicyResponse, error) {
+		req := &pb.PolicyRequest{
+			Policy:     policy.Source,
+			Bundle:     policy.Bundle,
+			PolicyRef:  policy.Ref,
+			PolicyName: policy.Name,
+			Org:        *org,
+			Endpoint:   *endpoint,
+			Backend:    *backend,
+		}
+		if policy.Bundle == "" {
+			req.OrganizationPolicy, orgSource = orgSource, ""
+		}
+		return client.ScanRepositories(ctx, req)
+	})
+}
+
+func runEvaluate(args []string) int {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	var conn connOptions
+	conn.register(fs)
+	var policyOpts policyFlags
+	policyOpts.register(fs)
+	policyOpts.registerServerPolicies(fs)
+	scanID := fs.String("scan-id", "", "evaluate the repositories of this stored scan")
+	input := fs.String("input", "", "evaluate the repositories of a scan saved as JSON (GET /v1/scans/{id})")
+	var filters stringList
+	fs.Var(&filters, "filter", "only report repositories whose name matches this glob (repeatable)")
+	var previous stringList
+	fs.Var(&previous, "previous", "earlier scan, by ID or JSON file, that html reports compare against (repeatable)")
+	output := fs.String("output", outputTable, reportOutputHelp())
+	var reportOpts reportFlags
+	reportOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, true); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if err := reportOpts.validate(); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if (*scanID == "") == (*input == "") {
+		log.Print("exactly one of --scan-id and --input is required")
+		return exitUsage
+	}
+	policies, err := policyOpts.load()
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+
+	var repositories []*pb.RepositoryInfo
+	if *input != "" {
+		saved, err := readScanFile(*input)
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		repositories = saved.GetRepositories()
+	}
+
+	return runPolicies(&conn, policies, filters, previous, *output, reportOpts, func(ctx context.Context, client pb.PolicyServiceClient, policy policyFile) (*pb.PolicyResponse, error) {
+		return client.EvaluatePolicy(ctx, &pb.EvaluateRequest{
+			Policy:       policy.Source,
+			Bundle:       policy.Bundle,
+			PolicyRef:    policy.Ref,
+			ScanId:       *scanID,
+			Repositories: repositories,
+			PolicyName:   policy.Name,
+		})
+	})
+}
+
+// runPolicies calls the server once per policy, prints the report and
+// returns the exit code
+func runPolicies(conn *connOptions, policies []policyFile, filters, previous []string, output string, flags reportFlags, call policyCall) int {
+	shutdownTracing := setupTracing()
+	defer shutdownTracing(context.Background())
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+
+	report := &Report{}
+	var scans []*pb.PolicyResponse
+	for _, policy := range policies {
+		log.Printf("Running policy %s (%s)...", policy.Name, policy.Path)
+
+		ctx, cancel := conn.rpcContext()
+		ctx, span := tracer.Start(ctx, "policy "+policy.Name)
+		res, err := call(ctx, client, policy)
+		span.End()
+		cancel()
+
+		if err != nil {
+			res = &pb.PolicyResponse{Error: status.Convert(err).Message()}
+			log.Printf("Policy %s failed: %v", policy.Name, err)
+		}
+		res.PolicyName = policy.Name
+		scans = append(scans, filterScan(res, filters))
+		policyReport := newPolicyReport(policy, res, filters)
+		report.Policies = append(report.Policies, policyReport)
+		report.Summary.add(policyReport.Summary)
+	}
+	report.finish(flags)
+
+	if format, lookupErr := export.Lookup(output); lookupErr == nil {
+		var opts export.Options
+		for _, ref := range previous {
+			scan, err := loadScan(conn, ref)
+			if err != nil {
+				log.Print(err)
+				return exitError
+			}
+			opts.Previous = append(opts.Previous, filterScan(scan, filters))
+		}
+		err = format.Write(os.Stdout, scans, opts)
+	} else {
+		err = writeOutput(os.Stdout, output, report)
+	}
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return report.exitCode(flags)
+}
+
+// filterScan marks the repositories skipped by the filters, so reports
+// can list them as skipped
+func filterScan(res *pb.PolicyResponse, filters []string) *pb.PolicyResponse {
+	filtered := proto.Clone(res).(*pb.PolicyResponse)
+	for _, repo := range filtered.GetRepositories() {
+		if !matchesFilters(repo.GetName(), filters) {
+			repo.ScanResult = export.ResultSkipped
+		}
+	}
+	return filtered
+}
+
+// readScanFile reads a PolicyResponse saved as JSON
+func readScanFile(path string) (*pb.PolicyResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var res pb.PolicyResponse
+	if err := protojson.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &res, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+func TestFilterScan(t *testing.T) {
+	res := &pb.PolicyResponse{
+		ScanId: "scan-1",
+		Repositories: []*pb.RepositoryInfo{
+			testRepo("api", "Failure", export.SeverityHigh),
+			testRepo("api-gateway", "Success", ""),
+			testRepo("web", "Waived", export.SeverityLow),
+			testRepo("docs", "boom", ""),
+		},
+	}
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string // scan_result of each repository
+	}{
+		{
+			name: "no filters",
+			want: []string{"Failure", "Success", "Waived", "boom"},
+		},
+		{
+			name:    "glob",
+			filters: []string{"api*"},
+			want:    []string{"Failure", "Success", export.ResultSkipped, export.ResultSkipped},
+		},
+		{
+			name:    "several filters",
+			filters: []string{"web", "docs"},
+			want:    []string{export.ResultSkipped, export.ResultSkipped, "Waived", "boom"},
+		},
+		{
+			name:    "no match",
+			filters: []string{"missing"},
+			want:    []string{export.ResultSkipped, export.ResultSkipped, export.ResultSkipped, export.ResultSkipped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := filterScan(res, tt.filters)
+			if filtered.GetScanId() != "scan-1" {
+				t.Errorf("scan_id %q, want scan-1", filtered.GetScanId())
+			}
+			for i, repo := range filtered.GetRepositories() {
+				if repo.GetScanResult() != tt.want[i] {
+					t.Errorf("%s: scan_result %q, want %q", repo.GetName(), repo.GetScanResult(), tt.want[i])
+				}
+			}
+			// skipped repositories are left out of the compliance score
+			evaluated := 0
+			for _, r := range tt.want {
+				if r == "Failure" || r == "Success" || r == "Waived" {
+					evaluated++
+				}
+			}
+			if got := export.Score(filtered.GetRepositories()).GetEvaluated(); int(got) != evaluated {
+				t.Errorf("evaluated %d repositories, want %d", got, evaluated)
+			}
+		})
+	}
+	if res.GetRepositories()[0].GetScanResult() != "Failure" {
+		t.Error("filterScan changed the scan it filtered")
+	}
+}
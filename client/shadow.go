@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+// ShadowReport lists the repositories whose decision would change if the
+// shadow version of a registered policy were promoted
+type ShadowReport struct {
+	Policy        string `json:"policy" yaml:"policy"`
+	ScanID        string `json:"scan_id" yaml:"scan_id"`
+	ActiveVersion string `json:"active_version" yaml:"active_version"`
+	ShadowVersion string `json:"shadow_version" yaml:"shadow_version"`
+	Evaluated     int    `json:"evaluated" yaml:"evaluated"`
+	NewFailures   int    `json:"new_failures" yaml:"new_failures"`
+	NewPasses     int    `json:"new_passes" yaml:"new_passes"`
+	// set when the shadow version could not be evaluated
+	Error   string         `json:"error,omitempty" yaml:"error,omitempty"`
+	Changes []ShadowChange `json:"changes" yaml:"changes"`
+}
+
+type ShadowChange struct {
+	FullName     string `json:"full_name" yaml:"full_name"`
+	Result       string `json:"result" yaml:"result"`
+	ShadowResult string `json:"shadow_result" yaml:"shadow_result"`
+	// evaluation error of the shadow version, when ShadowResult is error
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// ShadowReports is printed by the shadow command
+type ShadowReports struct {
+	Reports []*ShadowReport `json:"reports" yaml:"reports"`
+}
+
+// runShadow prints the shadow reports of stored scans
+func runShadow(args []string) int {
+	fs := flag.NewFlagSet("shadow", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: scanner-cli shadow [flags] <scan id>...")
+		fs.PrintDefaults()
+	}
+	var conn connOptions
+	conn.register(fs)
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+
+	reports := &ShadowReports{Reports: []*ShadowReport{}}
+	for _, scanID := range fs.Args() {
+		ctx, cancel := conn.rpcContext()
+		res, err := client.GetShadowReport(ctx, &pb.GetShadowReportRequest{ScanId: scanID})
+		cancel()
+		if err != nil {
+			log.Printf("Shadow report of scan %s failed: %v", scanID, err)
+			return exitError
+		}
+		report := &ShadowReport{
+			Policy:        res.GetPolicyName(),
+			ScanID:        res.GetScanId(),
+			ActiveVersion: res.GetActiveVersion(),
+			ShadowVersion: res.GetShadowVersion(),
+			Evaluated:     int(res.GetEvaluated()),
+			NewFailures:   int(res.GetNewFailures()),
+			NewPasses:     int(res.GetNewPasses()),
+			Error:         res.GetError(),
+			Changes:       []ShadowChange{},
+		}
+		for _, d := range res.GetChanges() {
+			report.Changes = append(report.Changes, newShadowChange(d))
+		}
+		reports.Reports = append(reports.Reports, report)
+	}
+	if err := writeOutput(os.Stdout, *output, reports); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
+}
+
+// newShadowReport summarizes the shadow evaluation of a scan, nil when the
+// policy has no shadow version; filtered out repositories are left out
+func newShadowReport(res *pb.PolicyResponse, filters []string) *ShadowReport {
+	shadow := res.GetShadow()
+	if shadow == nil {
+		return nil
+	}
+	report := &ShadowReport{
+		Policy:        res.GetPolicyName(),
+		ScanID:        res.GetScanId(),
+		ActiveVersion: res.GetPolicyVersion(),
+		ShadowVersion: shadow.GetPolicyVersion(),
+		Error:         shadow.GetError(),
+		Changes:       []ShadowChange{},
+	}
+	for _, d := range shadow.GetDecisions() {
+		if !matchesFilters(path.Base(d.GetRepository()), filters) {
+			continue
+		}
+		report.Evaluated++
+		if !d.GetChanged() {
+			continue
+		}
+		change := newShadowChange(d)
+		switch {
+		case change.Result == resultPass && change.ShadowResult == resultFail:
+			report.NewFailures++
+		case change.Result == resultFail && change.ShadowResult == resultPass:
+			report.NewPasses++
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return report
+}
+
+func newShadowChange(d *pb.ShadowDecision) ShadowChange {
+	result, _ := classifyResult(d.GetActiveResult())
+	shadowResult, message := classifyResult(d.GetScanResult())
+	return ShadowChange{FullName: d.GetRepository(), Result: result, ShadowResult: shadowResult, Message: message}
+}
+
+func (r *ShadowReports) writeTable(w *tabwriter.Writer) {
+	writeShadowTable(w, r.Reports)
+}
+
+// writeShadowTable lists the decisions that would change, then the totals
+// of each shadow version
+func writeShadowTable(w *tabwriter.Writer, reports []*ShadowReport) {
+	fmt.Fprintln(w, "POLICY\tSHADOW VERSION\tREPOSITORY\tRESULT\tSHADOW RESULT\tMESSAGE")
+	for _, r := range reports {
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t%s\t%s\n", r.Policy, r.ShadowVersion, resultError, r.Error)
+		}
+		for _, c := range r.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Policy, r.ShadowVersion, c.FullName, c.Result, c.ShadowResult, c.Message)
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "POLICY\tACTIVE VERSION\tSHADOW VERSION\tSCAN ID\tEVALUATED\tCHANGED\tNEW FAILURES\tNEW PASSES")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n", r.Policy, r.ActiveVersion, r.ShadowVersion, r.ScanID, r.Evaluated, len(r.Changes), r.NewFailures, r.NewPasses)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/tester"
+)
+
+// TestReport is the outcome of the Rego unit tests of the selected policies
+type TestReport struct {
+	Tests   []TestResult `json:"tests" yaml:"tests"`
+	Summary TestSummary  `json:"summary" yaml:"summary"`
+}
+
+type TestResult struct {
+	Policy   string `json:"policy" yaml:"policy"`
+	Name     string `json:"name" yaml:"name"`
+	Result   string `json:"result" yaml:"result"`
+	Message  string `json:"message,omitempty" yaml:"message,omitempty"`
+	Duration string `json:"duration" yaml:"duration"`
+}
+
+type TestSummary struct {
+	Passed  int `json:"passed" yaml:"passed"`
+	Failed  int `json:"failed" yaml:"failed"`
+	Errors  int `json:"errors" yaml:"errors"`
+	Skipped int `json:"skipped" yaml:"skipped"`
+}
+
+// runTest runs the test_ rules of <policy>_test.rego against each policy,
+// locally with the same OPA version as the server
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var policyOpts policyFlags
+	policyOpts.register(fs)
+	run := fs.String("run", "", "only run tests whose name matches this regular expression")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of each test")
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	policies, err := policyOpts.load()
+	if err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+
+	report := &TestReport{Tests: []TestResult{}}
+	for _, policy := range policies {
+		if len(policy.Tests) == 0 {
+			continue
+		}
+		// Policies share the repository package, so each is tested on its own
+		results, err := testPolicy(policy, *run, *timeout)
+		if err != nil {
+			report.Tests = append(report.Tests, TestResult{Policy: policy.Name, Result: resultError, Message: err.Error()})
+			report.Summary.Errors++
+			continue
+		}
+		for _, r := range results {
+			result := TestResult{Policy: policy.Name, Name: r.Name, Duration: r.Duration.String()}
+			switch {
+			case r.Error != nil:
+				result.Result, result.Message = resultError, r.Error.Error()
+				report.Summary.Errors++
+			case r.Skip:
+				result.Result = resultSkipped
+				report.Summary.Skipped++
+			case r.Fail:
+				result.Result = resultFail
+				if r.FailedAt != nil {
+					result.Message = fmt.Sprintf("failed at %s: %s", r.FailedAt.Location, r.FailedAt)
+				}
+				report.Summary.Failed++
+			default:
+				result.Result = resultPass
+				report.Summary.Passed++
+			}
+			report.Tests = append(report.Tests, result)
+		}
+	}
+
+	if len(report.Tests) == 0 {
+		log.Print("no tests found; tests of foo.rego go in foo_test.rego")
+	}
+	if err := writeOutput(os.Stdout, *output, report); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	switch {
+	case report.Summary.Errors > 0:
+		return exitError
+	case report.Summary.Failed > 0:
+		return exitViolations
+	default:
+		return exitOK
+	}
+}
+
+func testPolicy(policy policyFile, run string, timeout time.Duration) ([]*tester.Result, error) {
+	modules := make(map[string]*ast.Module)
+	for _, path := range append([]string{policy.Path}, policy.Tests...) {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		module, err := ast.ParseModuleWithOpts(path, string(source), ast.ParserOptions{RegoVersion: ast.RegoV1})
+		if err != nil {
+			return nil, err
+		}
+		modules[path] = module
+	}
+
+	runner := tester.NewRunner().SetModules(modules).SetTimeout(timeout)
+	if run != "" {
+		runner = runner.Filter(run)
+	}
+	ch, err := runner.RunTests(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var results []*tester.Result
+	for r := range ch {
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func (r *TestReport) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "POLICY\tTEST\tRESULT\tDURATION\tMESSAGE")
+	for _, t := range r.Tests {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Policy, orDash(t.Name), t.Result, orDash(t.Duration), t.Message)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Passed: %d, Failed: %d, Errors: %d, Skipped: %d\n", r.Summary.Passed, r.Summary.Failed, r.Summary.Errors, r.Summary.Skipped)
+}
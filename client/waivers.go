@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	pb "github-scanner/src/pb"
+)
+
+const waiversUsage = `Usage: scanner-cli waivers <command> [flags]
+
+Commands:
+  list         list the active waivers; --all includes the expired ones
+  create       exempt a repository, or a user's access to it, from a policy:
+               --policy p --repo owner/name [--user login] --justification text
+               --approver login --expires YYYY-MM-DD
+  delete <id>  revoke a waiver
+
+Flags go before the arguments.
+`
+
+// WaiverList lists waivers
+type WaiverList struct {
+	Waivers []Waiver `json:"waivers" yaml:"waivers"`
+}
+
+type Waiver struct {
+	ID            string `json:"waiver_id" yaml:"waiver_id"`
+	Policy        string `json:"policy" yaml:"policy"`
+	Repository    string `json:"repository" yaml:"repository"`
+	User          string `json:"user,omitempty" yaml:"user,omitempty"`
+	Justification string `json:"justification" yaml:"justification"`
+	Approver      string `json:"approver" yaml:"approver"`
+	ExpiresAt     string `json:"expires_at" yaml:"expires_at"`
+	CreatedBy     string `json:"created_by,omitempty" yaml:"created_by,omitempty"`
+	CreatedAt     string `json:"created_at" yaml:"created_at"`
+	Expired       bool   `json:"expired" yaml:"expired"`
+}
+
+// runWaivers manages the server's waivers
+func runWaivers(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, waiversUsage)
+		return exitUsage
+	}
+	command, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("waivers "+command, flag.ContinueOnError)
+	var conn connOptions
+	conn.register(fs)
+	output := fs.String("output", outputTable, "output format: table, json or yaml")
+	var req pb.CreateWaiverRequest
+	var listReq pb.ListWaiversRequest
+	wantArgs := 0
+	switch command {
+	case "list":
+		fs.StringVar(&listReq.Policy, "policy", "", "only the waivers of this policy")
+		fs.BoolVar(&listReq.IncludeExpired, "all", false, "include the expired waivers")
+	case "create":
+		fs.StringVar(&req.Policy, "policy", "", "policy name, as results are reported under (required)")
+		fs.StringVar(&req.Repository, "repo", "", "repository full name, owner/name (required)")
+		fs.StringVar(&req.User, "user", "", "only waive the violations this user's access causes")
+		fs.StringVar(&req.Justification, "justification", "", "why the repository may violate the policy (required)")
+		fs.StringVar(&req.Approver, "approver", "", "who approved the waiver (required)")
+		fs.StringVar(&req.ExpiresAt, "expires", "", "expiry, YYYY-MM-DD for the end of that day (UTC) or RFC 3339 (required)")
+	case "delete":
+		wantArgs = 1
+	case "help", "-h", "-help", "--help":
+		fmt.Print(waiversUsage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown waivers command %q\n\n%s", command, waiversUsage)
+		return exitUsage
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(*output, false); err != nil {
+		log.Print(err)
+		return exitUsage
+	}
+	if fs.NArg() != wantArgs {
+		fmt.Fprint(os.Stderr, waiversUsage)
+		return exitUsage
+	}
+
+	clientConn, client, err := conn.connect()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	defer clientConn.Close()
+	ctx, cancel := conn.rpcContext()
+	defer cancel()
+
+	var waivers []*pb.Waiver
+	switch command {
+	case "list":
+		var res *pb.ListWaiversResponse
+		res, err = client.ListWaivers(ctx, &listReq)
+		waivers = res.GetWaivers()
+	case "create":
+		var res *pb.Waiver
+		res, err = client.CreateWaiver(ctx, &req)
+		waivers = append(waivers, res)
+	case "delete":
+		_, err = client.DeleteWaiver(ctx, &pb.DeleteWaiverRequest{WaiverId: fs.Arg(0)})
+		if err == nil {
+			log.Printf("Deleted waiver %s", fs.Arg(0))
+			return exitOK
+		}
+	}
+	if err != nil {
+		log.Printf("waivers %s failed: %v", command, err)
+		return exitError
+	}
+
+	list := &WaiverList{Waivers: []Waiver{}}
+	for _, w := range waivers {
+		list.Waivers = append(list.Waivers, waiverFromProto(w))
+	}
+	if err := writeOutput(os.Stdout, *output, list); err != nil {
+		log.Print(err)
+		return exitError
+	}
+	return exitOK
+}
+
+func waiverFromProto(w *pb.Waiver) Waiver {
+	return Waiver{
+		ID:            w.GetWaiverId(),
+		Policy:        w.GetPolicy(),
+		Repository:    w.GetRepository(),
+		User:          w.GetUser(),
+		Justification: w.GetJustification(),
+		Approver:      w.GetApprover(),
+		ExpiresAt:     w.GetExpiresAt(),
+		CreatedBy:     w.GetCreatedBy(),
+		CreatedAt:     w.GetCreatedAt(),
+		Expired:       w.GetExpired(),
+	}
+}
+
+func (l *WaiverList) writeTable(w *tabwriter.Writer) {
+	fmt.Fprintln(w, "WAIVER\tPOLICY\tREPOSITORY\tUSER\tEXPIRES\tSTATE\tAPPROVER\tJUSTIFICATION")
+	for _, wv := range l.Waivers {
+		state := "active"
+		if wv.Expired {
+			state = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", wv.ID, wv.Policy, wv.Repository, orDash(wv.User), wv.ExpiresAt, state, wv.Approver, wv.Justification)
+	}
+}
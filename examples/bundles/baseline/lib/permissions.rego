@@ -0,0 +1,8 @@
+# Helpers shared by the policies of the bundle
+package lib.permissions
+
+import rego.v1
+
+admins(repo) := {p.username | some p in repo.permissions; p.role == "admin"}
+
+writers(repo) := {p.username | some p in repo.permissions; p.role in {"write", "maintain", "admin"}}
@@ -0,0 +1,18 @@
+# Allow repositories with few enough admins; public repositories must not
+# grant write access to more than the configured number of users
+package repository
+
+import data.lib.permissions
+import rego.v1
+
+default allow := false
+
+allow if {
+	count(permissions.admins(input)) <= data.baseline.max_admins
+	not too_many_public_writers
+}
+
+too_many_public_writers if {
+	input.private == false
+	count(permissions.writers(input)) > data.baseline.max_public_writers
+}
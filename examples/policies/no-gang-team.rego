@@ -0,0 +1,12 @@
+# Deny access to users who belong to the "gang" team, regardless of role
+package repository
+import rego.v1
+
+default allow = false
+default deny = false
+
+deny if {
+	some i
+	input.permissions[i].username == input.user.username
+	startswith(input.permissions[i].source, "team:gang")
+}
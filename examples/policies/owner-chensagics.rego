@@ -0,0 +1,9 @@
+# Allow access if the repository owner is "Chensagics"
+package repository
+import rego.v1
+
+default allow = false
+
+allow if {
+	input.owner == "Chensagics"
+}
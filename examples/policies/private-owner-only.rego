@@ -0,0 +1,11 @@
+# Deny access if the repository is private and the user is not the owner
+package repository
+import rego.v1
+
+default allow = false
+default deny = false
+
+deny if {
+	input.private == true
+	input.user.username != input.owner
+}
@@ -0,0 +1,11 @@
+# Allow access if the repository is private and has an admin
+package repository
+import rego.v1
+
+default allow = false
+
+allow if {
+	input.private == true
+	some i
+	input.permissions[i].role == "admin"
+}
@@ -0,0 +1,12 @@
+# Allow access if the repository is public and the user has at least "read" permission
+package repository
+import rego.v1
+
+default allow = false
+
+allow if {
+	input.private == false
+	some i
+	input.permissions[i].username == input.user.username
+	input.permissions[i].role == "read"
+}
@@ -0,0 +1,11 @@
+# Allow access if the repository is public and the user has "write" permission
+package repository
+import rego.v1
+
+default allow = false
+
+allow if {
+	input.private == false
+	some i
+	input.permissions[i].role == "write"
+}
@@ -0,0 +1,9 @@
+# Allow access if the repository is public
+package repository
+import rego.v1
+
+default allow = false
+
+allow if {
+	input.private == false
+}
@@ -0,0 +1,12 @@
+package repository_test
+import rego.v1
+
+import data.repository
+
+test_public_repository_allowed if {
+	repository.allow with input as {"private": false}
+}
+
+test_private_repository_not_allowed if {
+	not repository.allow with input as {"private": true}
+}
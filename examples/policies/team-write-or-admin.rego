@@ -0,0 +1,21 @@
+# Allow access if the user belongs to a team that has repository permissions
+package repository
+import rego.v1
+
+default allow = false
+
+# Check if user has access via team permissions
+allow if {
+	some i
+	input.permissions[i].source == "team"
+	input.permissions[i].username == input.user.username
+	input.permissions[i].role == "write"
+}
+
+# Check if user has admin role via team membership
+allow if {
+	some i
+	input.permissions[i].source == "team"
+	input.permissions[i].username == input.user.username
+	input.permissions[i].role == "admin"
+}
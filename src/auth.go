@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthConfig configures caller authentication and per-RPC authorization
+type AuthConfig struct {
+	TokensFile   string `yaml:"tokens_file" toml:"tokens_file"` // JSON list of static bearer tokens
+	JWKSFile     string `yaml:"jwks_file" toml:"jwks_file"`     // local JWKS used to verify OIDC ID tokens
+	OIDCIssuer   string `yaml:"oidc_issuer" toml:"oidc_issuer"`
+	OIDCAudience string `yaml:"oidc_audience" toml:"oidc_audience"`
+	PolicyFile   string `yaml:"policy_file" toml:"policy_file"` // Rego module exposing data.authz.allow
+}
+
+func (c AuthConfig) Enabled() bool {
+	return c.TokensFile != "" || c.JWKSFile != ""
+}
+
+// Principal is the authenticated caller of an RPC
+type Principal struct {
+	Subject string   `json:"subject"`
+	Groups  []string `json:"groups"`
+	Method  string   `json:"method"` // "token" or "oidc"
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller attached by the auth interceptors
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// staticToken is an entry of the tokens file. Tokens may be given in clear
+// text or as "sha256:<hex>" so the file doesn't have to hold the secret.
+type staticToken struct {
+	Token   string   `json:"token"`
+	Subject string   `json:"subject"`
+	Groups  []string `json:"groups"`
+}
+
+// the policy used when no auth.policy_file is configured: any authenticated caller may do anything
+const defaultAuthzPolicy = `
+package authz
+
+default allow := true
+`
+
+// Authenticator validates bearer credentials and authorizes RPCs against a Rego policy
+type Authenticator struct {
+	tokens       []staticToken
+	jwks         map[string]interface{}
+	oidcIssuer   string
+	oidcAudience string
+	authz        rego.PreparedEvalQuery
+	defaultOrg   string
+}
+
+func NewAuthenticator(config AuthConfig, defaultOrg string) (*Authenticator, error) {
+	a := &Authenticator{
+		oidcIssuer:   config.OIDCIssuer,
+		oidcAudience: config.OIDCAudience,
+		defaultOrg:   defaultOrg,
+	}
+
+	if config.TokensFile != "" {
+		data, err := os.ReadFile(config.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tokens file: %w", err)
+		}
+		if err := json.Unmarshal(data, &a.tokens); err != nil {
+			return nil, fmt.Errorf("invalid tokens file %s: %w", config.TokensFile, err)
+		}
+	}
+
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = keys
+	}
+
+	policy := defaultAuthzPolicy
+	if config.PolicyFile != "" {
+		data, err := os.ReadFile(config.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read authorization policy: %w", err)
+		}
+		policy = string(data)
+	}
+	query, err := rego.New(
+		rego.Query("data.authz.allow"),
+		rego.Module("authz.rego", policy),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare authorization policy: %w", err)
+	}
+	a.authz = query
+
+	return a, nil
+}
+
+// authenticate resolves the bearer token in the request metadata to a principal
+func (a *Authenticator) authenticate(ctx context.Context) (*Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization header must be a bearer token")
+	}
+
+	if p := a.matchStaticToken(token); p != nil {
+		return p, nil
+	}
+	if a.jwks != nil && strings.Count(token, ".") == 2 {
+		p, err := a.verifyJWT(token)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+		return p, nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func (a *Authenticator) matchStaticToken(token string) *Principal {
+	sum := sha256.Sum256([]byte(token))
+	hashed := "sha256:" + fmt.Sprintf("%x", sum)
+
+	for _, t := range a.tokens {
+		candidate := token
+		if strings.HasPrefix(t.Token, "sha256:") {
+			candidate = hashed
+		}
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(t.Token)) == 1 {
+			return &Principal{Subject: t.Subject, Groups: t.Groups, Method: "token"}
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) verifyJWT(token string) (*Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.oidcIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.oidcIssuer))
+	}
+	if a.oidcAudience != "" {
+		opts = append(opts, jwt.WithAudience(a.oidcAudience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := a.jwks[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims.GetSubject()
+	p := &Principal{Subject: subject, Method: "oidc"}
+	if groups, ok := claims["groups"].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				p.Groups = append(p.Groups, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+// authorize evaluates data.authz.allow for the caller, RPC and organization
+func (a *Authenticator) authorize(ctx context.Context, p *Principal, fullMethod string, org string) error {
+	if org == "" {
+		org = a.defaultOrg
+	}
+	input := map[string]interface{}{
+		"principal": p,
+		"rpc":       fullMethod,
+		"org":       org,
+	}
+
+	rs, err := a.authz.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		slog.ErrorContext(ctx, "Authorization policy evaluation failed", "error", err)
+		return status.Error(codes.Internal, "authorization failed")
+	}
+	allowed := len(rs) > 0 && len(rs[0].Expressions) > 0 && rs[0].Expressions[0].Value == true
+	if !allowed {
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed to call %s on %s", p.Subject, fullMethod, org)
+	}
+	return nil
+}
+
+// authorizeOrg authorizes the caller of the current RPC for an org its
+// request doesn't name, such as the org of a stored scan or the owner of a
+// waived repository; a nil authenticator allows every org
+func (a *Authenticator) authorizeOrg(ctx context.Context, org string) error {
+	if a == nil {
+		return nil
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "unauthenticated caller")
+	}
+	method, _ := grpc.Method(ctx)
+	return a.authorize(ctx, p, method, org)
+}
+
+// requests that target an organization
+type orgRequest interface {
+	GetOrg() string
+}
+
+func requestOrg(req interface{}) string {
+	if r, ok := req.(orgRequest); ok {
+		return r.GetOrg()
+	}
+	return ""
+}
+
+// health checks and server reflection, which probes and tools such as
+// grpc_health_probe and grpcurl call without credentials
+var publicMethodPrefixes = []string{"/grpc.health.v1.Health/", "/grpc.reflection."}
+
+func publicMethod(fullMethod string) bool {
+	for _, prefix := range publicMethodPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryInterceptor authenticates the caller and authorizes the RPC for the requested org
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	p, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.authorize(ctx, p, info.FullMethod, requestOrg(req)); err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, principalKey{}, p), req)
+}
+
+// StreamInterceptor authenticates the caller when the stream opens and
+// authorizes every received message for the org it targets
+func (a *Authenticator) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if publicMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx := ss.Context()
+	p, err := a.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{
+		ServerStream: ss,
+		ctx:          context.WithValue(ctx, principalKey{}, p),
+		auth:         a,
+		principal:    p,
+		method:       info.FullMethod,
+	})
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	auth      *Authenticator
+	principal *Principal
+	method    string
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.auth.authorize(s.ctx, s.principal, s.method, requestOrg(m))
+}
+
+// loads the RSA and EC public keys of a JWKS document, indexed by key id
+func loadJWKS(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %s: %w", path, err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err1 := decodeJWKInt(k.N)
+			e, err2 := decodeJWKInt(k.E)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid RSA key %q in %s", k.Kid, path)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve %q for key %q", k.Crv, k.Kid)
+			}
+			x, err1 := decodeJWKInt(k.X)
+			y, err2 := decodeJWKInt(k.Y)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid EC key %q in %s", k.Kid, path)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			slog.Warn("Ignoring JWKS key with unsupported type", "kid", k.Kid, "kty", k.Kty)
+		}
+	}
+	return keys, nil
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
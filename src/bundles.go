@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// query of inline policies, and of bundles that don't name an entrypoint
+const defaultEntrypoint = "data.repository"
+
+// Policy is what a scan evaluates: inline Rego source, or a bundle loaded
+// by the server
+type Policy struct {
+	Source string
+	Bundle *PolicyBundle
+	// module of the organization-level rules of an inline or registered
+	// policy; bundles bring their own
+	Organization string
+	// shadow versions are evaluated alongside the active version of a
+	// registered policy, without enforcing their decisions
+	Shadow bool
+}
+
+// regoOptions sets the query and the modules of the policy
+func (p Policy) regoOptions() []func(*rego.Rego) {
+	return p.queryOptions(p.entrypoint())
+}
+
+// queryOptions sets a query of the policy's modules
+func (p Policy) queryOptions(query string) []func(*rego.Rego) {
+	if p.Bundle != nil {
+		return []func(*rego.Rego){
+			rego.Query(query),
+			rego.ParsedBundle(p.Bundle.Name, p.Bundle.bundle),
+		}
+	}
+	options := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Module("repository.rego", p.Source),
+	}
+	if p.Organization != "" {
+		options = append(options, rego.Module("organization.rego", p.Organization))
+	}
+	return options
+}
+
+// PolicyBundle is an OPA bundle: several Rego modules sharing helper
+// packages and data.json files, with an optional .manifest
+type PolicyBundle struct {
+	Name     string
+	Path     string
+	Revision string
+	// query whose allow/deny decide a repository's result
+	Entrypoint string
+	// query whose allow/deny decide the organization's result, evaluated
+	// when a module of the bundle declares its package
+	OrganizationEntrypoint string
+
+	bundle *bundle.Bundle
+}
+
+// bundleStore holds the bundles loaded at startup, by name
+type bundleStore struct {
+	bundles map[string]*PolicyBundle
+}
+
+// loadBundles reads and compiles every configured bundle, so a broken
+// bundle stops the server instead of failing scans
+func loadBundles(ctx context.Context, paths []string) (*bundleStore, error) {
+	store := &bundleStore{bundles: make(map[string]*PolicyBundle)}
+	for _, path := range paths {
+		b, err := loadBundle(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("bundle %s: %w", path, err)
+		}
+		if other, ok := store.bundles[b.Name]; ok {
+			return nil, fmt.Errorf("bundle %s: name %q is already used by %s", path, b.Name, other.Path)
+		}
+		store.bundles[b.Name] = b
+		slog.Info("Loaded policy bundle", "bundle", b.Name, "path", path, "revision", b.Revision, "modules", len(b.bundle.Modules))
+	}
+	return store, nil
+}
+
+// loadBundle reads a bundle directory or .tar.gz. It is named by the
+// "name" of the manifest's metadata, or else after its path; "entrypoint"
+// in the metadata overrides the query.
+func loadBundle(ctx context.Context, path string) (*PolicyBundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var loader bundle.DirectoryLoader
+	if info.IsDir() {
+		loader = bundle.NewDirectoryLoader(path)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		loader = bundle.NewTarballLoaderWithBaseURL(f, path)
+	}
+	b, err := bundle.NewCustomReader(loader).WithRegoVersion(ast.RegoV1).Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Modules) == 0 {
+		return nil, fmt.Errorf("no .rego files")
+	}
+
+	loaded := &PolicyBundle{
+		Name:                   bundleName(path),
+		Path:                   path,
+		Revision:               b.Manifest.Revision,
+		Entrypoint:             defaultEntrypoint,
+		OrganizationEntrypoint: organizationEntrypoint,
+		bundle:                 &b,
+	}
+	if name, ok := b.Manifest.Metadata["name"].(string); ok && name != "" {
+		loaded.Name = name
+	}
+	if entrypoint, ok := b.Manifest.Metadata["entrypoint"].(string); ok && entrypoint != "" {
+		if _, err := ast.ParseRef(entrypoint); err != nil {
+			return nil, fmt.Errorf("invalid entrypoint %q: %w", entrypoint, err)
+		}
+		loaded.Entrypoint = entrypoint
+	}
+	if entrypoint, ok := b.Manifest.Metadata["organization_entrypoint"].(string); ok && entrypoint != "" {
+		if _, err := ast.ParseRef(entrypoint); err != nil {
+			return nil, fmt.Errorf("invalid organization_entrypoint %q: %w", entrypoint, err)
+		}
+		loaded.OrganizationEntrypoint = entrypoint
+	}
+
+	if _, err := preparePolicy(ctx, Policy{Bundle: loaded}); err != nil {
+		return nil, err
+	}
+	if _, err := (Policy{Bundle: loaded}).annotatedSeverity(); err != nil {
+		return nil, err
+	}
+	if _, err := (Policy{Bundle: loaded}).severityOf(loaded.OrganizationEntrypoint); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// bundleName derives a name from the bundle's path, e.g. "baseline" for
+// /etc/scanner/baseline.tar.gz
+func bundleName(path string) string {
+	name := filepath.Base(filepath.Clean(path))
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+func (s *bundleStore) get(name string) (*PolicyBundle, bool) {
+	b, ok := s.bundles[name]
+	return b, ok
+}
+
+// list returns the bundles sorted by name
+func (s *bundleStore) list() []*PolicyBundle {
+	bundles := make([]*PolicyBundle, 0, len(s.bundles))
+	for _, b := range s.bundles {
+		bundles = append(bundles, b)
+	}
+	sort.Slice(bundles, func(i, j int) bool { return bundles[i].Name < bundles[j].Name })
+	return bundles
+}
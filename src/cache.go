@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// repoCache keeps fetched repository data for a while so consecutive scans
+// of the same org (typically one per policy) don't refetch it from GitHub
+type repoCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]repoCacheEntry
+}
+
+type repoCacheEntry struct {
+	repos     []RepositoryInfo
+	fetchedAt time.Time
+}
+
+func newRepoCache(ttl time.Duration) *repoCache {
+	return &repoCache{ttl: ttl, entries: make(map[string]repoCacheEntry)}
+}
+
+func repoCacheKey(endpoint, org, backend string) string {
+	return endpoint + "/" + org + "/" + backend
+}
+
+// get returns a copy of the cached repositories; a nil cache never hits
+func (c *repoCache) get(key string) ([]RepositoryInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(entry.fetchedAt) > c.ttl {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return append([]RepositoryInfo(nil), entry.repos...), true
+}
+
+// invalidate drops the cached repositories of an org, on every endpoint and
+// backend
+func (c *repoCache) invalidate(org string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if parts := strings.SplitN(key, "/", 3); len(parts) == 3 && strings.EqualFold(parts[1], org) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *repoCache) put(key string, repos []RepositoryInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = repoCacheEntry{
+		repos:     append([]RepositoryInfo(nil), repos...),
+		fetchedAt: time.Now(),
+	}
+}
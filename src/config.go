@@ -0,0 +1,578 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every server setting. Values are layered: defaults, then the
+// config file, then environment variables, then command line flags.
+type Config struct {
+	Org           string              `yaml:"org" toml:"org"`
+	Server        ServerConfig        `yaml:"server" toml:"server"`
+	Scan          ScanConfig          `yaml:"scan" toml:"scan"`
+	Policies      PoliciesConfig      `yaml:"policies" toml:"policies"`
+	Remediation   RemediationConfig   `yaml:"remediation" toml:"remediation"`
+	Issues        IssuesConfig        `yaml:"issues" toml:"issues"`
+	Notifications NotificationsConfig `yaml:"notifications" toml:"notifications"`
+	Cache         CacheConfig         `yaml:"cache" toml:"cache"`
+	Auth          AuthConfig          `yaml:"auth" toml:"auth"`
+	Log           LoggingConfig       `yaml:"log" toml:"log"`
+	Gateway       GatewayConfig       `yaml:"gateway" toml:"gateway"`
+	Metrics       MetricsConfig       `yaml:"metrics" toml:"metrics"`
+	Tracing       TracingConfig       `yaml:"tracing" toml:"tracing"`
+	GitHub        GitHubConfig        `yaml:"github" toml:"github"`
+}
+
+type ServerConfig struct {
+	// host:port, :port, or unix:///path/to/socket
+	Listen string          `yaml:"listen" toml:"listen"`
+	TLS    ServerTLSConfig `yaml:"tls" toml:"tls"`
+	// how long in-flight scans may run after SIGTERM before they are cancelled
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type ScanConfig struct {
+	// repositories fetched in parallel by the REST backend
+	Concurrency int `yaml:"concurrency" toml:"concurrency"`
+	// backend used when a request doesn't pick one
+	Backend string `yaml:"backend" toml:"backend"`
+	// recent scan results kept for GetScan
+	History int `yaml:"history" toml:"history"`
+}
+
+type PoliciesConfig struct {
+	// OPA bundles, as directories or .tar.gz files, that scans can reference by name
+	Bundles []string `yaml:"bundles" toml:"bundles"`
+	// directory of the policy registry, empty to disable CreatePolicy & co.
+	Registry string `yaml:"registry" toml:"registry"`
+	// JSON file of the waivers, empty to disable CreateWaiver & co.
+	Waivers string `yaml:"waivers" toml:"waivers"`
+}
+
+type RemediationConfig struct {
+	// JSON lines file recording every change Remediate applies, empty to
+	// allow dry runs only
+	AuditLog string `yaml:"audit_log" toml:"audit_log"`
+}
+
+type IssuesConfig struct {
+	// open an issue for each repository a scan finds in violation, and
+	// close it once the repository complies
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// owner/name of a central tracking repository; empty to open the issues
+	// in the violating repositories
+	Repository string `yaml:"repository" toml:"repository"`
+	// added to every issue, besides the policy-violation and fingerprint labels
+	Labels []string `yaml:"labels" toml:"labels"`
+}
+
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks" toml:"webhooks"`
+	// delivery attempts of a notification before it is dropped
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// wait before the first retry, doubled after each
+	Backoff Duration `yaml:"backoff" toml:"backoff"`
+	// longest wait between attempts, including the Retry-After of a response
+	MaxBackoff Duration `yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// WebhookConfig is a destination of notifications. The filters select the
+// scans and violations it is notified of; empty filters select all.
+type WebhookConfig struct {
+	Name string `yaml:"name" toml:"name"`
+	URL  string `yaml:"url" toml:"url"`
+	// json, slack or teams
+	Format string `yaml:"format" toml:"format"`
+	// HMAC-SHA256 key signing the payloads; prefer SCANNER_WEBHOOK_<NAME>_SECRET
+	Secret string `yaml:"secret" toml:"secret"`
+	// scan_completed and/or decision_changed
+	Events      []string `yaml:"events" toml:"events"`
+	Policies    []string `yaml:"policies" toml:"policies"` // globs of policy names
+	Orgs        []string `yaml:"orgs" toml:"orgs"`
+	MinSeverity string   `yaml:"min_severity" toml:"min_severity"`
+}
+
+type CacheConfig struct {
+	// reuse fetched repository data across scans of the same org
+	Enabled bool     `yaml:"enabled" toml:"enabled"`
+	TTL     Duration `yaml:"ttl" toml:"ttl"`
+}
+
+type LoggingConfig struct {
+	// debug, info, warn or error
+	Level string `yaml:"level" toml:"level"`
+	// "json" or "text"
+	Format string `yaml:"format" toml:"format"`
+}
+
+type GatewayConfig struct {
+	// address of the HTTP/JSON gateway, empty to disable
+	Listen string `yaml:"listen" toml:"listen"`
+}
+
+type MetricsConfig struct {
+	// address of the Prometheus /metrics endpoint, empty to disable
+	Listen string `yaml:"listen" toml:"listen"`
+}
+
+type TracingConfig struct {
+	// "otlp", "file", or empty to disable exporting
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// OTLP/gRPC collector address; OTEL_EXPORTER_OTLP_ENDPOINT is used when empty
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	Insecure bool   `yaml:"insecure" toml:"insecure"`
+	// file receiving JSON spans with the file exporter
+	File        string  `yaml:"file" toml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+}
+
+type GitHubConfig struct {
+	Endpoints []GitHubEndpoint `yaml:"endpoints" toml:"endpoints"`
+	// secret of the GitHub webhooks delivering events to the gateway's
+	// /webhooks/github, empty to disable the receiver
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret"`
+	// address serving /webhooks/github alone, without client certificates,
+	// for servers requiring them
+	WebhookListen string `yaml:"webhook_listen" toml:"webhook_listen"`
+}
+
+// Duration reads and prints durations as strings like "5m" in both YAML and TOML
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Server:        ServerConfig{Listen: ":50051", ShutdownTimeout: Duration{30 * time.Second}},
+		Scan:          ScanConfig{Concurrency: 4, Backend: BackendREST, History: 100},
+		Cache:         CacheConfig{Enabled: false, TTL: Duration{5 * time.Minute}},
+		Notifications: NotificationsConfig{MaxAttempts: 4, Backoff: Duration{time.Second}, MaxBackoff: Duration{time.Minute}},
+		Log:           LoggingConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+			ServiceName: "github-scanner",
+		},
+	}
+}
+
+// LoadConfig builds the configuration from the config file, the environment
+// and the command line. printOnly is set when --print-config was given.
+func LoadConfig(args []string) (cfg *Config, printOnly bool, err error) {
+	fs := flag.NewFlagSet("github-scanner", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("SCANNER_CONFIG"), "path to a YAML or TOML config file")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
+	listen := fs.String("listen", "", "listen address (host:port or unix:///path)")
+	org := fs.String("org", "", "default organization to scan")
+	concurrency := fs.Int("concurrency", 0, "repositories fetched in parallel")
+	backend := fs.String("backend", "", "default fetch backend (rest or graphql)")
+	cacheTTL := fs.Duration("cache-ttl", 0, "enable the repository cache with this TTL")
+	metricsListen := fs.String("metrics-listen", "", "address of the Prometheus /metrics endpoint")
+	gatewayListen := fs.String("gateway-listen", "", "address of the HTTP/JSON gateway")
+	logLevel := fs.String("log-level", "", "log level (debug, info, warn or error)")
+	tlsCertFile := fs.String("tls-cert-file", "", "PEM certificate served over TLS")
+	tlsKeyFile := fs.String("tls-key-file", "", "PEM key of the TLS certificate")
+	tlsClientCAFile := fs.String("tls-client-ca-file", "", "PEM CA that client certificates must be signed by")
+	authTokensFile := fs.String("auth-tokens-file", "", "JSON list of static bearer tokens")
+	authJWKSFile := fs.String("auth-jwks-file", "", "JWKS verifying OIDC ID tokens")
+	authOIDCIssuer := fs.String("auth-oidc-issuer", "", "required issuer of OIDC ID tokens")
+	authOIDCAudience := fs.String("auth-oidc-audience", "", "required audience of OIDC ID tokens")
+	authPolicyFile := fs.String("auth-policy-file", "", "Rego authorization policy (package authz)")
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	cfg = defaultConfig()
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, false, err
+	}
+
+	// Flags win over everything else
+	if *listen != "" {
+		cfg.Server.Listen = *listen
+	}
+	if *org != "" {
+		cfg.Org = *org
+	}
+	if *concurrency != 0 {
+		cfg.Scan.Concurrency = *concurrency
+	}
+	if *backend != "" {
+		cfg.Scan.Backend = *backend
+	}
+	if *metricsListen != "" {
+		cfg.Metrics.Listen = *metricsListen
+	}
+	if *gatewayListen != "" {
+		cfg.Gateway.Listen = *gatewayListen
+	}
+	if *logLevel != "" {
+		cfg.Log.Level = *logLevel
+	}
+	if *cacheTTL != 0 {
+		cfg.Cache.Enabled = true
+		cfg.Cache.TTL = Duration{*cacheTTL}
+	}
+	for field, value := range map[*string]string{
+		&cfg.Server.TLS.CertFile:     *tlsCertFile,
+		&cfg.Server.TLS.KeyFile:      *tlsKeyFile,
+		&cfg.Server.TLS.ClientCAFile: *tlsClientCAFile,
+		&cfg.Auth.TokensFile:         *authTokensFile,
+		&cfg.Auth.JWKSFile:           *authJWKSFile,
+		&cfg.Auth.OIDCIssuer:         *authOIDCIssuer,
+		&cfg.Auth.OIDCAudience:       *authOIDCAudience,
+		&cfg.Auth.PolicyFile:         *authPolicyFile,
+	} {
+		if value != "" {
+			*field = value
+		}
+	}
+
+	return cfg, *printConfig, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		dec := toml.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	return nil
+}
+
+// overrides settings from the environment (including the .env file)
+func (c *Config) applyEnv() error {
+	setString := func(dst *string, key string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+
+	setString(&c.Org, "ORG_NAME")
+	setString(&c.Server.Listen, "SCANNER_LISTEN")
+	setString(&c.Scan.Backend, "SCANNER_BACKEND")
+	setString(&c.Log.Level, "SCANNER_LOG_LEVEL")
+	setString(&c.Log.Format, "SCANNER_LOG_FORMAT")
+	setString(&c.Gateway.Listen, "SCANNER_GATEWAY_LISTEN")
+	setString(&c.Metrics.Listen, "SCANNER_METRICS_LISTEN")
+	setString(&c.Tracing.Exporter, "SCANNER_TRACING_EXPORTER")
+	setString(&c.Tracing.Endpoint, "SCANNER_TRACING_ENDPOINT")
+	setString(&c.Tracing.File, "SCANNER_TRACING_FILE")
+	setString(&c.Policies.Registry, "SCANNER_POLICY_REGISTRY")
+	setString(&c.Policies.Waivers, "SCANNER_POLICY_WAIVERS")
+	setString(&c.Remediation.AuditLog, "SCANNER_REMEDIATION_AUDIT_LOG")
+	setString(&c.GitHub.WebhookSecret, "GITHUB_WEBHOOK_SECRET")
+	setString(&c.GitHub.WebhookListen, "GITHUB_WEBHOOK_LISTEN")
+	if v := os.Getenv("SCANNER_ISSUES"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("SCANNER_ISSUES: %w", err)
+		}
+		c.Issues.Enabled = enabled
+	}
+	setString(&c.Issues.Repository, "SCANNER_ISSUES_REPOSITORY")
+	for i := range c.Notifications.Webhooks {
+		w := &c.Notifications.Webhooks[i]
+		setString(&w.Secret, "SCANNER_WEBHOOK_"+envName(w.Name)+"_SECRET")
+	}
+	if v := os.Getenv("SCANNER_POLICY_BUNDLES"); v != "" {
+		c.Policies.Bundles = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SCANNER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("SCANNER_CONCURRENCY: %w", err)
+		}
+		c.Scan.Concurrency = n
+	}
+	if v := os.Getenv("SCANNER_SHUTDOWN_TIMEOUT"); v != "" {
+		if err := c.Server.ShutdownTimeout.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("SCANNER_SHUTDOWN_TIMEOUT: %w", err)
+		}
+	}
+	if v := os.Getenv("SCANNER_CACHE_TTL"); v != "" {
+		if err := c.Cache.TTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("SCANNER_CACHE_TTL: %w", err)
+		}
+		c.Cache.Enabled = true
+	}
+
+	setString(&c.Server.TLS.CertFile, "GRPC_TLS_CERT_FILE")
+	setString(&c.Server.TLS.KeyFile, "GRPC_TLS_KEY_FILE")
+	setString(&c.Server.TLS.ClientCAFile, "GRPC_TLS_CLIENT_CA_FILE")
+
+	setString(&c.Auth.TokensFile, "AUTH_TOKENS_FILE")
+	setString(&c.Auth.JWKSFile, "AUTH_JWKS_FILE")
+	setString(&c.Auth.OIDCIssuer, "AUTH_OIDC_ISSUER")
+	setString(&c.Auth.OIDCAudience, "AUTH_OIDC_AUDIENCE")
+	setString(&c.Auth.PolicyFile, "AUTH_POLICY_FILE")
+
+	for _, env := range loadGitHubEndpointsFromEnv() {
+		c.GitHub.mergeEndpoint(env)
+	}
+	return nil
+}
+
+// merges an endpoint defined in the environment into the one of the same name from the file
+func (g *GitHubConfig) mergeEndpoint(env GitHubEndpoint) {
+	for i := range g.Endpoints {
+		e := &g.Endpoints[i]
+		if e.Name != env.Name {
+			continue
+		}
+		for _, f := range []struct {
+			dst *string
+			src string
+		}{
+			{&e.Token, env.Token},
+			{&e.BaseURL, env.BaseURL},
+			{&e.UploadURL, env.UploadURL},
+			{&e.CAFile, env.CAFile},
+			{&e.ProxyURL, env.ProxyURL},
+		} {
+			if f.src != "" {
+				*f.dst = f.src
+			}
+		}
+		if len(env.Orgs) > 0 {
+			e.Orgs = env.Orgs
+		}
+		return
+	}
+	g.Endpoints = append(g.Endpoints, env)
+}
+
+// Validate reports every problem with the configuration at once
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Org == "" {
+		add("org is required (set org in the config file, ORG_NAME or --org)")
+	}
+
+	if _, _, err := listenNetwork(c.Server.Listen); err != nil {
+		add("server.listen: %v", err)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		add("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log.format must be %q or %q, got %q", "json", "text", c.Log.Format)
+	}
+	if c.Gateway.Listen != "" && !strings.Contains(c.Gateway.Listen, ":") {
+		add("gateway.listen: %q is not a host:port address", c.Gateway.Listen)
+	}
+	if c.Metrics.Listen != "" && !strings.Contains(c.Metrics.Listen, ":") {
+		add("metrics.listen: %q is not a host:port address", c.Metrics.Listen)
+	}
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterOTLP:
+	case TracingExporterFile:
+		if c.Tracing.File == "" {
+			add("tracing.file is required with the file exporter")
+		}
+	default:
+		add("tracing.exporter must be %q, %q or empty, got %q", TracingExporterOTLP, TracingExporterFile, c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		add("server.shutdown_timeout must be positive")
+	}
+
+	if c.Scan.Concurrency < 1 {
+		add("scan.concurrency must be at least 1, got %d", c.Scan.Concurrency)
+	}
+	if c.Scan.History < 1 {
+		add("scan.history must be at least 1, got %d", c.Scan.History)
+	}
+	switch c.Scan.Backend {
+	case BackendREST, BackendGraphQL:
+	default:
+		add("scan.backend must be %q or %q, got %q", BackendREST, BackendGraphQL, c.Scan.Backend)
+	}
+	for i, path := range c.Policies.Bundles {
+		if _, err := os.Stat(path); err != nil {
+			add("policies.bundles[%d]: %v", i, err)
+		}
+	}
+	if c.Issues.Repository != "" && strings.Count(c.Issues.Repository, "/") != 1 {
+		add("issues.repository must be owner/name, got %q", c.Issues.Repository)
+	}
+	c.Notifications.validate(add)
+	if c.Cache.Enabled && c.Cache.TTL.Duration <= 0 {
+		add("cache.ttl must be positive when the cache is enabled")
+	}
+
+	tls := c.Server.TLS
+	if tls.Enabled() && (tls.CertFile == "" || tls.KeyFile == "") {
+		add("server.tls: cert_file and key_file must be set together")
+	}
+	if tls.ClientCAFile != "" && !tls.Enabled() {
+		add("server.tls.client_ca_file requires cert_file and key_file")
+	}
+	for _, f := range []struct{ name, path string }{
+		{"server.tls.cert_file", tls.CertFile},
+		{"server.tls.key_file", tls.KeyFile},
+		{"server.tls.client_ca_file", tls.ClientCAFile},
+		{"auth.tokens_file", c.Auth.TokensFile},
+		{"auth.jwks_file", c.Auth.JWKSFile},
+		{"auth.policy_file", c.Auth.PolicyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			add("%s: %v", f.name, err)
+		}
+	}
+	if (c.Auth.OIDCIssuer != "" || c.Auth.OIDCAudience != "") && c.Auth.JWKSFile == "" {
+		add("auth.oidc_issuer and auth.oidc_audience require auth.jwks_file")
+	}
+
+	if c.GitHub.WebhookListen != "" && c.GitHub.WebhookSecret == "" {
+		add("github.webhook_listen requires github.webhook_secret")
+	}
+	if c.GitHub.WebhookSecret != "" && c.GitHub.WebhookListen == "" {
+		if c.Gateway.Listen == "" {
+			add("github.webhook_secret requires gateway.listen or github.webhook_listen, which serve the webhook receiver")
+		} else if tls.ClientCAFile != "" {
+			add("github.webhook_secret requires github.webhook_listen when server.tls.client_ca_file is set, as GitHub can't present a client certificate to the gateway")
+		}
+	}
+	if len(c.GitHub.Endpoints) == 0 {
+		add("at least one GitHub endpoint is required (set GITHUB_TOKEN or github.endpoints)")
+	}
+	seen := make(map[string]bool)
+	for i, e := range c.GitHub.Endpoints {
+		prefix := fmt.Sprintf("github.endpoints[%d]", i)
+		if e.Name == "" {
+			add("%s: name is required", prefix)
+		} else if seen[e.Name] {
+			add("%s: duplicate endpoint name %q", prefix, e.Name)
+		}
+		seen[e.Name] = true
+		if e.Token == "" {
+			add("%s (%s): token is required", prefix, e.Name)
+		}
+		for _, u := range []struct{ name, value string }{
+			{"api_url", e.BaseURL}, {"upload_url", e.UploadURL}, {"proxy", e.ProxyURL},
+		} {
+			if u.value == "" {
+				continue
+			}
+			if parsed, err := url.Parse(u.value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				add("%s (%s): %s must be an absolute URL, got %q", prefix, e.Name, u.name, u.value)
+			}
+		}
+		if e.CAFile != "" {
+			if _, err := os.Stat(e.CAFile); err != nil {
+				add("%s (%s): ca_file: %v", prefix, e.Name, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// listenNetwork splits the listen setting into the arguments of net.Listen
+func listenNetwork(listen string) (network, address string, err error) {
+	if path, ok := strings.CutPrefix(listen, "unix://"); ok {
+		if path == "" {
+			return "", "", fmt.Errorf("unix socket path is empty")
+		}
+		return "unix", path, nil
+	}
+	if listen == "" {
+		return "", "", fmt.Errorf("listen address is empty")
+	}
+	if !strings.Contains(listen, ":") {
+		return "", "", fmt.Errorf("%q is not a host:port address", listen)
+	}
+	return "tcp", listen, nil
+}
+
+// Print writes the effective configuration as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	redacted.GitHub.Endpoints = make([]GitHubEndpoint, len(c.GitHub.Endpoints))
+	for i, e := range c.GitHub.Endpoints {
+		if e.Token != "" {
+			e.Token = "REDACTED"
+		}
+		redacted.GitHub.Endpoints[i] = e
+	}
+	if c.GitHub.WebhookSecret != "" {
+		redacted.GitHub.WebhookSecret = "REDACTED"
+	}
+	// incoming webhook URLs are secrets too
+	redacted.Notifications.Webhooks = make([]WebhookConfig, len(c.Notifications.Webhooks))
+	for i, w := range c.Notifications.Webhooks {
+		if w.Secret != "" {
+			w.Secret = "REDACTED"
+		}
+		if u, err := url.Parse(w.URL); err == nil && (u.Path != "" || u.RawQuery != "") {
+			w.URL = u.Scheme + "://" + u.Host + "/REDACTED"
+		}
+		redacted.Notifications.Webhooks[i] = w
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(&redacted)
+}
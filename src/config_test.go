@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigAuthAndTLSPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`server:
+  tls:
+    cert_file: file.pem
+    key_file: file.key
+auth:
+  tokens_file: file-tokens.json
+  oidc_issuer: https://file.example.com
+  policy_file: file.rego
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GRPC_TLS_KEY_FILE", "env.key")
+	t.Setenv("AUTH_TOKENS_FILE", "env-tokens.json")
+	t.Setenv("AUTH_OIDC_ISSUER", "https://env.example.com")
+
+	cfg, _, err := LoadConfig([]string{
+		"--config", path,
+		"--tls-client-ca-file", "flag-ca.pem",
+		"--auth-tokens-file", "flag-tokens.json",
+		"--auth-jwks-file", "flag-jwks.json",
+		"--auth-oidc-audience", "flag-audience",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ name, got, want string }{
+		{"server.tls.cert_file", cfg.Server.TLS.CertFile, "file.pem"},
+		{"server.tls.key_file", cfg.Server.TLS.KeyFile, "env.key"},
+		{"server.tls.client_ca_file", cfg.Server.TLS.ClientCAFile, "flag-ca.pem"},
+		{"auth.tokens_file", cfg.Auth.TokensFile, "flag-tokens.json"},
+		{"auth.jwks_file", cfg.Auth.JWKSFile, "flag-jwks.json"},
+		{"auth.oidc_issuer", cfg.Auth.OIDCIssuer, "https://env.example.com"},
+		{"auth.oidc_audience", cfg.Auth.OIDCAudience, "flag-audience"},
+		{"auth.policy_file", cfg.Auth.PolicyFile, "file.rego"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// GitHub events that change what policies see of repositories
+var handledEvents = map[string]bool{
+	"repository":             true,
+	"member":                 true,
+	"team":                   true,
+	"team_add":               true,
+	"membership":             true,
+	"branch_protection_rule": true,
+	"public":                 true,
+}
+
+// largest payload GitHub delivers
+const maxEventPayload = 25 << 20
+
+// eventReceiver handles the GitHub webhook deliveries of POST
+// /webhooks/github. It re-scans the repositories an event reports changes
+// to, and updates the latest stored scan of each policy of their
+// organization.
+type eventReceiver struct {
+	secret string
+	server *Server
+
+	mu sync.Mutex
+	// lower-cased org and policy identity -> latest scan
+	latest map[string]trackedScan
+
+	// refreshes run one at a time, so they don't overwrite each other's updates
+	refreshing sync.Mutex
+}
+
+// trackedScan is a stored scan GitHub events keep up to date
+type trackedScan struct {
+	scanID   string
+	org      string
+	endpoint string
+	policy   resolvedPolicy
+}
+
+func newEventReceiver(secret string, server *Server) *eventReceiver {
+	return &eventReceiver{secret: secret, server: server, latest: make(map[string]trackedScan)}
+}
+
+func trackedScanKey(org string, policy resolvedPolicy) string {
+	return strings.ToLower(org) + "\x00" + policyIdentity(policy.name, policy.sha256)
+}
+
+// track makes a scan the one GitHub events update for its org and policy
+func (r *eventReceiver) track(org, endpoint string, policy resolvedPolicy, scanID string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latest[trackedScanKey(org, policy)] = trackedScan{scanID: scanID, org: org, endpoint: endpoint, policy: policy}
+}
+
+// tracked returns the scans tracked for the orgs, by lower-cased org
+func (r *eventReceiver) tracked(orgs map[string]bool) []trackedScan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var scans []trackedScan
+	for _, t := range r.latest {
+		if orgs[strings.ToLower(t.org)] {
+			scans = append(scans, t)
+		}
+	}
+	return scans
+}
+
+// untrack forgets a scan evicted from the scan store
+func (r *eventReceiver) untrack(t trackedScan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := trackedScanKey(t.org, t.policy)
+	if r.latest[key].scanID == t.scanID {
+		delete(r.latest, key)
+	}
+}
+
+// repoChange is what an event changed in an organization
+type repoChange struct {
+	org string
+	// names of the repositories to re-scan
+	repos []string
+	// slugs of the teams whose repositories are re-scanned
+	teams []string
+	// full names of deleted repositories, and of the former names of
+	// renamed and transferred ones
+	removed []string
+}
+
+func repositoryChange(repo *github.Repository) repoChange {
+	return repoChange{org: repo.GetOwner().GetLogin(), repos: []string{repo.GetName()}}
+}
+
+// eventChange returns the change a parsed event reports, false for events
+// that don't change repositories
+func eventChange(event interface{}) (repoChange, bool) {
+	var change repoChange
+	switch e := event.(type) {
+	case *github.RepositoryEvent:
+		change = repositoryChange(e.GetRepo())
+		switch e.GetAction() {
+		case "deleted":
+			change.repos = nil
+			change.removed = []string{e.GetRepo().GetFullName()}
+		case "renamed":
+			if from := e.GetChanges().GetRepo().GetName().GetFrom(); from != "" {
+				change.removed = []string{change.org + "/" + from}
+			}
+		case "transferred":
+			from := e.GetChanges().GetOwner().GetOwnerInfo()
+			if owner := cmp.Or(from.GetOrg().GetLogin(), from.GetUser().GetLogin()); owner != "" {
+				change.removed = []string{owner + "/" + e.GetRepo().GetName()}
+			}
+		}
+	case *github.MemberEvent:
+		change = repositoryChange(e.GetRepo())
+	case *github.TeamAddEvent:
+		change = repositoryChange(e.GetRepo())
+	case *github.BranchProtectionRuleEvent:
+		change = repositoryChange(e.GetRepo())
+	case *github.PublicEvent:
+		change = repositoryChange(e.GetRepo())
+	case *github.TeamEvent:
+		// added_to_repository, removed_from_repository and permission edits
+		// name the repository; other changes affect all the team's
+		if e.GetRepo() != nil {
+			change = repositoryChange(e.GetRepo())
+		} else {
+			change = repoChange{org: e.GetOrg().GetLogin(), teams: []string{e.GetTeam().GetSlug()}}
+		}
+	case *github.MembershipEvent:
+		change = repoChange{org: e.GetOrg().GetLogin(), teams: []string{e.GetTeam().GetSlug()}}
+	default:
+		return change, false
+	}
+	return change, change.org != "" && (len(change.repos) > 0 || len(change.teams) > 0 || len(change.removed) > 0)
+}
+
+// ServeHTTP validates a delivery by its X-Hub-Signature-256 and re-scans the
+// repositories it changed in the background
+func (r *eventReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	event := req.Header.Get("X-GitHub-Event")
+	label := event
+	if !handledEvents[event] {
+		label = "other"
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxEventPayload))
+	if err != nil {
+		githubEvents.WithLabelValues(label, "invalid_payload").Inc()
+		http.Error(w, "unreadable payload", http.StatusBadRequest)
+		return
+	}
+	if !hmac.Equal([]byte(req.Header.Get("X-Hub-Signature-256")), []byte(signPayload(r.secret, body))) {
+		githubEvents.WithLabelValues(label, "invalid_signature").Inc()
+		slog.WarnContext(req.Context(), "Rejected a GitHub event with an invalid signature", "remote_addr", req.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := withLogAttrs(context.WithoutCancel(req.Context()), "github_event", event, "github_delivery", req.Header.Get("X-GitHub-Delivery"))
+	if !handledEvents[event] {
+		githubEvents.WithLabelValues(label, "ignored").Inc()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	payload, err := github.ParseWebHook(event, body)
+	if err != nil {
+		githubEvents.WithLabelValues(label, "invalid_payload").Inc()
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	change, ok := eventChange(payload)
+	if !ok {
+		githubEvents.WithLabelValues(label, "ignored").Inc()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !r.server.beginScan() {
+		githubEvents.WithLabelValues(label, "unavailable").Inc()
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	githubEvents.WithLabelValues(label, "accepted").Inc()
+	slog.InfoContext(ctx, "Received a GitHub event", "org", change.org, "repos", change.repos, "teams", change.teams, "removed", change.removed)
+	go func() {
+		defer r.server.inflight.Done()
+		r.refresh(ctx, change)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// refetched is the repositories of a change fetched from one endpoint
+type refetched struct {
+	repos   []RepositoryInfo
+	missing []string // full names of repositories that no longer exist
+	err     error
+}
+
+// refresh re-scans the repositories of a change and updates the tracked
+// scans of their organization
+func (r *eventReceiver) refresh(ctx context.Context, change repoChange) {
+	r.refreshing.Lock()
+	defer r.refreshing.Unlock()
+	s := r.server
+
+	orgs := map[string]bool{strings.ToLower(change.org): true}
+	for _, name := range change.removed {
+		owner, _, _ := strings.Cut(name, "/")
+		orgs[strings.ToLower(owner)] = true
+	}
+	for org := range orgs {
+		s.scanner.cache.invalidate(org)
+	}
+
+	var targets []trackedScan
+	var stored []*pb.PolicyResponse
+	for _, t := range r.tracked(orgs) {
+		resp, _, ok := s.scans.get(t.scanID)
+		if !ok {
+			r.untrack(t)
+			continue
+		}
+		targets = append(targets, t)
+		stored = append(stored, resp)
+	}
+	if len(targets) == 0 {
+		slog.InfoContext(ctx, "No stored scan of the organization to update", "org", change.org)
+		return
+	}
+
+	// the repositories the teams had access to at the last scans
+	names := append([]string(nil), change.repos...)
+	for _, slug := range change.teams {
+		for _, resp := range stored {
+			for _, repo := range resp.GetRepositories() {
+				if strings.EqualFold(repo.GetOwner(), change.org) && slices.ContainsFunc(repo.GetPermissions(), func(p *pb.RepositoryPermissions) bool {
+					return p.GetSource() == "team:"+slug
+				}) {
+					names = append(names, repo.GetName())
+				}
+			}
+		}
+	}
+
+	fetched := make(map[string]*refetched)
+	for i, t := range targets {
+		resp := stored[i]
+		removed := make(map[string]bool)
+		for _, name := range change.removed {
+			removed[strings.ToLower(name)] = true
+		}
+		partial := &pb.PolicyResponse{ScanId: t.scanID}
+		if strings.EqualFold(t.org, change.org) {
+			endpoint, err := resolveEndpoint(t.endpoint, t.org)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to update a stored scan", "scan_id", t.scanID, "error", err)
+				continue
+			}
+			f, ok := fetched[endpoint.Name]
+			if !ok {
+				f = r.fetch(ctx, endpoint, change, names)
+				fetched[endpoint.Name] = f
+			}
+			if f.err != nil {
+				slog.WarnContext(ctx, "Failed to update a stored scan", "scan_id", t.scanID, "error", f.err)
+				continue
+			}
+			for _, name := range f.missing {
+				removed[strings.ToLower(name)] = true
+			}
+			evaluated, err := s.scanner.EvaluateRepositories(ctx, t.policy.Policy, f.repos)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to update a stored scan", "scan_id", t.scanID, "error", err)
+				continue
+			}
+			partial.Repositories = repositoriesToProto(evaluated)
+			t.policy.stamp(partial)
+			s.applyWaivers(ctx, t.policy, partial)
+			if s.issues != nil {
+				partial.Issues = s.issues.sync(ctx, t.endpoint, t.policy.name, partial)
+			}
+		}
+
+		mergeRefresh(resp, partial, removed)
+		resp.Score = export.Score(resp.GetRepositories())
+		if t.policy.shadow != nil {
+			resp.Shadow = s.evaluateShadow(ctx, *t.policy.shadow, resp.GetRepositories())
+		}
+		resp.RefreshedAt = time.Now().UTC().Format(time.RFC3339)
+		s.notifier.notifyChanges(ctx, t.org, resp)
+		s.scans.put(resp, scanOrigin{org: t.org, fetched: true})
+		slog.InfoContext(ctx, "Updated a stored scan", "scan_id", t.scanID, "policy", t.policy.name,
+			"rescanned", len(partial.GetRepositories()), "removed", len(removed))
+	}
+}
+
+// fetch fetches the named repositories of the change's org, and those the
+// change's teams have access to
+func (r *eventReceiver) fetch(ctx context.Context, endpoint GitHubEndpoint, change repoChange, names []string) *refetched {
+	client, err := getGitHubClient(endpoint)
+	if err != nil {
+		return &refetched{err: err}
+	}
+	org := change.org
+	for _, slug := range change.teams {
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			repos, resp, err := client.Teams.ListTeamReposBySlug(ctx, org, slug, opts)
+			var errResp *github.ErrorResponse
+			if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+				// a deleted team: only the repositories it had access to change
+				break
+			}
+			if err != nil {
+				return &refetched{err: err}
+			}
+			for _, repo := range repos {
+				if strings.EqualFold(repo.GetOwner().GetLogin(), org) {
+					names = append(names, repo.GetName())
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	f := &refetched{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		fullName := org + "/" + name
+		repo, resp, err := client.Repositories.Get(ctx, org, name)
+		switch {
+		case resp != nil && resp.StatusCode == http.StatusNotFound:
+			f.missing = append(f.missing, fullName)
+		case err != nil:
+			slog.WarnContext(ctx, "Failed to fetch repository", "repo", fullName, "error", err)
+			f.repos = append(f.repos, RepositoryInfo{Name: name, FullName: fullName, Owner: org, FetchError: err.Error()})
+		default:
+			f.repos = append(f.repos, describeRepository(ctx, org, repo, client))
+		}
+	}
+	reposProcessed.WithLabelValues("fetch").Add(float64(len(f.repos)))
+	return f
+}
+
+// mergeRefresh replaces the results of re-scanned repositories in a stored
+// scan, adds those of new repositories and drops those of removed ones
+func mergeRefresh(stored, partial *pb.PolicyResponse, removed map[string]bool) {
+	rescanned := make(map[string]*pb.RepositoryInfo)
+	for _, repo := range partial.GetRepositories() {
+		rescanned[strings.ToLower(repo.GetFullName())] = repo
+	}
+	replaced := func(fullName string) bool {
+		name := strings.ToLower(fullName)
+		return removed[name] || rescanned[name] != nil
+	}
+
+	var repos []*pb.RepositoryInfo
+	for _, repo := range stored.GetRepositories() {
+		name := strings.ToLower(repo.GetFullName())
+		if fresh, ok := rescanned[name]; ok {
+			repos = append(repos, fresh)
+			delete(rescanned, name)
+		} else if !removed[name] {
+			repos = append(repos, repo)
+		}
+	}
+	for _, repo := range partial.GetRepositories() {
+		if rescanned[strings.ToLower(repo.GetFullName())] != nil {
+			repos = append(repos, repo)
+		}
+	}
+	stored.Repositories = repos
+
+	waiverRepo := func(w *pb.Waiver) bool { return replaced(w.GetRepository()) }
+	stored.Waivers = append(slices.DeleteFunc(stored.Waivers, waiverRepo), partial.GetWaivers()...)
+	stored.ExpiredWaivers = append(slices.DeleteFunc(stored.ExpiredWaivers, waiverRepo), partial.GetExpiredWaivers()...)
+	stored.Issues = append(slices.DeleteFunc(stored.Issues, func(i *pb.TrackedIssue) bool { return replaced(i.GetRepository()) }), partial.GetIssues()...)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrackedScansOfUnnamedPolicies(t *testing.T) {
+	r := newEventReceiver("secret", nil)
+	r.track("acme", "", resolvedPolicy{sha256: "aaa"}, "scan-1")
+	r.track("acme", "", resolvedPolicy{sha256: "bbb"}, "scan-2")
+	r.track("acme", "", resolvedPolicy{name: "visibility", sha256: "aaa"}, "scan-3")
+
+	scans := r.tracked(map[string]bool{"acme": true})
+	if len(scans) != 3 {
+		t.Fatalf("tracking %d scans, want 3", len(scans))
+	}
+	r.untrack(trackedScan{scanID: "scan-1", org: "acme", policy: resolvedPolicy{sha256: "aaa"}})
+	for _, s := range r.tracked(map[string]bool{"acme": true}) {
+		if s.scanID == "scan-1" {
+			t.Error("scan-1 is still tracked")
+		}
+	}
+	if got := len(r.tracked(map[string]bool{"acme": true})); got != 2 {
+		t.Errorf("tracking %d scans after untracking one, want 2", got)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key, and returns their paths
+func writeTestCertificate(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "scanner"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestWebhookServerAcceptsClientsWithoutCertificates(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	reloader, err := newCertReloader(ServerTLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := lis.Addr().String()
+	lis.Close()
+
+	srv, err := startWebhookServer(address, newEventReceiver("secret", nil), reloader.PublicTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	pemCert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pemCert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	body := []byte(`{"zen": "Keep it logically awesome."}`)
+	req, err := http.NewRequest(http.MethodPost, "https://"+address+"/webhooks/github", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-GitHub-Event", "ping")
+	req.Header.Set("X-Hub-Signature-256", signPayload("secret", body))
+
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err = client.Do(req)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+		req.Body, _ = req.GetBody()
+	}
+	if err != nil {
+		t.Fatalf("GitHub couldn't deliver an event without a client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status %d, want 204 for an event that changes no repository", resp.StatusCode)
+	}
+}
@@ -0,0 +1,136 @@
+// Package export renders scan results in report formats understood by
+// other tools, for both the server (ExportScans) and scanner-cli.
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	pb "github-scanner/src/pb"
+)
+
+// ToolName identifies the scanner in generated reports
+const ToolName = "github-scanner"
+
+// Format renders a set of scans, one per policy
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Write       func(w io.Writer, scans []*pb.PolicyResponse, opts Options) error
+}
+
+// Options tune a report; formats ignore the options they have no use for
+type Options struct {
+	// earlier scans of the same policies, for the formats showing what changed
+	Previous []*pb.PolicyResponse
+}
+
+var formats = map[string]Format{}
+
+func register(f Format) {
+	formats[f.Name] = f
+}
+
+// Lookup returns the named format
+func Lookup(name string) (Format, error) {
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown export format %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return f, nil
+}
+
+// Names lists the registered formats
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Outcomes of a repository, derived from its scan_result
+const (
+	OutcomePass    = "pass"
+	OutcomeFail    = "fail"
+	OutcomeError   = "error"
+	OutcomeSkipped = "skipped"
+	OutcomeWaived  = "waived"
+)
+
+// Special scan_result values. Skipped marks repositories a client filtered
+// out of a report, Waived failures a waiver covers; fetch errors are
+// prefixed so they can be told apart from evaluation errors.
+const (
+	ResultSkipped    = "Skipped"
+	ResultWaived     = "Waived"
+	FetchErrorPrefix = "Fetch Error: "
+)
+
+// Outcome classifies a repository's scan_result
+func Outcome(repo *pb.RepositoryInfo) string {
+	switch strings.ToLower(repo.GetScanResult()) {
+	case "success":
+		return OutcomePass
+	case "failure":
+		return OutcomeFail
+	case "skipped":
+		return OutcomeSkipped
+	case "waived":
+		return OutcomeWaived
+	default:
+		return OutcomeError
+	}
+}
+
+// IsFetchError reports whether a repository failed before evaluation
+func IsFetchError(repo *pb.RepositoryInfo) bool {
+	return strings.HasPrefix(repo.GetScanResult(), FetchErrorPrefix)
+}
+
+// Waivers returns the waivers of the scan that cover the repository
+func Waivers(scan *pb.PolicyResponse, repo *pb.RepositoryInfo) []*pb.Waiver {
+	var waivers []*pb.Waiver
+	for _, id := range repo.GetWaiverIds() {
+		for _, w := range scan.GetWaivers() {
+			if w.GetWaiverId() == id {
+				waivers = append(waivers, w)
+			}
+		}
+	}
+	return waivers
+}
+
+// WaiverSummary describes waivers in one line, e.g. for report messages
+func WaiverSummary(waivers []*pb.Waiver) string {
+	var parts []string
+	for _, w := range waivers {
+		scope := ""
+		if w.GetUser() != "" {
+			scope = " for " + w.GetUser()
+		}
+		parts = append(parts, fmt.Sprintf("waived%s until %s, approved by %s: %s", scope, w.GetExpiresAt(), w.GetApprover(), w.GetJustification()))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Violations returns the messages explaining a repository's failure, or a
+// single generic one when the policy has no violations rule
+func Violations(repo *pb.RepositoryInfo, policy string) []string {
+	if len(repo.GetViolations()) > 0 {
+		return repo.GetViolations()
+	}
+	return []string{fmt.Sprintf("Repository %s violates policy %s (%s severity)", repo.GetFullName(), policy, repo.GetSeverity())}
+}
+
+// PolicyName names a scan's policy, falling back to its scan ID
+func PolicyName(scan *pb.PolicyResponse) string {
+	if scan.GetPolicyName() != "" {
+		return scan.GetPolicyName()
+	}
+	return "scan-" + scan.GetScanId()
+}
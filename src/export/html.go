@@ -0,0 +1,278 @@
+package export
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	pb "github-scanner/src/pb"
+)
+
+//go:embed report.html
+var reportTemplate string
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": percent,
+}).Parse(reportTemplate))
+
+func init() {
+	register(Format{Name: "html", ContentType: "text/html; charset=utf-8", Extension: ".html", Write: WriteHTML})
+}
+
+// data of the HTML report
+type htmlReport struct {
+	Tool      string
+	Generated string
+	Summary   htmlCounts
+	// severity-weighted compliance score of every scan, see ComplianceScore
+	Score        float64
+	Policies     []htmlPolicy
+	Repositories []*htmlRepository
+	Diffs        []htmlDiff
+	// waivers that lapsed, which no longer cover their repository
+	ExpiredWaivers []*pb.Waiver
+}
+
+type htmlCounts struct {
+	Total, Pass, Fail, Error, Skipped, Waived int
+}
+
+func (c *htmlCounts) add(outcome string) {
+	c.Total++
+	switch outcome {
+	case OutcomePass:
+		c.Pass++
+	case OutcomeFail:
+		c.Fail++
+	case OutcomeSkipped:
+		c.Skipped++
+	case OutcomeWaived:
+		c.Waived++
+	default:
+		c.Error++
+	}
+}
+
+// Evaluated excludes the repositories skipped by filters
+func (c htmlCounts) Evaluated() int {
+	return c.Total - c.Skipped
+}
+
+// Segments lays out the stacked bar of the policy chart, in percent
+func (c htmlCounts) Segments() []htmlSegment {
+	var segments []htmlSegment
+	x := 0.0
+	for _, s := range []htmlSegment{
+		{Outcome: OutcomePass, Count: c.Pass},
+		{Outcome: OutcomeFail, Count: c.Fail},
+		{Outcome: OutcomeWaived, Count: c.Waived},
+		{Outcome: OutcomeError, Count: c.Error},
+		{Outcome: OutcomeSkipped, Count: c.Skipped},
+	} {
+		if s.Count == 0 {
+			continue
+		}
+		s.X, s.Width = x, 100*float64(s.Count)/float64(c.Total)
+		x += s.Width
+		segments = append(segments, s)
+	}
+	return segments
+}
+
+type htmlSegment struct {
+	Outcome  string
+	Count    int
+	X, Width float64
+}
+
+type htmlPolicy struct {
+	Name   string
+	ScanID string
+	Error  string
+	Counts htmlCounts
+}
+
+// htmlRepository gathers the results of a repository across policies
+type htmlRepository struct {
+	FullName    string
+	URL         string
+	Visibility  string
+	Status      string
+	Failed      int
+	Errors      int
+	Waived      int
+	Risk        int
+	Permissions []*pb.RepositoryPermissions
+	Results     []htmlResult
+}
+
+type htmlResult struct {
+	Policy     string
+	Outcome    string
+	Message    string
+	Violations []string
+}
+
+type htmlDiff struct {
+	Policy        string
+	OldScanID     string
+	NewScanID     string
+	Changes       []htmlChange
+	NewViolations int
+	Fixed         int
+}
+
+type htmlChange struct {
+	Repository string
+	// empty when the repository is missing from that scan
+	Old, New string
+}
+
+// WriteHTML writes a single-file compliance report with its CSS and
+// JavaScript inlined: per-policy charts, a sortable and filterable table of
+// repositories with their permissions and results, and, when previous scans
+// are given, the repositories whose result changed.
+func WriteHTML(w io.Writer, scans []*pb.PolicyResponse, opts Options) error {
+	report := htmlReport{Tool: ToolName, Generated: time.Now().UTC().Format(time.RFC1123)}
+	repos := make(map[string]*htmlRepository)
+	var risk, evaluated int32
+
+	for _, scan := range scans {
+		policy := htmlPolicy{Name: PolicyName(scan), ScanID: scan.GetScanId(), Error: scan.GetError()}
+		score := Score(scan.GetRepositories())
+		risk += score.GetRiskScore()
+		evaluated += score.GetEvaluated()
+		for _, repo := range scan.GetRepositories() {
+			outcome := Outcome(repo)
+			policy.Counts.add(outcome)
+			report.Summary.add(outcome)
+			if outcome == OutcomeSkipped {
+				continue
+			}
+
+			r, ok := repos[repo.GetFullName()]
+			if !ok {
+				r = &htmlRepository{
+					FullName:    repo.GetFullName(),
+					URL:         repo.GetRepoUrl(),
+					Visibility:  repo.GetVisibility(),
+					Permissions: repo.GetPermissions(),
+				}
+				repos[repo.GetFullName()] = r
+			}
+			result := htmlResult{Policy: policy.Name, Outcome: outcome}
+			switch outcome {
+			case OutcomeFail:
+				result.Message = fmt.Sprintf("%s severity", repo.GetSeverity())
+				result.Violations = Violations(repo, policy.Name)
+				r.Failed++
+				r.Risk += int(RiskScore(repo))
+			case OutcomeError:
+				result.Message = repo.GetScanResult()
+				r.Errors++
+			case OutcomeWaived:
+				result.Message = WaiverSummary(Waivers(scan, repo))
+				result.Violations = repo.GetViolations()
+				r.Waived++
+			}
+			r.Results = append(r.Results, result)
+		}
+		report.Policies = append(report.Policies, policy)
+		report.ExpiredWaivers = append(report.ExpiredWaivers, scan.GetExpiredWaivers()...)
+	}
+
+	report.Score = ComplianceScore(risk, evaluated)
+
+	for _, r := range repos {
+		switch {
+		case r.Failed > 0:
+			r.Status = OutcomeFail
+		case r.Errors > 0:
+			r.Status = OutcomeError
+		case r.Waived > 0:
+			r.Status = OutcomeWaived
+		default:
+			r.Status = OutcomePass
+		}
+		report.Repositories = append(report.Repositories, r)
+	}
+	sort.Slice(report.Repositories, func(i, j int) bool {
+		return report.Repositories[i].FullName < report.Repositories[j].FullName
+	})
+
+	report.Diffs = diffPolicies(opts.Previous, scans)
+	return reportHTML.Execute(w, report)
+}
+
+// diffPolicies pairs each scan with the previous scan of the same policy;
+// unnamed scans are paired when there is a single one on each side
+func diffPolicies(previous, scans []*pb.PolicyResponse) []htmlDiff {
+	if len(previous) == 0 {
+		return nil
+	}
+	byPolicy := make(map[string]*pb.PolicyResponse)
+	for _, scan := range previous {
+		byPolicy[PolicyName(scan)] = scan
+	}
+
+	var diffs []htmlDiff
+	for _, scan := range scans {
+		old, ok := byPolicy[PolicyName(scan)]
+		if !ok && len(previous) == 1 && len(scans) == 1 {
+			old, ok = previous[0], true
+		}
+		if ok {
+			diffs = append(diffs, diffScan(PolicyName(scan), old, scan))
+		}
+	}
+	return diffs
+}
+
+func diffScan(policy string, oldScan, newScan *pb.PolicyResponse) htmlDiff {
+	outcomes := func(scan *pb.PolicyResponse) map[string]string {
+		m := make(map[string]string)
+		for _, repo := range scan.GetRepositories() {
+			if outcome := Outcome(repo); outcome != OutcomeSkipped {
+				m[repo.GetFullName()] = outcome
+			}
+		}
+		return m
+	}
+	oldOutcomes, newOutcomes := outcomes(oldScan), outcomes(newScan)
+
+	diff := htmlDiff{Policy: policy, OldScanID: oldScan.GetScanId(), NewScanID: newScan.GetScanId()}
+	names := make(map[string]bool)
+	for name := range oldOutcomes {
+		names[name] = true
+	}
+	for name := range newOutcomes {
+		names[name] = true
+	}
+	for name := range names {
+		oldOutcome, newOutcome := oldOutcomes[name], newOutcomes[name]
+		if oldOutcome == newOutcome {
+			continue
+		}
+		diff.Changes = append(diff.Changes, htmlChange{Repository: name, Old: oldOutcome, New: newOutcome})
+		if newOutcome == OutcomeFail {
+			diff.NewViolations++
+		} else if oldOutcome == OutcomeFail && newOutcome == OutcomePass {
+			diff.Fixed++
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Repository < diff.Changes[j].Repository
+	})
+	return diff
+}
+
+// percent formats part of total, e.g. for the compliance rate
+func percent(part, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*float64(part)/float64(total))
+}
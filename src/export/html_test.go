@@ -0,0 +1,24 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLListsViolations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, sarifTestScans(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+	for _, want := range []string{
+		"<li>default branch allows force pushes</li><li>default branch requires no reviews</li>",
+		"<li>Repository acme/web violates policy branch-protection (low severity)</li>",
+		"<li>default branch is unprotected</li>",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("the report doesn't contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	pb "github-scanner/src/pb"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func init() {
+	register(Format{Name: "csv", ContentType: "text/csv", Extension: ".csv", Write: WriteCSV})
+	register(Format{Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: ".xlsx", Write: WriteXLSX})
+}
+
+// Columns of the access inventory
+var (
+	repositoryColumns = []string{"repository", "owner", "visibility", "private", "default_branch", "last_updated", "url", "description"}
+	permissionColumns = []string{"repository", "visibility", "user", "role", "source"}
+	violationColumns  = []string{"policy", "scan_id", "repository", "visibility", "result", "severity", "message"}
+)
+
+// eachRepository calls fn once per repository of the scans; a repository
+// evaluated by several policies is listed from its first scan
+func eachRepository(scans []*pb.PolicyResponse, fn func(repo *pb.RepositoryInfo) error) error {
+	seen := make(map[string]bool)
+	for _, scan := range scans {
+		for _, repo := range scan.GetRepositories() {
+			if seen[repo.GetFullName()] || Outcome(repo) == OutcomeSkipped {
+				continue
+			}
+			seen[repo.GetFullName()] = true
+			if err := fn(repo); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func repositoryRow(repo *pb.RepositoryInfo) []string {
+	return []string{
+		repo.GetFullName(), repo.GetOwner(), repo.GetVisibility(), strconv.FormatBool(repo.GetPrivate()),
+		repo.GetDefaultBranch(), repo.GetLastUpdated(), repo.GetRepoUrl(), repo.GetDescription(),
+	}
+}
+
+// permissionRows lists who has access to a repository; a repository without
+// collaborators still gets a row, so the inventory covers every repository
+func permissionRows(repo *pb.RepositoryInfo) [][]string {
+	if len(repo.GetPermissions()) == 0 {
+		return [][]string{{repo.GetFullName(), repo.GetVisibility(), "", "", ""}}
+	}
+	rows := make([][]string, 0, len(repo.GetPermissions()))
+	for _, perm := range repo.GetPermissions() {
+		rows = append(rows, []string{repo.GetFullName(), repo.GetVisibility(), perm.GetUsername(), perm.GetRole(), perm.GetSource()})
+	}
+	return rows
+}
+
+// eachViolation calls fn for every failed, waived or errored repository and
+// scan
+func eachViolation(scans []*pb.PolicyResponse, fn func(row []string) error) error {
+	for _, scan := range scans {
+		policy := PolicyName(scan)
+		if scan.GetError() != "" {
+			if err := fn([]string{policy, scan.GetScanId(), "", "", OutcomeError, "", scan.GetError()}); err != nil {
+				return err
+			}
+		}
+		for _, repo := range scan.GetRepositories() {
+			var message string
+			switch Outcome(repo) {
+			case OutcomeFail:
+				message = strings.Join(Violations(repo, policy), "; ")
+			case OutcomeWaived:
+				message = WaiverSummary(Waivers(scan, repo))
+			case OutcomeError:
+				message = repo.GetScanResult()
+			default:
+				continue
+			}
+			if err := fn([]string{policy, scan.GetScanId(), repo.GetFullName(), repo.GetVisibility(), Outcome(repo), repo.GetSeverity(), message}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the access inventory as "repository, visibility, user,
+// role, source" rows, one per permission
+func WriteCSV(w io.Writer, scans []*pb.PolicyResponse, _ Options) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(permissionColumns); err != nil {
+		return err
+	}
+	err := eachRepository(scans, func(repo *pb.RepositoryInfo) error {
+		return cw.WriteAll(permissionRows(repo))
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteXLSX writes a workbook with a Repositories, a Permissions and a
+// Violations sheet. Sheets are written with excelize's stream writer, which
+// keeps memory flat for large organizations.
+func WriteXLSX(w io.Writer, scans []*pb.PolicyResponse, _ Options) (err error) {
+	f := excelize.NewFile()
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	sheets := []struct {
+		name    string
+		columns []string
+		rows    func(add func(row []string) error) error
+	}{
+		{"Repositories", repositoryColumns, func(add func([]string) error) error {
+			return eachRepository(scans, func(repo *pb.RepositoryInfo) error { return add(repositoryRow(repo)) })
+		}},
+		{"Permissions", permissionColumns, func(add func([]string) error) error {
+			return eachRepository(scans, func(repo *pb.RepositoryInfo) error {
+				for _, row := range permissionRows(repo) {
+					if err := add(row); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}},
+		{"Violations", violationColumns, func(add func([]string) error) error {
+			return eachViolation(scans, add)
+		}},
+	}
+
+	for i, sheet := range sheets {
+		if i == 0 {
+			err = f.SetSheetName(f.GetSheetName(0), sheet.name)
+		} else {
+			_, err = f.NewSheet(sheet.name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeSheet(f, sheet.name, sheet.columns, header, sheet.rows); err != nil {
+			return fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+	}
+	f.SetActiveSheet(0)
+	return f.Write(w)
+}
+
+func writeSheet(f *excelize.File, name string, columns []string, headerStyle int, rows func(add func(row []string) error) error) error {
+	sw, err := f.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return err
+	}
+
+	cells := make([]interface{}, len(columns))
+	for i, column := range columns {
+		cells[i] = excelize.Cell{StyleID: headerStyle, Value: column}
+	}
+	if err := sw.SetRow("A1", cells); err != nil {
+		return err
+	}
+
+	rowNum := 2
+	err = rows(func(row []string) error {
+		values := make([]interface{}, len(row))
+		for i, v := range row {
+			values[i] = v
+		}
+		cell, err := excelize.CoordinatesToCellName(1, rowNum)
+		if err != nil {
+			return err
+		}
+		rowNum++
+		return sw.SetRow(cell, values)
+	})
+	if err != nil {
+		return err
+	}
+	return sw.Flush()
+}
@@ -0,0 +1,34 @@
+package export
+
+import "testing"
+
+func TestEachViolationListsMessages(t *testing.T) {
+	messages := map[string]string{}
+	err := eachViolation(sarifTestScans(), func(row []string) error {
+		messages[row[2]] = row[len(row)-1]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"":            "failed to fetch repositories: 401 Bad credentials",
+		"acme/api":    "default branch allows force pushes; default branch requires no reviews",
+		"acme/web":    "Repository acme/web violates policy branch-protection (low severity)",
+		"acme/broken": "failed to evaluate policy: boom",
+		"acme/gone":   FetchErrorPrefix + "404 Not Found",
+	}
+	for repo, message := range want {
+		if messages[repo] != message {
+			t.Errorf("%q: message %q, want %q", repo, messages[repo], message)
+		}
+	}
+	for _, repo := range []string{"acme/docs", "acme/other"} {
+		if _, ok := messages[repo]; ok {
+			t.Errorf("%s is listed", repo)
+		}
+	}
+	if messages["acme/legacy"] == "" {
+		t.Error("the waived repository is missing")
+	}
+}
@@ -0,0 +1,139 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	pb "github-scanner/src/pb"
+)
+
+func init() {
+	register(Format{Name: "junit", ContentType: "application/xml", Extension: ".xml", Write: WriteJUnit})
+}
+
+// JUnit XML as read by CI systems (Jenkins, GitLab, GitHub test reporters)
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",cdata"`
+}
+
+// WriteJUnit writes a test suite per policy with a test case per repository.
+// Violations are failures, fetch and evaluation errors are errors and
+// repositories filtered out of the report or waived are skipped. A failed
+// scan is a single errored test case of its suite.
+func WriteJUnit(w io.Writer, scans []*pb.PolicyResponse, _ Options) error {
+	report := junitTestSuites{Name: ToolName, Suites: []junitTestSuite{}}
+
+	for _, scan := range scans {
+		policy := PolicyName(scan)
+		suite := junitTestSuite{Name: policy, Cases: []junitTestCase{}}
+		if scan.GetScanId() != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "scan_id", Value: scan.GetScanId()})
+		}
+
+		if scan.GetError() != "" {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      "scan",
+				ClassName: policy,
+				Error:     &junitMessage{Message: "scan failed", Type: "scan", Text: scan.GetError()},
+			})
+			suite.Errors++
+		}
+
+		for _, repo := range scan.GetRepositories() {
+			testCase := junitTestCase{Name: repo.GetFullName(), ClassName: policy}
+			switch Outcome(repo) {
+			case OutcomeFail:
+				violations := Violations(repo, policy)
+				testCase.Failure = &junitMessage{
+					Message: strings.Join(violations, "; "),
+					Type:    "violation",
+					Text:    repositoryDetails(repo, violations),
+				}
+				suite.Failures++
+			case OutcomeError:
+				errType, text := "evaluation", repo.GetScanResult()
+				if IsFetchError(repo) {
+					errType, text = "fetch", strings.TrimPrefix(text, FetchErrorPrefix)
+				}
+				testCase.Error = &junitMessage{Message: text, Type: errType, Text: text}
+				suite.Errors++
+			case OutcomeSkipped:
+				testCase.Skipped = &junitMessage{Message: "filtered out of the report"}
+				suite.Skipped++
+			case OutcomeWaived:
+				testCase.Skipped = &junitMessage{Message: "violation waived", Text: WaiverSummary(Waivers(scan, repo))}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// repositoryDetails describes a violating repository and its violations in
+// the failure body
+func repositoryDetails(repo *pb.RepositoryInfo, violations []string) string {
+	var b strings.Builder
+	for _, v := range violations {
+		fmt.Fprintf(&b, "violation: %s\n", v)
+	}
+	fmt.Fprintf(&b, "repository: %s\nseverity: %s\nvisibility: %s\nurl: %s\n", repo.GetFullName(), repo.GetSeverity(), repo.GetVisibility(), repo.GetRepoUrl())
+	for _, perm := range repo.GetPermissions() {
+		fmt.Fprintf(&b, "permission: %s %s (%s)\n", perm.GetUsername(), perm.GetRole(), perm.GetSource())
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	pb "github-scanner/src/pb"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+func init() {
+	register(Format{Name: "sarif", ContentType: "application/sarif+json", Extension: ".sarif", Write: WriteSARIF})
+}
+
+// SARIF 2.1.0 log, limited to the properties the scanner fills in
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Descriptor *sarifReference `json:"descriptor,omitempty"`
+	Locations  []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifReference struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID              string             `json:"ruleId"`
+	RuleIndex           int                `json:"ruleIndex"`
+	Level               string             `json:"level"`
+	Message             sarifMessage       `json:"message"`
+	Locations           []sarifLocation    `json:"locations"`
+	PartialFingerprints map[string]string  `json:"partialFingerprints"`
+	Suppressions        []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+// sarifSuppression marks a waived violation, which code scanning shows as
+// dismissed
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Status        string `json:"status"`
+	Justification string `json:"justification"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// WriteSARIF writes one SARIF run in which every policy is a rule and every
+// violation a result located at the repository's URL: one per message of the
+// policy's violations rule, or one per violating repository for policies
+// without it. Failed scans and evaluation errors are reported as tool
+// execution notifications.
+func WriteSARIF(w io.Writer, scans []*pb.PolicyResponse, _ Options) error {
+	run := sarifRun{
+		Tool:        sarifTool{Driver: sarifDriver{Name: ToolName, Rules: []sarifRule{}}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+	invocation := &run.Invocations[0]
+	ruleIndex := make(map[string]int)
+
+	for _, scan := range scans {
+		policy := PolicyName(scan)
+		index, ok := ruleIndex[policy]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[policy] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:                   policy,
+				Name:                 policy,
+				ShortDescription:     sarifMessage{Text: fmt.Sprintf("Repository complies with policy %s", policy)},
+				DefaultConfiguration: sarifConfiguration{Level: "error"},
+			})
+		}
+
+		if scan.GetError() != "" {
+			invocation.ExecutionSuccessful = false
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:      "error",
+				Message:    sarifMessage{Text: scan.GetError()},
+				Descriptor: &sarifReference{ID: policy},
+			})
+			continue
+		}
+
+		for _, repo := range scan.GetRepositories() {
+			location := []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: repo.GetRepoUrl()},
+			}}}
+			switch outcome := Outcome(repo); outcome {
+			case OutcomeFail, OutcomeWaived:
+				var suppressions []sarifSuppression
+				if outcome == OutcomeWaived {
+					suppressions = []sarifSuppression{{Kind: "external", Status: "accepted", Justification: WaiverSummary(Waivers(scan, repo))}}
+				}
+				for _, violation := range Violations(repo, policy) {
+					fingerprints := map[string]string{"repository/v1": repo.GetFullName()}
+					if len(repo.GetViolations()) > 0 {
+						fingerprints["violation/v1"] = violation
+					}
+					run.Results = append(run.Results, sarifResult{
+						RuleID:              policy,
+						RuleIndex:           index,
+						Level:               sarifLevel(repo.GetSeverity()),
+						Message:             sarifMessage{Text: violation},
+						Locations:           location,
+						PartialFingerprints: fingerprints,
+						Suppressions:        suppressions,
+					})
+				}
+			case OutcomeError:
+				invocation.ExecutionSuccessful = false
+				invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+					Level:      "error",
+					Message:    sarifMessage{Text: fmt.Sprintf("Evaluating %s failed: %s", repo.GetFullName(), repo.GetScanResult())},
+					Descriptor: &sarifReference{ID: policy},
+					Locations:  location,
+				})
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
+
+// sarifLevel maps a severity to a SARIF level: high and critical
+// violations are errors, medium ones warnings and low ones notes
+func sarifLevel(severity string) string {
+	switch severity {
+	case SeverityLow:
+		return "note"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,154 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	pb "github-scanner/src/pb"
+)
+
+// sarifTestScans covers every outcome: violations with and without
+// messages, a waived violation, evaluation and fetch errors, a repository
+// filtered out of the report and a failed scan
+func sarifTestScans() []*pb.PolicyResponse {
+	return []*pb.PolicyResponse{
+		{
+			ScanId:     "scan-1",
+			PolicyName: "branch-protection",
+			Repositories: []*pb.RepositoryInfo{
+				{
+					FullName:   "acme/api",
+					RepoUrl:    "https://github.com/acme/api",
+					ScanResult: "Failure",
+					Severity:   SeverityHigh,
+					Violations: []string{"default branch allows force pushes", "default branch requires no reviews"},
+				},
+				{FullName: "acme/web", RepoUrl: "https://github.com/acme/web", ScanResult: "Failure", Severity: SeverityLow},
+				{FullName: "acme/docs", RepoUrl: "https://github.com/acme/docs", ScanResult: "Success"},
+				{
+					FullName:   "acme/legacy",
+					RepoUrl:    "https://github.com/acme/legacy",
+					ScanResult: ResultWaived,
+					Severity:   SeverityMedium,
+					Violations: []string{"default branch is unprotected"},
+					WaiverIds:  []string{"w1"},
+				},
+				{FullName: "acme/broken", RepoUrl: "https://github.com/acme/broken", ScanResult: "failed to evaluate policy: boom"},
+				{FullName: "acme/gone", RepoUrl: "https://github.com/acme/gone", ScanResult: FetchErrorPrefix + "404 Not Found"},
+				{FullName: "acme/other", RepoUrl: "https://github.com/acme/other", ScanResult: ResultSkipped},
+			},
+			Waivers: []*pb.Waiver{{
+				WaiverId:      "w1",
+				Repository:    "acme/legacy",
+				Approver:      "security",
+				Justification: "archived next quarter",
+				ExpiresAt:     "2030-01-01T00:00:00Z",
+			}},
+		},
+		{ScanId: "scan-2", PolicyName: "visibility", Error: "failed to fetch repositories: 401 Bad credentials"},
+	}
+}
+
+// TestWriteSARIFValidatesAgainstSchema validates against the definitions of
+// the OASIS schema for the objects WriteSARIF writes, copied in testdata.
+// SARIF_SCHEMA names another copy, such as the unmodified
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/errata01/os/schemas/sarif-schema-2.1.0.json
+func TestWriteSARIFValidatesAgainstSchema(t *testing.T) {
+	path := os.Getenv("SARIF_SCHEMA")
+	if path == "" {
+		path = "testdata/sarif-schema-2.1.0-subset.json"
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	schema, err := compiler.Compile(path)
+	if err != nil {
+		t.Fatalf("compiling the SARIF schema: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, sarifTestScans(), Options{}); err != nil {
+		t.Fatalf("WriteSARIF: %v", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("WriteSARIF wrote invalid JSON: %v", err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		t.Fatalf("SARIF log doesn't match the schema: %#v", err)
+	}
+}
+
+func TestWriteSARIFResults(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, sarifTestScans(), Options{}); err != nil {
+		t.Fatalf("WriteSARIF: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("decoding the SARIF log: %v", err)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+
+	if got := len(run.Tool.Driver.Rules); got != 2 {
+		t.Errorf("got %d rules, want one per policy", got)
+	}
+
+	type result struct {
+		repo, message, level string
+		suppressed           bool
+	}
+	var got []result
+	for _, r := range run.Results {
+		got = append(got, result{
+			repo:       r.PartialFingerprints["repository/v1"],
+			message:    r.Message.Text,
+			level:      r.Level,
+			suppressed: len(r.Suppressions) > 0,
+		})
+	}
+	want := []result{
+		{"acme/api", "default branch allows force pushes", "error", false},
+		{"acme/api", "default branch requires no reviews", "error", false},
+		{"acme/web", "Repository acme/web violates policy branch-protection (low severity)", "note", false},
+		{"acme/legacy", "default branch is unprotected", "warning", true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got results %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if fp := run.Results[0].PartialFingerprints["violation/v1"]; fp != "default branch allows force pushes" {
+		t.Errorf("violation fingerprint = %q", fp)
+	}
+	if _, ok := run.Results[2].PartialFingerprints["violation/v1"]; ok {
+		t.Error("a violation without message got a violation fingerprint")
+	}
+
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful {
+		t.Error("executionSuccessful is true despite errors")
+	}
+	var notifications []string
+	for _, n := range invocation.ToolExecutionNotifications {
+		notifications = append(notifications, n.Message.Text)
+	}
+	wantNotifications := []string{
+		"Evaluating acme/broken failed: failed to evaluate policy: boom",
+		"Evaluating acme/gone failed: " + FetchErrorPrefix + "404 Not Found",
+		"failed to fetch repositories: 401 Bad credentials",
+	}
+	if strings.Join(notifications, "\n") != strings.Join(wantNotifications, "\n") {
+		t.Errorf("got notifications %q, want %q", notifications, wantNotifications)
+	}
+}
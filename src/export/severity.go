@@ -0,0 +1,79 @@
+package export
+
+import (
+	"math"
+	"strings"
+
+	pb "github-scanner/src/pb"
+)
+
+// Severities of violations, from the least to the most severe
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// DefaultSeverity applies to policies that declare none
+const DefaultSeverity = SeverityMedium
+
+// Severities lists the severities by increasing weight
+var Severities = []string{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// risk weight of a failure of each severity
+var severityWeights = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   3,
+	SeverityHigh:     7,
+	SeverityCritical: 10,
+}
+
+// ParseSeverity normalizes a severity, reporting whether it is known
+func ParseSeverity(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	_, ok := severityWeights[s]
+	return s, ok
+}
+
+// SeverityWeight is the risk weight of a severity, 0 for unknown ones
+func SeverityWeight(severity string) int {
+	return severityWeights[severity]
+}
+
+// RiskScore of a repository: the weight of its severity when it fails
+func RiskScore(repo *pb.RepositoryInfo) int32 {
+	if Outcome(repo) != OutcomeFail {
+		return 0
+	}
+	return int32(SeverityWeight(repo.GetSeverity()))
+}
+
+// Score weighs the failures of repositories by severity. Errors and
+// skipped repositories are not evaluated; waived ones carry no risk.
+func Score(repos []*pb.RepositoryInfo) *pb.ComplianceScore {
+	score := &pb.ComplianceScore{Failures: map[string]int32{}}
+	for _, repo := range repos {
+		switch Outcome(repo) {
+		case OutcomeFail:
+			score.Failures[repo.GetSeverity()]++
+		case OutcomePass, OutcomeWaived:
+		default:
+			continue
+		}
+		score.Evaluated++
+		score.RiskScore += RiskScore(repo)
+	}
+	score.ComplianceScore = ComplianceScore(score.RiskScore, score.Evaluated)
+	return score
+}
+
+// ComplianceScore is 100 less the share of the maximum risk that the
+// evaluated repositories carry, to one decimal; 0 when none was evaluated
+func ComplianceScore(risk, evaluated int32) float64 {
+	if evaluated == 0 {
+		return 0
+	}
+	maxRisk := float64(evaluated) * float64(severityWeights[SeverityCritical])
+	return math.Round(1000*(1-float64(risk)/maxRisk)) / 10
+}
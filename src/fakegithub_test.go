@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitHub is a GitHub API served by an httptest.Server, registered as the
+// endpoint of one organization for the duration of a test
+type fakeGitHub struct {
+	*httptest.Server
+	endpoint GitHubEndpoint
+
+	mu       sync.Mutex
+	requests []string // "METHOD /path" of every request, in order
+}
+
+// newFakeGitHub serves the handler as the GitHub endpoint of org. go-github
+// sends GHES requests under /api/v3 and GraphQL queries to /api/graphql; the
+// handler sees them without the /api/v3 and /api prefixes.
+func newFakeGitHub(t *testing.T, org string, handler http.HandlerFunc) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path, ok := strings.CutPrefix(r.URL.Path, "/api/v3"); ok {
+			r.URL.Path = path
+		} else {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api")
+		}
+		r.URL.RawPath = ""
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		f.mu.Unlock()
+		handler(w, r)
+	}))
+	f.endpoint = GitHubEndpoint{
+		Name:    "fake-" + strings.ReplaceAll(t.Name(), "/", "-"),
+		Token:   "test-token",
+		BaseURL: f.URL + "/",
+		Orgs:    []string{org},
+	}
+
+	previous := getGitHubEndpoints()
+	configureGitHubEndpoints([]GitHubEndpoint{f.endpoint})
+	t.Cleanup(func() {
+		f.Close()
+		gitHubEndpointsMu.Lock()
+		gitHubEndpoints = previous
+		gitHubEndpointsMu.Unlock()
+		gitHubClientsMu.Lock()
+		delete(gitHubClients, f.endpoint.Name)
+		gitHubClientsMu.Unlock()
+	})
+	return f
+}
+
+// received returns the requests served so far
+func (f *fakeGitHub) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
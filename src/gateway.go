@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github-scanner/src/pb"
+)
+
+// OpenAPI document generated from pb.proto by protoc-gen-openapiv2
+//
+//go:embed pb/pb.swagger.json
+var openAPIDocument []byte
+
+// gateway serves PolicyService as HTTP/JSON (POST /v1/scans, GET
+// /v1/scans/{scan_id}, POST /v1/evaluations). Requests are translated by grpc-gateway and sent to
+// an in-process gRPC server with the same interceptors as the public one.
+// It also receives GitHub webhook events on POST /webhooks/github, unless
+// they have a listener of their own.
+type gateway struct {
+	http *http.Server
+	grpc *grpc.Server
+	conn *grpc.ClientConn
+}
+
+// startGateway serves the gateway on address, over TLS when tlsConfig is set
+func startGateway(address string, server *Server, opts []grpc.ServerOption, tlsConfig *tls.Config) (*gateway, error) {
+	httpLis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	lis := newMemListener()
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterPolicyServiceServer(grpcServer, server)
+	go grpcServer.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(lis.Dial),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		httpLis.Close()
+		grpcServer.Stop()
+		return nil, err
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(gatewayHeaderMatcher),
+	)
+	if err := pb.RegisterPolicyServiceHandler(context.Background(), mux, conn); err != nil {
+		httpLis.Close()
+		conn.Close()
+		grpcServer.Stop()
+		return nil, err
+	}
+
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/v1/", mux)
+	httpMux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	})
+	if server.receiver != nil && server.config.GitHub.WebhookListen == "" {
+		httpMux.Handle("POST /webhooks/github", server.receiver)
+	}
+
+	gw := &gateway{
+		http: &http.Server{
+			Handler:           otelhttp.NewHandler(httpMux, "gateway"),
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		grpc: grpcServer,
+		conn: conn,
+	}
+
+	go func() {
+		slog.Info("HTTP gateway listening", "listen", address, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			err = gw.http.ServeTLS(httpLis, "", "")
+		} else {
+			err = gw.http.Serve(httpLis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP gateway failed", "error", err)
+		}
+	}()
+	return gw, nil
+}
+
+// startWebhookServer serves the GitHub webhook receiver alone on address,
+// over TLS when tlsConfig is set. It lets GitHub deliver events to servers
+// whose gateway requires client certificates.
+func startWebhookServer(address string, receiver *eventReceiver, tlsConfig *tls.Config) (*http.Server, error) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /webhooks/github", receiver)
+	srv := &http.Server{
+		Handler:           otelhttp.NewHandler(mux, "webhooks"),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("GitHub webhook receiver listening", "listen", address, "tls", tlsConfig != nil)
+		var err error
+		if tlsConfig != nil {
+			err = srv.ServeTLS(lis, "", "")
+		} else {
+			err = srv.Serve(lis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("GitHub webhook receiver failed", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+// gatewayHeaderMatcher passes the request and scan ID headers through as
+// is; other headers follow the grpc-gateway defaults
+func gatewayHeaderMatcher(key string) (string, bool) {
+	switch strings.ToLower(key) {
+	case requestIDHeader, scanIDHeader:
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// Shutdown waits for the gateway's requests to finish; a nil gateway is a no-op
+func (g *gateway) Shutdown(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	g.http.Shutdown(ctx)
+	g.conn.Close()
+	g.grpc.GracefulStop()
+}
+
+// Close stops the gateway, cancelling its requests; a nil gateway is a no-op
+func (g *gateway) Close() {
+	if g == nil {
+		return
+	}
+	g.http.Close()
+	g.conn.Close()
+	g.grpc.Stop()
+}
+
+// memListener is an in-memory net.Listener connecting the gateway to its gRPC server
+type memListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newMemListener() *memListener {
+	return &memListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr{}
+}
+
+// Dial hands one end of a pipe to Accept and returns the other
+func (l *memListener) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type memAddr struct{}
+
+func (memAddr) Network() string { return "memory" }
+func (memAddr) String() string  { return "gateway" }
@@ -2,33 +2,207 @@ package main
 
 import (
     "context"
-    "log"
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "net/url"
     "os"
+    "sort"
+    "strings"
     "sync"
 
     "github.com/google/go-github/v69/github"
     "golang.org/x/oauth2"
 )
 
+// DefaultEndpointName is the endpoint configured by the unprefixed GITHUB_* variables
+const DefaultEndpointName = "default"
+
+// GitHubEndpoint describes a GitHub API (github.com or a GHES instance) the scanner can talk to
+type GitHubEndpoint struct {
+    Name      string   `yaml:"name" toml:"name"`
+    Token     string   `yaml:"token" toml:"token"`
+    BaseURL   string   `yaml:"api_url" toml:"api_url"`       // empty means api.github.com
+    UploadURL string   `yaml:"upload_url" toml:"upload_url"` // defaults to BaseURL for GHES
+    CAFile    string   `yaml:"ca_file" toml:"ca_file"`       // extra PEM bundle trusted on top of the system pool
+    ProxyURL  string   `yaml:"proxy" toml:"proxy"`           // empty means HTTP(S)_PROXY from the environment
+    Orgs      []string `yaml:"orgs" toml:"orgs"`             // organizations served by this endpoint
+}
+
 var (
-    gitHubClient     *github.Client
-    gitHubClientOnce sync.Once
+    gitHubEndpoints   map[string]GitHubEndpoint
+    gitHubEndpointsMu sync.RWMutex
+
+    gitHubClients   = make(map[string]*github.Client)
+    gitHubClientsMu sync.Mutex
 )
 
-func getGitHubClient() *github.Client {
-    gitHubClientOnce.Do(func() {
-        token := os.Getenv("GITHUB_TOKEN")
-        if token == "" {
-            log.Fatal("GITHUB_TOKEN is missing. Set it in your environment.")
+// loads the endpoint definitions from the environment; they override the config file.
+//
+// The default endpoint uses GITHUB_TOKEN, GITHUB_API_URL, GITHUB_UPLOAD_URL,
+// GITHUB_CA_FILE and GITHUB_PROXY. Additional endpoints are listed in
+// GITHUB_ENDPOINTS (comma separated) and configured with the same variables
+// prefixed by the upper-cased name, e.g. GITHUB_GHES_TOKEN, GITHUB_GHES_API_URL
+// and GITHUB_GHES_ORGS.
+func loadGitHubEndpointsFromEnv() map[string]GitHubEndpoint {
+    endpoints := make(map[string]GitHubEndpoint)
+
+    if os.Getenv("GITHUB_TOKEN") != "" || os.Getenv("GITHUB_API_URL") != "" {
+        endpoints[DefaultEndpointName] = endpointFromEnv(DefaultEndpointName, "GITHUB_")
+    }
+
+    for _, name := range strings.Split(os.Getenv("GITHUB_ENDPOINTS"), ",") {
+        name = strings.TrimSpace(name)
+        if name == "" || name == DefaultEndpointName {
+            continue
+        }
+        prefix := "GITHUB_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+        endpoints[name] = endpointFromEnv(name, prefix)
+    }
+    return endpoints
+}
+
+func endpointFromEnv(name, prefix string) GitHubEndpoint {
+    var orgs []string
+    for _, org := range strings.Split(os.Getenv(prefix+"ORGS"), ",") {
+        if org = strings.TrimSpace(org); org != "" {
+            orgs = append(orgs, org)
+        }
+    }
+    return GitHubEndpoint{
+        Name:      name,
+        Token:     os.Getenv(prefix + "TOKEN"),
+        BaseURL:   os.Getenv(prefix + "API_URL"),
+        UploadURL: os.Getenv(prefix + "UPLOAD_URL"),
+        CAFile:    os.Getenv(prefix + "CA_FILE"),
+        ProxyURL:  os.Getenv(prefix + "PROXY"),
+        Orgs:      orgs,
+    }
+}
+
+// configureGitHubEndpoints installs the endpoints from the server configuration
+func configureGitHubEndpoints(endpoints []GitHubEndpoint) {
+    byName := make(map[string]GitHubEndpoint, len(endpoints))
+    for _, e := range endpoints {
+        byName[e.Name] = e
+    }
+
+    gitHubEndpointsMu.Lock()
+    gitHubEndpoints = byName
+    gitHubEndpointsMu.Unlock()
+}
+
+func getGitHubEndpoints() map[string]GitHubEndpoint {
+    gitHubEndpointsMu.RLock()
+    defer gitHubEndpointsMu.RUnlock()
+    return gitHubEndpoints
+}
+
+// resolveEndpoint picks the endpoint to use for an org. An explicit name wins,
+// then an endpoint that lists the org, then the default endpoint.
+func resolveEndpoint(name, org string) (GitHubEndpoint, error) {
+    endpoints := getGitHubEndpoints()
+
+    if name != "" {
+        endpoint, ok := endpoints[name]
+        if !ok {
+            return GitHubEndpoint{}, fmt.Errorf("unknown GitHub endpoint %q", name)
+        }
+        return endpoint, nil
+    }
+
+    names := make([]string, 0, len(endpoints))
+    for n := range endpoints {
+        names = append(names, n)
+    }
+    sort.Strings(names)
+    for _, n := range names {
+        for _, o := range endpoints[n].Orgs {
+            if strings.EqualFold(o, org) {
+                return endpoints[n], nil
+            }
         }
+    }
+
+    if endpoint, ok := endpoints[DefaultEndpointName]; ok {
+        return endpoint, nil
+    }
+    return GitHubEndpoint{}, fmt.Errorf("no GitHub endpoint configured for organization %q", org)
+}
+
+// getGitHubClient returns the cached client for the given endpoint, creating it on first use
+func getGitHubClient(endpoint GitHubEndpoint) (*github.Client, error) {
+    gitHubClientsMu.Lock()
+    defer gitHubClientsMu.Unlock()
+
+    if client, ok := gitHubClients[endpoint.Name]; ok {
+        return client, nil
+    }
+
+    client, err := newGitHubClient(endpoint)
+    if err != nil {
+        return nil, fmt.Errorf("endpoint %s: %w", endpoint.Name, err)
+    }
+    gitHubClients[endpoint.Name] = client
+    slog.Info("Initialized GitHub client", "github_endpoint", endpoint.Name)
+    return client, nil
+}
+
+func newGitHubClient(endpoint GitHubEndpoint) (*github.Client, error) {
+    if endpoint.Token == "" {
+        return nil, fmt.Errorf("GitHub token is missing")
+    }
+
+    transport, err := newGitHubTransport(endpoint)
+    if err != nil {
+        return nil, err
+    }
+
+    // Wrap the transport with the OAuth2 token source
+    ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: endpoint.Token})
+    base := &http.Client{Transport: newTracingTransport(newMetricsTransport(endpoint.Name, transport))}
+    tc := oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, base), ts)
 
-        // Initialize a new OAuth2 client using the GitHub token
-        ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-        tc := oauth2.NewClient(context.Background(), ts)
+    client := github.NewClient(tc)
+    if endpoint.BaseURL == "" {
+        return client, nil
+    }
+
+    uploadURL := endpoint.UploadURL
+    if uploadURL == "" {
+        uploadURL = endpoint.BaseURL
+    }
+    return client.WithEnterpriseURLs(endpoint.BaseURL, uploadURL)
+}
+
+// builds the HTTP transport honoring the endpoint's proxy and CA settings
+func newGitHubTransport(endpoint GitHubEndpoint) (*http.Transport, error) {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+
+    if endpoint.ProxyURL != "" {
+        proxyURL, err := url.Parse(endpoint.ProxyURL)
+        if err != nil {
+            return nil, fmt.Errorf("invalid proxy URL: %w", err)
+        }
+        transport.Proxy = http.ProxyURL(proxyURL)
+    }
+
+    if endpoint.CAFile != "" {
+        pem, err := os.ReadFile(endpoint.CAFile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+        }
+        pool, err := x509.SystemCertPool()
+        if err != nil {
+            pool = x509.NewCertPool()
+        }
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("no certificates found in %s", endpoint.CAFile)
+        }
+        transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+    }
 
-        // Create and store the GitHub client
-        gitHubClient = github.NewClient(tc)
-        log.Println("Initialized GitHub client.")
-    })
-    return gitHubClient
+    return transport, nil
 }
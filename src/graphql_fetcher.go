@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	graphQLMaxPageSize = 100
+	graphQLMinPageSize = 10
+)
+
+const graphQLCollaboratorFields = `
+      pageInfo { hasNextPage endCursor }
+      edges {
+        permission
+        node { login }
+        permissionSources { source { __typename ... on Team { slug } } }
+      }`
+
+const graphQLRepositoriesQuery = `
+query($org: String!, $first: Int!, $after: String) {
+  rateLimit { cost remaining resetAt }
+  organization(login: $org) {
+    repositories(first: $first, after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name
+        nameWithOwner
+        owner { login }
+        visibility
+        isPrivate
+        description
+        url
+        updatedAt
+        viewerCanAdminister
+        defaultBranchRef {
+          name
+          branchProtectionRule {
+            requiresApprovingReviews
+            requiredApprovingReviewCount
+            requiresCodeOwnerReviews
+            dismissesStaleReviews
+            requiresStatusChecks
+            isAdminEnforced
+            allowsForcePushes
+            allowsDeletions
+            requiresLinearHistory
+          }
+        }
+        collaborators(first: 100, affiliation: ALL) {` + graphQLCollaboratorFields + `
+        }
+      }
+    }
+  }
+}`
+
+const graphQLCollaboratorsQuery = `
+query($owner: String!, $name: String!, $after: String) {
+  rateLimit { cost remaining resetAt }
+  repository(owner: $owner, name: $name) {
+    collaborators(first: 100, after: $after, affiliation: ALL) {` + graphQLCollaboratorFields + `
+    }
+  }
+}`
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLRateLimit struct {
+	Cost      int       `json:"cost"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+type graphQLCollaborators struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Edges    []struct {
+		Permission string `json:"permission"`
+		Node       struct {
+			Login string `json:"login"`
+		} `json:"node"`
+		PermissionSources []struct {
+			Source struct {
+				TypeName string `json:"__typename"`
+				Slug     string `json:"slug"`
+			} `json:"source"`
+		} `json:"permissionSources"`
+	} `json:"edges"`
+}
+
+type graphQLRepository struct {
+	Name          string `json:"name"`
+	NameWithOwner string `json:"nameWithOwner"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	Visibility  string    `json:"visibility"`
+	IsPrivate   bool      `json:"isPrivate"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// without admin rights, branchProtectionRule is null whether or not the
+	// branch is protected
+	ViewerCanAdminister bool `json:"viewerCanAdminister"`
+	DefaultBranchRef    *struct {
+		Name                 string `json:"name"`
+		BranchProtectionRule *struct {
+			RequiresApprovingReviews     bool `json:"requiresApprovingReviews"`
+			RequiredApprovingReviewCount int  `json:"requiredApprovingReviewCount"`
+			RequiresCodeOwnerReviews     bool `json:"requiresCodeOwnerReviews"`
+			DismissesStaleReviews        bool `json:"dismissesStaleReviews"`
+			RequiresStatusChecks         bool `json:"requiresStatusChecks"`
+			IsAdminEnforced              bool `json:"isAdminEnforced"`
+			AllowsForcePushes            bool `json:"allowsForcePushes"`
+			AllowsDeletions              bool `json:"allowsDeletions"`
+			RequiresLinearHistory        bool `json:"requiresLinearHistory"`
+		} `json:"branchProtectionRule"`
+	} `json:"defaultBranchRef"`
+	Collaborators *graphQLCollaborators `json:"collaborators"`
+}
+
+type graphQLError struct {
+	Type    string        `json:"type"`
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"`
+}
+
+// graphQLFetcher loads repositories together with their collaborators and
+// default branch protection in pages of up to 100 through the GraphQL v4 API
+type graphQLFetcher struct {
+	httpClient *http.Client
+	url        string
+	planner    *queryPlanner
+}
+
+// newGraphQLFetcher shares the planner of the endpoint, so concurrent scans
+// draw on the same rate-limit budget
+func newGraphQLFetcher(client *github.Client, planner *queryPlanner) *graphQLFetcher {
+	return &graphQLFetcher{
+		httpClient: client.Client(),
+		url:        graphQLURL(client.BaseURL),
+		planner:    planner,
+	}
+}
+
+// graphQLURL derives the GraphQL endpoint from the REST base URL:
+// https://api.github.com/graphql or https://<ghes-host>/api/graphql
+func graphQLURL(baseURL *url.URL) string {
+	u := *baseURL
+	if strings.HasSuffix(u.Path, "/api/v3/") {
+		u.Path = strings.TrimSuffix(u.Path, "v3/") + "graphql"
+		return u.String()
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/graphql"
+	return u.String()
+}
+
+func (f *graphQLFetcher) Name() string {
+	return BackendGraphQL
+}
+
+func (f *graphQLFetcher) FetchRepositories(ctx context.Context, org string) ([]RepositoryInfo, error) {
+	var repoInfos []RepositoryInfo
+	var after *string
+
+	for {
+		pageSize, err := f.planner.nextPageSize(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var data struct {
+			RateLimit    graphQLRateLimit `json:"rateLimit"`
+			Organization *struct {
+				Repositories struct {
+					PageInfo graphQLPageInfo     `json:"pageInfo"`
+					Nodes    []graphQLRepository `json:"nodes"`
+				} `json:"repositories"`
+			} `json:"organization"`
+		}
+		vars := map[string]interface{}{"org": org, "first": pageSize, "after": after}
+		pageCtx, span := tracer.Start(ctx, "GraphQL repositories page", trace.WithAttributes(attribute.Int("page_size", pageSize)))
+		errs, err := f.query(pageCtx, graphQLRepositoriesQuery, vars, &data)
+		span.SetAttributes(attribute.Int("rate_limit.cost", data.RateLimit.Cost), attribute.Int("rate_limit.remaining", data.RateLimit.Remaining))
+		endSpan(span, err)
+		if err != nil {
+			if isGraphQLTimeout(err) {
+				if size, ok := f.planner.shrink(pageSize); ok {
+					slog.WarnContext(ctx, "GraphQL query timed out, retrying with a smaller page", "page_size", size)
+					continue
+				}
+			}
+			return nil, fmt.Errorf("error fetching repositories for %s: %w", org, err)
+		}
+		f.planner.record(data.RateLimit)
+
+		if data.Organization == nil {
+			return nil, fmt.Errorf("error fetching repositories for %s: %s", org, joinGraphQLErrors(errs))
+		}
+		// Field errors on single repositories (e.g. no access to collaborators)
+		// are not fatal, but an unreadable protection rule fails the repository
+		protectionErrors := make(map[int]string)
+		for _, e := range errs {
+			slog.WarnContext(ctx, "GraphQL error", "path", e.Path, "error", e.Message)
+			if i, ok := protectionRuleErrorNode(e.Path); ok {
+				protectionErrors[i] = e.Message
+			}
+		}
+
+		repos := data.Organization.Repositories
+		for i, repo := range repos.Nodes {
+			if repo.Collaborators != nil && repo.Collaborators.PageInfo.HasNextPage {
+				if err := f.fetchRemainingCollaborators(ctx, &repo); err != nil {
+					slog.WarnContext(ctx, "Error fetching collaborators", "repo", repo.Name, "error", err)
+				}
+			}
+			info := normalizeGraphQLRepository(repo)
+			if msg, ok := protectionErrors[i]; ok {
+				info.FetchError = branchProtectionError(info.DefaultBranch, msg)
+			}
+			repoInfos = append(repoInfos, info)
+		}
+		slog.DebugContext(ctx, "Fetched repositories page", "fetched", len(repoInfos))
+
+		if !repos.PageInfo.HasNextPage {
+			slog.DebugContext(ctx, "No more pages to fetch")
+			break
+		}
+		cursor := repos.PageInfo.EndCursor
+		after = &cursor
+	}
+
+	return repoInfos, nil
+}
+
+// pages through the collaborators of a repository beyond the first 100
+func (f *graphQLFetcher) fetchRemainingCollaborators(ctx context.Context, repo *graphQLRepository) error {
+	for repo.Collaborators.PageInfo.HasNextPage {
+		if _, err := f.planner.nextPageSize(ctx); err != nil {
+			return err
+		}
+
+		var data struct {
+			RateLimit  graphQLRateLimit `json:"rateLimit"`
+			Repository *struct {
+				Collaborators *graphQLCollaborators `json:"collaborators"`
+			} `json:"repository"`
+		}
+		vars := map[string]interface{}{
+			"owner": repo.Owner.Login,
+			"name":  repo.Name,
+			"after": repo.Collaborators.PageInfo.EndCursor,
+		}
+		errs, err := f.query(ctx, graphQLCollaboratorsQuery, vars, &data)
+		if err != nil {
+			return err
+		}
+		f.planner.record(data.RateLimit)
+		if data.Repository == nil || data.Repository.Collaborators == nil {
+			return fmt.Errorf("%s", joinGraphQLErrors(errs))
+		}
+
+		page := data.Repository.Collaborators
+		repo.Collaborators.Edges = append(repo.Collaborators.Edges, page.Edges...)
+		repo.Collaborators.PageInfo = page.PageInfo
+	}
+	return nil
+}
+
+// query posts a GraphQL document and decodes its data into out. Field level
+// errors are returned separately since GraphQL reports them next to partial data.
+func (f *graphQLFetcher) query(ctx context.Context, query string, vars map[string]interface{}, out interface{}) ([]graphQLError, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": vars})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &graphQLStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("invalid GraphQL response: %w", err)
+	}
+	if len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil, fmt.Errorf("GraphQL query failed: %s", joinGraphQLErrors(envelope.Errors))
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return nil, fmt.Errorf("invalid GraphQL response: %w", err)
+	}
+	return envelope.Errors, nil
+}
+
+type graphQLStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *graphQLStatusError) Error() string {
+	return fmt.Sprintf("GraphQL request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// GitHub answers queries that take too long to resolve with 502/504
+func isGraphQLTimeout(err error) bool {
+	statusErr, ok := err.(*graphQLStatusError)
+	return ok && (statusErr.StatusCode == http.StatusBadGateway || statusErr.StatusCode == http.StatusGatewayTimeout)
+}
+
+func joinGraphQLErrors(errs []graphQLError) string {
+	if len(errs) == 0 {
+		return "no data returned"
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// protectionRuleErrorNode returns the index of the repository node whose
+// branch protection rule a field error is about:
+// ["organization", "repositories", "nodes", i, "defaultBranchRef", "branchProtectionRule"]
+func protectionRuleErrorNode(path []interface{}) (int, bool) {
+	if len(path) < 6 || path[2] != "nodes" || path[5] != "branchProtectionRule" {
+		return 0, false
+	}
+	i, ok := path[3].(float64)
+	return int(i), ok
+}
+
+// converts a GraphQL repository node into the same shape the REST backend
+// produces. A null protection rule only means an unprotected branch when
+// the token can administer the repository; otherwise it is unknown.
+func normalizeGraphQLRepository(repo graphQLRepository) RepositoryInfo {
+	info := RepositoryInfo{
+		Name:        repo.Name,
+		FullName:    repo.NameWithOwner,
+		Owner:       repo.Owner.Login,
+		Visibility:  strings.ToLower(repo.Visibility),
+		Private:     repo.IsPrivate,
+		Description: repo.Description,
+		RepoURL:     repo.URL,
+		LastUpdated: repo.UpdatedAt.String(),
+	}
+
+	if ref := repo.DefaultBranchRef; ref != nil {
+		info.DefaultBranch = ref.Name
+		if rule := ref.BranchProtectionRule; rule != nil {
+			info.BranchProtection = &BranchProtection{
+				RequiresCodeOwnerReviews: rule.RequiresCodeOwnerReviews,
+				DismissesStaleReviews:    rule.DismissesStaleReviews,
+				RequiresStatusChecks:     rule.RequiresStatusChecks,
+				EnforceAdmins:            rule.IsAdminEnforced,
+				AllowsForcePushes:        rule.AllowsForcePushes,
+				AllowsDeletions:          rule.AllowsDeletions,
+				RequiresLinearHistory:    rule.RequiresLinearHistory,
+			}
+			if rule.RequiresApprovingReviews {
+				info.BranchProtection.RequiredApprovingReviewCount = rule.RequiredApprovingReviewCount
+			}
+		} else if !repo.ViewerCanAdminister {
+			info.FetchError = branchProtectionError(ref.Name, "the token can't administer the repository")
+		}
+	}
+
+	if repo.Collaborators != nil {
+		for _, edge := range repo.Collaborators.Edges {
+			source := "user"
+			for _, ps := range edge.PermissionSources {
+				if ps.Source.TypeName == "Team" {
+					source = "team:" + ps.Source.Slug
+					break
+				}
+			}
+			info.Permissions = append(info.Permissions, RepositoryPermissions{
+				Username: edge.Node.Login,
+				Role:     normalizeGraphQLPermission(edge.Permission),
+				Source:   source,
+			})
+		}
+	}
+	return info
+}
+
+// maps RepositoryPermission enum values onto the legacy REST permission levels
+func normalizeGraphQLPermission(permission string) string {
+	switch permission {
+	case "ADMIN":
+		return "admin"
+	case "MAINTAIN", "WRITE":
+		return "write"
+	case "TRIAGE", "READ":
+		return "read"
+	default:
+		return "none"
+	}
+}
+
+// queryPlanner sizes repository pages so every query fits into the GraphQL
+// rate-limit points left, and waits for the reset when none remain. One
+// planner is kept per endpoint and shared by its concurrent scans.
+type queryPlanner struct {
+	mu        sync.Mutex
+	pageSize  int
+	remaining int // -1 until the first response reports the budget
+	resetAt   time.Time
+}
+
+func newQueryPlanner() *queryPlanner {
+	return &queryPlanner{pageSize: graphQLMaxPageSize, remaining: -1}
+}
+
+// queryPlanners holds the planner of each GitHub endpoint
+type queryPlanners struct {
+	mu       sync.Mutex
+	planners map[string]*queryPlanner
+}
+
+func newQueryPlanners() *queryPlanners {
+	return &queryPlanners{planners: make(map[string]*queryPlanner)}
+}
+
+func (q *queryPlanners) get(endpoint string) *queryPlanner {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p, ok := q.planners[endpoint]
+	if !ok {
+		p = newQueryPlanner()
+		q.planners[endpoint] = p
+	}
+	return p
+}
+
+// estimateGraphQLCost follows GitHub's formula: the number of connection
+// requests needed (the repository page plus one collaborator connection per
+// repository) divided by 100, with a minimum of one point
+func estimateGraphQLCost(pageSize int) int {
+	requests := 1 + pageSize
+	cost := requests / 100
+	if cost < 1 {
+		cost = 1
+	}
+	return cost
+}
+
+// nextPageSize returns the largest page the remaining budget can pay for and
+// reserves its cost until the response reports the budget, blocking until
+// the rate limit resets when even the smallest page can't be paid for
+func (p *queryPlanner) nextPageSize(ctx context.Context) (int, error) {
+	for {
+		p.mu.Lock()
+		if p.remaining < 0 {
+			size := p.pageSize
+			p.mu.Unlock()
+			return size, nil
+		}
+
+		size := p.pageSize
+		for size > graphQLMinPageSize && estimateGraphQLCost(size) > p.remaining {
+			size /= 2
+		}
+		if cost := estimateGraphQLCost(size); cost <= p.remaining {
+			p.remaining -= cost
+			p.mu.Unlock()
+			return size, nil
+		}
+		resetAt := p.resetAt
+		p.mu.Unlock()
+
+		wait := time.Until(resetAt)
+		slog.WarnContext(ctx, "GraphQL rate limit exhausted, waiting until reset", "wait", wait.Round(time.Second).String())
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return 0, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		p.mu.Lock()
+		// Another scan may already have seen the new budget
+		if !p.resetAt.After(resetAt) {
+			p.remaining = -1
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *queryPlanner) record(rl graphQLRateLimit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remaining = rl.Remaining
+	p.resetAt = rl.ResetAt
+}
+
+// shrink halves the page size after a query of size timed out and returns
+// the new size; false once it can't go lower
+func (p *queryPlanner) shrink(size int) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// A concurrent scan may already have shrunk it
+	if p.pageSize < size {
+		return p.pageSize, true
+	}
+	if p.pageSize <= graphQLMinPageSize {
+		return p.pageSize, false
+	}
+	p.pageSize /= 2
+	if p.pageSize < graphQLMinPageSize {
+		p.pageSize = graphQLMinPageSize
+	}
+	return p.pageSize, true
+}
@@ -1,53 +1,765 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"github-scanner/src/export"
 	pb "github-scanner/src/pb"
 )
 
 type Server struct {
 	pb.UnimplementedPolicyServiceServer
+
+	config  *Config
+	scanner *Scanner
+	scans    *scanStore
+	bundles  *bundleStore
+	registry *policyRegistry // nil when policies.registry is not set
+	waivers  *waiverStore    // nil when policies.waivers is not set
+	audit    *auditLog       // nil when remediation.audit_log is not set
+	issues   *issueTracker   // nil when issues are not enabled
+	notifier *notifier       // nil without webhooks
+	receiver *eventReceiver  // nil when github.webhook_secret is not set
+	auth     *Authenticator  // nil when authentication is disabled
+
+	// in-flight scans, drained on shutdown
+	mu       sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+}
+
+func NewServer(cfg *Config, auth *Authenticator, bundles *bundleStore, registry *policyRegistry, waivers *waiverStore, audit *auditLog) *Server {
+	var issues *issueTracker
+	if cfg.Issues.Enabled {
+		issues = &issueTracker{config: cfg.Issues}
+	}
+	var notify *notifier
+	if len(cfg.Notifications.Webhooks) > 0 {
+		notify = newNotifier(cfg.Notifications)
+	}
+	s := &Server{
+		config:   cfg,
+		scanner:  NewScanner(cfg),
+		scans:    newScanStore(cfg.Scan.History),
+		bundles:  bundles,
+		registry: registry,
+		waivers:  waivers,
+		audit:    audit,
+		issues:   issues,
+		notifier: notify,
+		auth:     auth,
+	}
+	if cfg.GitHub.WebhookSecret != "" {
+		s.receiver = newEventReceiver(cfg.GitHub.WebhookSecret, s)
+	}
+	return s
+}
+
+// requests that select a policy: inline, a bundle or a registered policy
+type policySelector interface {
+	GetPolicy() string
+	GetBundle() string
+	GetPolicyRef() string
+	GetPolicyName() string
+}
+
+// resolvedPolicy is the policy a request selected, with what results are
+// stamped with
+type resolvedPolicy struct {
+	Policy
+	name    string
+	version string
+	sha256  string
+	// what waivers of the policy name: the policy_id of a registered policy
+	// or the bundle name, whatever policy_name the request reports it under.
+	// Empty for inline policies, whose names callers choose, so no waiver
+	// applies to them.
+	waiverKey string
+	// shadow version of a registered policy, evaluated alongside it
+	shadow *resolvedPolicy
+}
+
+func (p resolvedPolicy) stamp(resp *pb.PolicyResponse) {
+	resp.PolicyName = p.name
+	resp.PolicyVersion = p.version
+	resp.PolicySha256 = p.sha256
+}
+
+// resolves the policy of a request and the name its results are reported under
+func (s *Server) resolvePolicy(req policySelector) (resolvedPolicy, error) {
+	selected := 0
+	for _, v := range []string{req.GetPolicy(), req.GetBundle(), req.GetPolicyRef()} {
+		if v != "" {
+			selected++
+		}
+	}
+	if selected != 1 {
+		return resolvedPolicy{}, status.Error(codes.InvalidArgument, "exactly one of policy, bundle and policy_ref is required")
+	}
+
+	resolved := resolvedPolicy{name: req.GetPolicyName()}
+	switch {
+	case req.GetBundle() != "":
+		b, ok := s.bundles.get(req.GetBundle())
+		if !ok {
+			return resolvedPolicy{}, status.Errorf(codes.NotFound, "bundle %q not found", req.GetBundle())
+		}
+		resolved.Policy = Policy{Bundle: b}
+		resolved.waiverKey = b.Name
+		if resolved.name == "" {
+			resolved.name = b.Name
+		}
+		if b.Revision != "" {
+			resolved.version = b.Name + "@" + b.Revision
+		}
+	case req.GetPolicyRef() != "":
+		if s.registry == nil {
+			return resolvedPolicy{}, errRegistryDisabled
+		}
+		p, version, err := s.registry.resolve(req.GetPolicyRef())
+		if err != nil {
+			return resolvedPolicy{}, registryError(err)
+		}
+		resolved.Policy = Policy{Source: version.Source}
+		resolved.waiverKey = p.ID
+		if resolved.name == "" {
+			resolved.name = p.ID
+		}
+		resolved.version = fmt.Sprintf("%s@%d", p.ID, version.Version)
+		resolved.sha256 = version.SHA256
+		if shadow, ok := p.shadowOf(version); ok {
+			resolved.shadow = &resolvedPolicy{
+				Policy:    Policy{Source: shadow.Source, Shadow: true},
+				name:      resolved.name,
+				version:   fmt.Sprintf("%s@%d", p.ID, shadow.Version),
+				sha256:    shadow.SHA256,
+				waiverKey: p.ID,
+			}
+		}
+	default:
+		resolved.Policy = Policy{Source: req.GetPolicy()}
+		resolved.sha256 = policyHash(req.GetPolicy())
+	}
+	return resolved, nil
 }
 
 // triggers the GitHub scanner and returns repository results
 func (s *Server) ScanRepositories(ctx context.Context, req *pb.PolicyRequest) (*pb.PolicyResponse, error) {
-	log.Println("Received gRPC request to scan repositories...")
+	if !s.beginScan() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer s.inflight.Done()
 
-	// Get organization name from environment
-	org := GetOrgNameFromEnv()
+	policy, err := s.resolvePolicy(req)
+	if err != nil {
+		return nil, err
+	}
+	if source := req.GetOrganizationPolicy(); source != "" {
+		if policy.Bundle != nil {
+			return nil, status.Error(codes.InvalidArgument, "organization_policy can't be combined with a bundle, which brings its own organization rules")
+		}
+		if err := validateOrganizationPolicy(ctx, source); err != nil {
+			return nil, err
+		}
+		policy.Organization = source
+	}
+
+	// Use the requested organization, falling back to the configured default
+	org := req.GetOrg()
 	if org == "" {
-		return &pb.PolicyResponse{Error: "ORG_NAME environment variable is missing"}, nil
+		org = s.config.Org
 	}
 
-	repositories := ScanOrganizationForGRPC(org, req.Policy)
+	// Every scan gets an ID that tags its log lines and is returned to the caller
+	scanID := newID()
+	ctx = withLogAttrs(ctx, "scan_id", scanID, "org", org)
+	grpc.SetHeader(ctx, metadata.Pairs(scanIDHeader, scanID))
+	slog.InfoContext(ctx, "Received gRPC request to scan repositories")
 
-	return &pb.PolicyResponse{Repositories: repositories}, nil
+	repositories, err := s.scanner.ScanOrganizationForGRPC(ctx, ScanRequest{
+		Endpoint: req.GetEndpoint(),
+		Org:      org,
+		Policy:   policy.Policy,
+		Backend:  req.GetBackend(),
+	})
+	resp := &pb.PolicyResponse{Repositories: repositories, ScanId: scanID}
+	policy.stamp(resp)
+	if err != nil {
+		slog.ErrorContext(ctx, "Scan failed", "error", err)
+		resp.Error = err.Error()
+	} else {
+		s.applyWaivers(ctx, policy, resp)
+		resp.Score = export.Score(resp.GetRepositories())
+		if policy.shadow != nil {
+			resp.Shadow = s.evaluateShadow(ctx, *policy.shadow, repositories)
+		}
+		if s.issues != nil {
+			resp.Issues = s.issues.sync(ctx, req.GetEndpoint(), policy.name, resp)
+		}
+		if policy.hasOrganizationRules() {
+			resp.Organization = s.scanner.EvaluateOrganization(ctx, req.GetEndpoint(), org, policy.Policy)
+		}
+		s.receiver.track(org, req.GetEndpoint(), policy, scanID)
+	}
+	s.notifier.notify(ctx, org, resp)
+	s.scans.put(resp, scanOrigin{org: org, fetched: err == nil})
+	return resp, nil
+}
+
+// returns a stored scan result by ID
+func (s *Server) GetScan(ctx context.Context, req *pb.GetScanRequest) (*pb.PolicyResponse, error) {
+	resp, _, err := s.storedScan(ctx, req.GetScanId())
+	return resp, err
+}
+
+// storedScan returns a stored scan once the caller is authorized for the
+// org it was made for, since the request names no org
+func (s *Server) storedScan(ctx context.Context, id string) (*pb.PolicyResponse, scanOrigin, error) {
+	resp, origin, ok := s.scans.get(id)
+	if !ok {
+		return nil, scanOrigin{}, status.Errorf(codes.NotFound, "scan %q not found", id)
+	}
+	if err := s.auth.authorizeOrg(ctx, origin.org); err != nil {
+		return nil, scanOrigin{}, err
+	}
+	return resp, origin, nil
 }
 
-// StartGRPCServer initializes and starts the gRPC server
-func StartGRPCServer(port string) {
-	lis, err := net.Listen("tcp", ":"+port)
+// evaluates a policy against stored or supplied repositories
+func (s *Server) EvaluatePolicy(ctx context.Context, req *pb.EvaluateRequest) (*pb.PolicyResponse, error) {
+	if !s.beginScan() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer s.inflight.Done()
+
+	policy, err := s.resolvePolicy(req)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		return nil, err
+	}
+
+	// Supplied repositories are the caller's, who was authorized for the
+	// default org
+	repos := req.GetRepositories()
+	origin := scanOrigin{org: s.config.Org}
+	if id := req.GetScanId(); id != "" {
+		stored, storedOrigin, err := s.storedScan(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		repos = stored.GetRepositories()
+		origin.org = storedOrigin.org
+	}
+	if len(repos) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "scan_id or repositories is required")
 	}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterPolicyServiceServer(grpcServer, &Server{})
+	scanID := newID()
+	ctx = withLogAttrs(ctx, "scan_id", scanID, "source_scan_id", req.GetScanId())
+	grpc.SetHeader(ctx, metadata.Pairs(scanIDHeader, scanID))
+	slog.InfoContext(ctx, "Received gRPC request to evaluate a policy", "repositories", len(repos))
 
-	log.Printf("gRPC server running on port %s...", port)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+	repositories, err := s.scanner.EvaluateRepositoriesForGRPC(ctx, policy.Policy, repos)
+	resp := &pb.PolicyResponse{Repositories: repositories, ScanId: scanID}
+	policy.stamp(resp)
+	if err != nil {
+		slog.ErrorContext(ctx, "Evaluation failed", "error", err)
+		resp.Error = err.Error()
+	} else {
+		s.applyWaivers(ctx, policy, resp)
+		resp.Score = export.Score(resp.GetRepositories())
+		if policy.shadow != nil {
+			resp.Shadow = s.evaluateShadow(ctx, *policy.shadow, repositories)
+		}
 	}
+	s.scans.put(resp, origin)
+	return resp, nil
 }
 
-func GetOrgNameFromEnv() string {
-	org := os.Getenv("ORG_NAME")
-	if org == "" {
-		log.Fatal("ORG_NAME is required in .env")
+var errRegistryDisabled = status.Error(codes.FailedPrecondition, "the policy registry is not configured (policies.registry)")
+
+// maps registry errors to gRPC status codes
+func registryError(err error) error {
+	switch {
+	case errors.Is(err, errPolicyNotFound), errors.Is(err, errVersionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errPolicyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, errInvalidPolicy):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errNoShadow):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "policy registry: %v", err)
+	}
+}
+
+// author of a policy version: the authenticated caller, else the request's
+func policyAuthor(ctx context.Context, requested string) string {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.Subject
+	}
+	return requested
+}
+
+// rejects policies that don't compile, before they are stored
+func validatePolicySource(ctx context.Context, source string) error {
+	if strings.TrimSpace(source) == "" {
+		return status.Error(codes.InvalidArgument, "source is required")
+	}
+	policy := Policy{Source: source}
+	if _, err := preparePolicy(ctx, policy); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid policy: %v", err)
+	}
+	if _, err := policy.annotatedSeverity(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid policy: %v", err)
+	}
+	return nil
+}
+
+// stores a new policy as version 1
+func (s *Server) CreatePolicy(ctx context.Context, req *pb.CreatePolicyRequest) (*pb.RegisteredPolicy, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	if err := validatePolicySource(ctx, req.GetSource()); err != nil {
+		return nil, err
+	}
+	p, err := s.registry.create(req.GetPolicyId(), req.GetDescription(), req.GetSource(), policyAuthor(ctx, req.GetAuthor()), req.GetComment())
+	if err != nil {
+		return nil, registryError(err)
+	}
+	slog.InfoContext(ctx, "Policy created", "policy_id", p.ID, "sha256", p.latest().SHA256)
+	return registeredPolicyToProto(p, p.latest()), nil
+}
+
+// adds a version to a registered policy, active or in shadow
+func (s *Server) UpdatePolicy(ctx context.Context, req *pb.UpdatePolicyRequest) (*pb.RegisteredPolicy, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	if err := validatePolicySource(ctx, req.GetSource()); err != nil {
+		return nil, err
+	}
+	p, err := s.registry.update(req.GetPolicyId(), req.GetDescription(), req.GetSource(), policyAuthor(ctx, req.GetAuthor()), req.GetComment(), req.GetShadow())
+	if err != nil {
+		return nil, registryError(err)
+	}
+	slog.InfoContext(ctx, "Policy updated", "policy_id", p.ID, "version", p.latest().Version, "sha256", p.latest().SHA256,
+		"active_version", p.Active, "shadow_version", p.Shadow)
+	return registeredPolicyToProto(p, p.latest()), nil
+}
+
+// marks a version of a registered policy as its shadow version
+func (s *Server) SetShadowVersion(ctx context.Context, req *pb.SetShadowVersionRequest) (*pb.RegisteredPolicy, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	p, err := s.registry.setShadow(req.GetPolicyId(), int(req.GetVersion()))
+	if err != nil {
+		return nil, registryError(err)
+	}
+	slog.InfoContext(ctx, "Policy shadow version set", "policy_id", p.ID, "active_version", p.Active, "shadow_version", p.Shadow)
+	return registeredPolicyToProto(p, p.active()), nil
+}
+
+// activates the shadow version of a registered policy
+func (s *Server) PromotePolicy(ctx context.Context, req *pb.PromotePolicyRequest) (*pb.RegisteredPolicy, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	p, err := s.registry.promote(req.GetPolicyId())
+	if err != nil {
+		return nil, registryError(err)
+	}
+	slog.InfoContext(ctx, "Policy shadow version promoted", "policy_id", p.ID, "active_version", p.Active)
+	return registeredPolicyToProto(p, p.active()), nil
+}
+
+// returns a version of a registered policy, the active one by default
+func (s *Server) GetPolicy(ctx context.Context, req *pb.GetPolicyRequest) (*pb.RegisteredPolicy, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	p, err := s.registry.get(req.GetPolicyId())
+	if err != nil {
+		return nil, registryError(err)
+	}
+	version, err := p.version(int(req.GetVersion()))
+	if err != nil {
+		return nil, registryError(err)
+	}
+	return registeredPolicyToProto(p, version), nil
+}
+
+// lists the registered policies with their active version
+func (s *Server) ListPolicies(ctx context.Context, req *pb.ListPoliciesRequest) (*pb.ListPoliciesResponse, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	resp := &pb.ListPoliciesResponse{}
+	for _, p := range s.registry.list() {
+		info := registeredPolicyToProto(p, p.active())
+		info.Version.Source = ""
+		info.Versions = nil
+		resp.Policies = append(resp.Policies, info)
+	}
+	return resp, nil
+}
+
+// removes a policy and its versions
+func (s *Server) DeletePolicy(ctx context.Context, req *pb.DeletePolicyRequest) (*pb.DeletePolicyResponse, error) {
+	if s.registry == nil {
+		return nil, errRegistryDisabled
+	}
+	if err := s.registry.delete(req.GetPolicyId()); err != nil {
+		return nil, registryError(err)
+	}
+	slog.InfoContext(ctx, "Policy deleted", "policy_id", req.GetPolicyId())
+	return &pb.DeletePolicyResponse{}, nil
+}
+
+func registeredPolicyToProto(p *registeredPolicy, version policyVersion) *pb.RegisteredPolicy {
+	resp := &pb.RegisteredPolicy{
+		PolicyId:      p.ID,
+		Description:   p.Description,
+		LatestVersion: int32(p.latest().Version),
+		ActiveVersion: int32(p.Active),
+		ShadowVersion: int32(p.Shadow),
+		CreatedAt:     p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     p.UpdatedAt.Format(time.RFC3339),
+		Version:       policyVersionToProto(version),
+	}
+	for _, v := range p.Versions {
+		v.Source = ""
+		resp.Versions = append(resp.Versions, policyVersionToProto(v))
+	}
+	return resp
+}
+
+func policyVersionToProto(v policyVersion) *pb.PolicyVersion {
+	return &pb.PolicyVersion{
+		Version:   int32(v.Version),
+		Source:    v.Source,
+		Sha256:    v.SHA256,
+		Author:    v.Author,
+		Comment:   v.Comment,
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// lists the policy bundles loaded at startup
+func (s *Server) ListBundles(ctx context.Context, req *pb.ListBundlesRequest) (*pb.ListBundlesResponse, error) {
+	resp := &pb.ListBundlesResponse{}
+	for _, b := range s.bundles.list() {
+		info := &pb.BundleInfo{Name: b.Name, Revision: b.Revision, Entrypoint: b.Entrypoint}
+		for _, module := range b.bundle.Modules {
+			// directories and tarballs root their paths differently
+			info.Modules = append(info.Modules, strings.TrimLeft(module.Path, "./"))
+		}
+		sort.Strings(info.Modules)
+		resp.Bundles = append(resp.Bundles, info)
+	}
+	return resp, nil
+}
+
+// renders stored scans in a report format
+func (s *Server) ExportScans(ctx context.Context, req *pb.ExportRequest) (*httpbody.HttpBody, error) {
+	format, scans, opts, err := s.exportScans(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := format.Write(&buf, scans, opts); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to export scans: %v", err)
+	}
+	return &httpbody.HttpBody{ContentType: format.ContentType, Data: buf.Bytes()}, nil
+}
+
+// streams a report of stored scans in chunks as the format writes it
+func (s *Server) StreamExport(req *pb.ExportRequest, stream pb.PolicyService_StreamExportServer) error {
+	format, scans, opts, err := s.exportScans(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(&chunkWriter{stream: stream, contentType: format.ContentType}, exportChunkSize)
+	if err := format.Write(w, scans, opts); err != nil {
+		return status.Errorf(codes.Internal, "failed to export scans: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		return status.Errorf(codes.Internal, "failed to export scans: %v", err)
+	}
+	return nil
+}
+
+// resolves the format and the stored scans of an export request
+func (s *Server) exportScans(ctx context.Context, req *pb.ExportRequest) (export.Format, []*pb.PolicyResponse, export.Options, error) {
+	format, err := export.Lookup(req.GetFormat())
+	if err != nil {
+		return export.Format{}, nil, export.Options{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(req.GetScanIds()) == 0 {
+		return export.Format{}, nil, export.Options{}, status.Error(codes.InvalidArgument, "at least one scan_id is required")
+	}
+
+	scans, err := s.storedScans(ctx, req.GetScanIds())
+	if err != nil {
+		return export.Format{}, nil, export.Options{}, err
+	}
+	previous, err := s.storedScans(ctx, req.GetPreviousScanIds())
+	if err != nil {
+		return export.Format{}, nil, export.Options{}, err
+	}
+	return format, scans, export.Options{Previous: previous}, nil
+}
+
+// looks up stored scans, failing with NotFound on the first unknown ID
+// and PermissionDenied on the first the caller may not read
+func (s *Server) storedScans(ctx context.Context, ids []string) ([]*pb.PolicyResponse, error) {
+	scans := make([]*pb.PolicyResponse, 0, len(ids))
+	for _, id := range ids {
+		scan, _, err := s.storedScan(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, nil
+}
+
+// size of the chunks sent by StreamExport
+const exportChunkSize = 64 * 1024
+
+// chunkWriter sends each write as an HttpBody message; the content type is
+// set on the first one only
+type chunkWriter struct {
+	stream      pb.PolicyService_StreamExportServer
+	contentType string
+	sent        bool
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	chunk := &httpbody.HttpBody{Data: p}
+	if !w.sent {
+		chunk.ContentType = w.contentType
+		w.sent = true
+	}
+	if err := w.stream.Send(chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// registers a new scan unless the server is draining
+func (s *Server) beginScan() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// drain stops accepting scans and waits for the in-flight ones, reporting
+// whether they all finished before the timeout
+func (s *Server) drain(timeout time.Duration) bool {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// StartGRPCServer initializes and starts the gRPC server, and shuts it down
+// gracefully on SIGTERM or SIGINT
+func StartGRPCServer(cfg *Config) {
+	lis, err := listen(cfg.Server.Listen)
+	if err != nil {
+		fatal("Failed to listen", "listen", cfg.Server.Listen, "error", err)
+	}
+
+	// Metrics come first so rejected calls are counted too, then the request
+	// ID so every later log line carries it
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(MetricsUnaryInterceptor, LoggingUnaryInterceptor),
+		grpc.ChainStreamInterceptor(MetricsStreamInterceptor, LoggingStreamInterceptor),
+	}
+	var tlsConfig, webhookTLSConfig *tls.Config
+	if cfg.Server.TLS.Enabled() {
+		reloader, err := newCertReloader(cfg.Server.TLS)
+		if err != nil {
+			fatal("Failed to configure TLS", "error", err)
+		}
+		tlsConfig = reloader.TLSConfig()
+		webhookTLSConfig = reloader.PublicTLSConfig()
+		slog.Info("TLS enabled", "client_certificates_required", cfg.Server.TLS.ClientCAFile != "")
+	}
+
+	var auth *Authenticator
+	if cfg.Auth.Enabled() {
+		var err error
+		auth, err = NewAuthenticator(cfg.Auth, cfg.Org)
+		if err != nil {
+			fatal("Failed to configure authentication", "error", err)
+		}
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(auth.UnaryInterceptor),
+			grpc.ChainStreamInterceptor(auth.StreamInterceptor),
+		)
+		slog.Info("Authentication enabled")
+	} else {
+		slog.Warn("Authentication is disabled, any caller can scan the organization")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	bundles, err := loadBundles(ctx, cfg.Policies.Bundles)
+	if err != nil {
+		fatal("Failed to load policy bundles", "error", err)
+	}
+	var registry *policyRegistry
+	if cfg.Policies.Registry != "" {
+		registry, err = openPolicyRegistry(cfg.Policies.Registry)
+		if err != nil {
+			fatal("Failed to open the policy registry", "error", err)
+		}
+	}
+	var waivers *waiverStore
+	if cfg.Policies.Waivers != "" {
+		waivers, err = openWaiverStore(cfg.Policies.Waivers)
+		if err != nil {
+			fatal("Failed to load the waivers", "error", err)
+		}
+	}
+	var audit *auditLog
+	if cfg.Remediation.AuditLog != "" {
+		audit, err = openAuditLog(cfg.Remediation.AuditLog)
+		if err != nil {
+			fatal("Failed to open the remediation audit log", "error", err)
+		}
+	}
+	server := NewServer(cfg, auth, bundles, registry, waivers, audit)
+	grpcOpts := opts
+	if tlsConfig != nil {
+		grpcOpts = append(slices.Clip(opts), grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	pb.RegisterPolicyServiceServer(grpcServer, server)
+	reflection.Register(grpcServer)
+
+	// Not serving until the GitHub credentials are known to work
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus(pb.PolicyService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, hs)
+	go verifyCredentialsAndServe(ctx, hs)
+
+	if cfg.Metrics.Listen != "" {
+		shutdownMetrics := startMetricsServer(cfg.Metrics.Listen)
+		defer shutdownMetrics(context.Background())
+	}
+
+	// The gateway shares the interceptors, so HTTP calls are authenticated,
+	// logged and counted like gRPC ones
+	var gw *gateway
+	if cfg.Gateway.Listen != "" {
+		gw, err = startGateway(cfg.Gateway.Listen, server, opts, tlsConfig)
+		if err != nil {
+			fatal("Failed to start the HTTP gateway", "error", err)
+		}
+	}
+	var webhooks *http.Server
+	if cfg.GitHub.WebhookListen != "" {
+		webhooks, err = startWebhookServer(cfg.GitHub.WebhookListen, server.receiver, webhookTLSConfig)
+		if err != nil {
+			fatal("Failed to start the GitHub webhook receiver", "error", err)
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("gRPC server listening", "listen", cfg.Server.Listen)
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal("Failed to serve", "error", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight scans", "timeout", cfg.Server.ShutdownTimeout.String())
+	hs.Shutdown()
+	if server.drain(cfg.Server.ShutdownTimeout.Duration) {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+		server.notifier.flush(flushCtx)
+		cancel()
+		gw.Shutdown(context.Background())
+		if webhooks != nil {
+			webhooks.Shutdown(context.Background())
+		}
+		grpcServer.GracefulStop()
+		slog.Info("Server stopped")
+	} else {
+		slog.Warn("In-flight scans did not finish in time, cancelling them")
+		gw.Close()
+		if webhooks != nil {
+			webhooks.Close()
+		}
+		grpcServer.Stop()
+	}
+}
+
+// listens on a TCP address or a Unix domain socket, replacing a stale socket file
+func listen(address string) (net.Listener, error) {
+	network, addr, err := listenNetwork(address)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := os.Remove(addr); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
 	}
-	return org
+	return net.Listen(network, addr)
 }
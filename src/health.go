@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	pb "github-scanner/src/pb"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const credentialCheckInterval = 30 * time.Second
+
+// verifyCredentialsAndServe keeps PolicyService NOT_SERVING until every
+// configured GitHub endpoint has accepted its token, retrying until then
+func verifyCredentialsAndServe(ctx context.Context, hs *health.Server) {
+	for {
+		err := verifyGitHubCredentials(ctx)
+		if err == nil {
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+			hs.SetServingStatus(pb.PolicyService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+			slog.Info("GitHub credentials verified, reporting SERVING")
+			return
+		}
+		slog.Warn("GitHub credential check failed, retrying", "retry_in", credentialCheckInterval.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(credentialCheckInterval):
+		}
+	}
+}
+
+// verifyGitHubCredentials fetches the authenticated user on every endpoint
+func verifyGitHubCredentials(ctx context.Context) error {
+	endpoints := getGitHubEndpoints()
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		client, err := getGitHubClient(endpoints[name])
+		if err != nil {
+			return err
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		user, _, err := client.Users.Get(checkCtx, "")
+		cancel()
+		if err != nil {
+			return err
+		}
+		slog.Info("GitHub endpoint authenticated", "github_endpoint", name, "login", user.GetLogin())
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v69/github"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// Actions taken on the issue of a repository
+const (
+	issueOpened    = "opened"
+	issueReopened  = "reopened"
+	issueUpdated   = "updated"
+	issueUnchanged = "unchanged"
+	issueClosed    = "closed"
+)
+
+// label of every issue the tracker opens
+const violationLabel = "policy-violation"
+
+// the digest of the details an issue was last written with, hidden in its body
+var issueDigestPattern = regexp.MustCompile(`<!-- github-scanner:details=([0-9a-f]+) -->`)
+
+// issueTracker keeps one GitHub issue per policy and violating repository,
+// found again through a fingerprint label
+type issueTracker struct {
+	config IssuesConfig
+}
+
+// issueFingerprint is the label identifying the issue of a policy and a
+// repository; GitHub names are case-insensitive
+func issueFingerprint(policy, repository string) string {
+	sum := sha256.Sum256([]byte(policy + "\x00" + strings.ToLower(repository)))
+	return "scanner-" + hex.EncodeToString(sum[:8])
+}
+
+// sync opens or updates the issues of the failed repositories of a scan and
+// closes those of repositories that comply or were waived. Repositories that
+// could not be evaluated are left alone. Compliant repositories are only
+// looked up when their fingerprint is among the open issues, found with one
+// search per org.
+func (t *issueTracker) sync(ctx context.Context, endpoint, policy string, resp *pb.PolicyResponse) []*pb.TrackedIssue {
+	if policy == "" {
+		slog.DebugContext(ctx, "Issues not synced for an unnamed policy")
+		return nil
+	}
+	open := make(map[string]map[string]bool)
+	var issues []*pb.TrackedIssue
+	for _, repo := range resp.GetRepositories() {
+		outcome := export.Outcome(repo)
+		if outcome != export.OutcomeFail && outcome != export.OutcomePass && outcome != export.OutcomeWaived {
+			continue
+		}
+		if outcome != export.OutcomeFail {
+			owner, scope := t.searchScope(repo)
+			fingerprints, ok := open[scope]
+			if !ok {
+				var err error
+				if fingerprints, err = t.openFingerprints(ctx, endpoint, owner, scope); err != nil {
+					// looked up one by one instead
+					slog.WarnContext(ctx, "Failed to search the open issues", "scope", scope, "error", err)
+				}
+				open[scope] = fingerprints
+			}
+			if fingerprints != nil && !fingerprints[issueFingerprint(policy, repo.GetFullName())] {
+				continue
+			}
+		}
+		issue, err := t.syncRepository(ctx, endpoint, policy, resp, repo, outcome == export.OutcomeFail)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to sync the issue of a repository", "repo", repo.GetFullName(), "error", err)
+			issue.Error = err.Error()
+			issueUpdates.WithLabelValues("error").Inc()
+		} else if issue.Action != "" {
+			issueUpdates.WithLabelValues(issue.Action).Inc()
+		}
+		if issue.Action != "" || issue.Error != "" {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// searchScope returns the owner of the issues of a repository and their
+// search qualifier: the configured issue repository, or the repository's org
+func (t *issueTracker) searchScope(repo *pb.RepositoryInfo) (string, string) {
+	if t.config.Repository != "" {
+		owner, _, _ := strings.Cut(t.config.Repository, "/")
+		return owner, "repo:" + t.config.Repository
+	}
+	return repo.GetOwner(), "org:" + repo.GetOwner()
+}
+
+// openFingerprints returns the fingerprint labels of the open issues the
+// tracker filed in a search scope
+func (t *issueTracker) openFingerprints(ctx context.Context, endpointName, owner, scope string) (map[string]bool, error) {
+	if t.config.Repository != "" {
+		endpointName = ""
+	}
+	client, err := issueClient(endpointName, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("%s is:issue is:open label:%s", scope, violationLabel)
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	fingerprints := make(map[string]bool)
+	for {
+		result, ghResp, err := client.Search.Issues(ctx, query, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range result.Issues {
+			for _, label := range issue.Labels {
+				if strings.HasPrefix(label.GetName(), "scanner-") {
+					fingerprints[label.GetName()] = true
+				}
+			}
+		}
+		if ghResp.NextPage == 0 {
+			return fingerprints, nil
+		}
+		opts.Page = ghResp.NextPage
+	}
+}
+
+// issueClient returns the client of the endpoint serving an issue repository's owner
+func issueClient(endpointName, owner string) (*github.Client, error) {
+	endpoint, err := resolveEndpoint(endpointName, owner)
+	if err != nil {
+		return nil, err
+	}
+	return getGitHubClient(endpoint)
+}
+
+func (t *issueTracker) syncRepository(ctx context.Context, endpointName, policy string, resp *pb.PolicyResponse, repo *pb.RepositoryInfo, failed bool) (*pb.TrackedIssue, error) {
+	tracked := &pb.TrackedIssue{Repository: repo.GetFullName(), IssueRepository: repo.GetFullName()}
+	if t.config.Repository != "" {
+		tracked.IssueRepository = t.config.Repository
+		endpointName = ""
+	}
+	owner, name, _ := strings.Cut(tracked.IssueRepository, "/")
+	client, err := issueClient(endpointName, owner)
+	if err != nil {
+		return tracked, err
+	}
+
+	fingerprint := issueFingerprint(policy, repo.GetFullName())
+	existing, _, err := client.Issues.ListByRepo(ctx, owner, name, &github.IssueListByRepoOptions{
+		State:       "all",
+		Labels:      []string{fingerprint},
+		Sort:        "created",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return tracked, fmt.Errorf("listing issues of %s: %w", tracked.IssueRepository, err)
+	}
+	var issue *github.Issue
+	if len(existing) > 0 {
+		issue = existing[0]
+		tracked.Number, tracked.Url = int32(issue.GetNumber()), issue.GetHTMLURL()
+	}
+
+	if !failed {
+		if issue == nil || issue.GetState() != "open" {
+			return tracked, nil
+		}
+		comment := fmt.Sprintf("The repository complies with policy **%s** as of scan `%s`, closing.", policy, resp.GetScanId())
+		if export.Outcome(repo) == export.OutcomeWaived {
+			comment = fmt.Sprintf("The violation of policy **%s** is waived as of scan `%s`, closing.", policy, resp.GetScanId())
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, name, issue.GetNumber(), &github.IssueComment{Body: github.Ptr(comment)}); err != nil {
+			return tracked, err
+		}
+		_, _, err := client.Issues.Edit(ctx, owner, name, issue.GetNumber(), &github.IssueRequest{State: github.Ptr("closed"), StateReason: github.Ptr("completed")})
+		if err != nil {
+			return tracked, err
+		}
+		tracked.Action = issueClosed
+		slog.InfoContext(ctx, "Closed the issue of a compliant repository", "repo", repo.GetFullName(), "issue", tracked.Url)
+		return tracked, nil
+	}
+
+	details := issueDetails(policy, resp, repo)
+	digest := issueDigest(details)
+	body := details + fmt.Sprintf("\n---\n_Reported by github-scanner in scan `%s`. This issue is closed automatically once the repository complies._\n<!-- github-scanner:details=%s -->\n", resp.GetScanId(), digest)
+
+	if issue == nil {
+		labels := append([]string{violationLabel, fingerprint}, t.config.Labels...)
+		created, _, err := client.Issues.Create(ctx, owner, name, &github.IssueRequest{
+			Title:  github.Ptr(fmt.Sprintf("Policy violation: %s in %s", policy, repo.GetFullName())),
+			Body:   github.Ptr(body),
+			Labels: &labels,
+		})
+		if err != nil {
+			return tracked, err
+		}
+		tracked.Action, tracked.Number, tracked.Url = issueOpened, int32(created.GetNumber()), created.GetHTMLURL()
+		slog.InfoContext(ctx, "Opened an issue for a violation", "repo", repo.GetFullName(), "issue", tracked.Url)
+		return tracked, nil
+	}
+
+	reopen := issue.GetState() != "open"
+	previous := ""
+	if m := issueDigestPattern.FindStringSubmatch(issue.GetBody()); m != nil {
+		previous = m[1]
+	}
+	if !reopen && previous == digest {
+		tracked.Action = issueUnchanged
+		return tracked, nil
+	}
+
+	update := &github.IssueRequest{Body: github.Ptr(body)}
+	comment := fmt.Sprintf("The details of the violation changed in scan `%s`:\n\n%s", resp.GetScanId(), details)
+	tracked.Action = issueUpdated
+	if reopen {
+		update.State = github.Ptr("open")
+		comment = fmt.Sprintf("The repository violates policy **%s** again as of scan `%s`:\n\n%s", policy, resp.GetScanId(), details)
+		tracked.Action = issueReopened
+	}
+	if _, _, err := client.Issues.Edit(ctx, owner, name, issue.GetNumber(), update); err != nil {
+		return tracked, err
+	}
+	if _, _, err := client.Issues.CreateComment(ctx, owner, name, issue.GetNumber(), &github.IssueComment{Body: github.Ptr(comment)}); err != nil {
+		return tracked, err
+	}
+	slog.InfoContext(ctx, "Updated the issue of a violation", "repo", repo.GetFullName(), "issue", tracked.Url, "action", tracked.Action)
+	return tracked, nil
+}
+
+// issueDetails describes a violation in Markdown. It only holds what
+// characterizes the violation, not the scan, so an unchanged violation
+// leaves the issue alone.
+func issueDetails(policy string, resp *pb.PolicyResponse, repo *pb.RepositoryInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repository **%s** violates policy **%s**.\n\n", repo.GetFullName(), policy)
+	if violations := repo.GetViolations(); len(violations) > 0 {
+		b.WriteString("Violations:\n\n")
+		for _, v := range violations {
+			fmt.Fprintf(&b, "- %s\n", v)
+		}
+		b.WriteString("\n")
+	}
+	if v := resp.GetPolicyVersion(); v != "" {
+		fmt.Fprintf(&b, "- Policy version: `%s`\n", v)
+	}
+	fmt.Fprintf(&b, "- Severity: %s\n", repo.GetSeverity())
+	fmt.Fprintf(&b, "- Visibility: %s\n", repo.GetVisibility())
+	protection := "none"
+	if bp := repo.GetBranchProtection(); bp != nil {
+		protection = describeProtection(bp)
+	}
+	fmt.Fprintf(&b, "- Default branch protection: %s\n", protection)
+	var admins []string
+	for _, perm := range repo.GetPermissions() {
+		if perm.GetRole() == "admin" {
+			admins = append(admins, perm.GetUsername())
+		}
+	}
+	if len(admins) > 0 {
+		fmt.Fprintf(&b, "- Admins: %s\n", strings.Join(admins, ", "))
+	}
+	if remediations := repo.GetRemediations(); len(remediations) > 0 {
+		b.WriteString("\nSuggested remediations:\n\n")
+		for _, action := range remediations {
+			fmt.Fprintf(&b, "- %s\n", planChange(repo, action).GetDescription())
+		}
+	}
+	return b.String()
+}
+
+func issueDigest(details string) string {
+	sum := sha256.Sum256([]byte(details))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github-scanner/src/pb"
+)
+
+type fakeIssue struct {
+	Number   int      `json:"number"`
+	Repo     string   `json:"-"`
+	State    string   `json:"state"`
+	Body     string   `json:"body"`
+	Labels   []string `json:"-"`
+	Comments []string `json:"-"`
+}
+
+// fakeIssues implements the issues and issue search API of GitHub in memory
+type fakeIssues struct {
+	mu     sync.Mutex
+	issues []*fakeIssue
+}
+
+func (f *fakeIssues) issueJSON(issue *fakeIssue) map[string]interface{} {
+	labels := make([]map[string]string, 0, len(issue.Labels))
+	for _, l := range issue.Labels {
+		labels = append(labels, map[string]string{"name": l})
+	}
+	return map[string]interface{}{
+		"number":   issue.Number,
+		"state":    issue.State,
+		"body":     issue.Body,
+		"labels":   labels,
+		"html_url": fmt.Sprintf("https://github.example/%s/issues/%d", issue.Repo, issue.Number),
+	}
+}
+
+func (f *fakeIssues) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+
+	if r.URL.Path == "/search/issues" {
+		// "org:acme is:issue is:open label:policy-violation"
+		var scope string
+		for _, term := range strings.Fields(r.URL.Query().Get("q")) {
+			if v, ok := strings.CutPrefix(term, "org:"); ok {
+				scope = v + "/"
+			} else if v, ok := strings.CutPrefix(term, "repo:"); ok {
+				scope = v
+			}
+		}
+		items := []map[string]interface{}{}
+		for _, issue := range f.issues {
+			if issue.State == "open" && slices.Contains(issue.Labels, violationLabel) && strings.HasPrefix(issue.Repo, scope) {
+				items = append(items, f.issueJSON(issue))
+			}
+		}
+		reply(map[string]interface{}{"total_count": len(items), "items": items})
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	if len(parts) < 3 || parts[2] != "issues" {
+		http.NotFound(w, r)
+		return
+	}
+	repo := parts[0] + "/" + parts[1]
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		label := r.URL.Query().Get("labels")
+		items := []map[string]interface{}{}
+		for i := len(f.issues) - 1; i >= 0; i-- {
+			if issue := f.issues[i]; issue.Repo == repo && slices.Contains(issue.Labels, label) {
+				items = append(items, f.issueJSON(issue))
+			}
+		}
+		reply(items)
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		var req struct {
+			Body   string   `json:"body"`
+			Labels []string `json:"labels"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		issue := &fakeIssue{Number: len(f.issues) + 1, Repo: repo, State: "open", Body: req.Body, Labels: req.Labels}
+		f.issues = append(f.issues, issue)
+		w.WriteHeader(http.StatusCreated)
+		reply(f.issueJSON(issue))
+	default:
+		number, _ := strconv.Atoi(parts[3])
+		if number < 1 || number > len(f.issues) {
+			http.NotFound(w, r)
+			return
+		}
+		issue := f.issues[number-1]
+		var req struct {
+			Body  *string `json:"body"`
+			State *string `json:"state"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case len(parts) == 5 && parts[4] == "comments" && r.Method == http.MethodPost:
+			issue.Comments = append(issue.Comments, *req.Body)
+			w.WriteHeader(http.StatusCreated)
+			reply(map[string]interface{}{"body": *req.Body})
+		case len(parts) == 4 && r.Method == http.MethodPatch:
+			if req.Body != nil {
+				issue.Body = *req.Body
+			}
+			if req.State != nil {
+				issue.State = *req.State
+			}
+			reply(f.issueJSON(issue))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func issueScan(id string, repos ...*pb.RepositoryInfo) *pb.PolicyResponse {
+	return &pb.PolicyResponse{ScanId: id, PolicyName: "branch-protection", Repositories: repos}
+}
+
+func failingRepo(name string, violations ...string) *pb.RepositoryInfo {
+	return &pb.RepositoryInfo{Name: name, Owner: "acme", FullName: "acme/" + name, ScanResult: "Failure", Severity: "high", Violations: violations}
+}
+
+func passingRepo(name string) *pb.RepositoryInfo {
+	return &pb.RepositoryInfo{Name: name, Owner: "acme", FullName: "acme/" + name, ScanResult: "Success"}
+}
+
+// issueActions summarizes the synced issues as "repository action"
+func issueActions(t *testing.T, issues []*pb.TrackedIssue) []string {
+	t.Helper()
+	var actions []string
+	for _, issue := range issues {
+		if issue.GetError() != "" {
+			t.Errorf("syncing the issue of %s: %s", issue.GetRepository(), issue.GetError())
+		}
+		actions = append(actions, issue.GetRepository()+" "+issue.GetAction())
+	}
+	return actions
+}
+
+func TestIssueLifecycle(t *testing.T) {
+	store := &fakeIssues{}
+	gh := newFakeGitHub(t, "acme", store.serve)
+	tracker := &issueTracker{config: IssuesConfig{Enabled: true, Labels: []string{"security"}}}
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		scan     *pb.PolicyResponse
+		actions  []string
+		requests []string
+	}{
+		{
+			name:    "open",
+			scan:    issueScan("scan-1", failingRepo("api", "default branch allows force pushes"), passingRepo("web"), passingRepo("docs")),
+			actions: []string{"acme/api opened"},
+			requests: []string{
+				"GET /repos/acme/api/issues",
+				"POST /repos/acme/api/issues",
+				"GET /search/issues",
+			},
+		},
+		{
+			name:     "unchanged",
+			scan:     issueScan("scan-2", failingRepo("api", "default branch allows force pushes"), passingRepo("web")),
+			actions:  []string{"acme/api unchanged"},
+			requests: []string{"GET /repos/acme/api/issues", "GET /search/issues"},
+		},
+		{
+			name:    "update",
+			scan:    issueScan("scan-3", failingRepo("api", "default branch allows force pushes", "default branch requires no reviews"), passingRepo("web")),
+			actions: []string{"acme/api updated"},
+			requests: []string{
+				"GET /repos/acme/api/issues",
+				"PATCH /repos/acme/api/issues/1",
+				"POST /repos/acme/api/issues/1/comments",
+				"GET /search/issues",
+			},
+		},
+		{
+			name:    "close",
+			scan:    issueScan("scan-4", passingRepo("api"), passingRepo("web")),
+			actions: []string{"acme/api closed"},
+			requests: []string{
+				"GET /search/issues",
+				"GET /repos/acme/api/issues",
+				"POST /repos/acme/api/issues/1/comments",
+				"PATCH /repos/acme/api/issues/1",
+			},
+		},
+		{
+			name:     "closed issues aren't looked up",
+			scan:     issueScan("scan-5", passingRepo("api"), passingRepo("web")),
+			requests: []string{"GET /search/issues"},
+		},
+		{
+			name:    "reopen",
+			scan:    issueScan("scan-6", failingRepo("api", "default branch allows force pushes")),
+			actions: []string{"acme/api reopened"},
+			requests: []string{
+				"GET /repos/acme/api/issues",
+				"PATCH /repos/acme/api/issues/1",
+				"POST /repos/acme/api/issues/1/comments",
+			},
+		},
+	}
+	seen := 0
+	for _, step := range steps {
+		actions := issueActions(t, tracker.sync(ctx, "", "branch-protection", step.scan))
+		if strings.Join(actions, "\n") != strings.Join(step.actions, "\n") {
+			t.Errorf("%s: got actions %q, want %q", step.name, actions, step.actions)
+		}
+		requests := gh.received()[seen:]
+		seen += len(requests)
+		if strings.Join(requests, "\n") != strings.Join(step.requests, "\n") {
+			t.Errorf("%s: GitHub received %q, want %q", step.name, requests, step.requests)
+		}
+
+		if step.name == "open" {
+			issue := store.issues[0]
+			if !slices.Contains(issue.Labels, violationLabel) || !slices.Contains(issue.Labels, "security") ||
+				!slices.Contains(issue.Labels, issueFingerprint("branch-protection", "acme/api")) {
+				t.Errorf("issue labels = %q", issue.Labels)
+			}
+			if !strings.Contains(issue.Body, "- default branch allows force pushes\n") {
+				t.Errorf("the issue body doesn't list the violations:\n%s", issue.Body)
+			}
+		}
+	}
+
+	issue := store.issues[0]
+	if len(store.issues) != 1 {
+		t.Errorf("got %d issues, want the same issue throughout", len(store.issues))
+	}
+	if issue.State != "open" {
+		t.Errorf("issue state = %q after the violation came back", issue.State)
+	}
+	if len(issue.Comments) != 3 {
+		t.Fatalf("got comments %q, want update, close and reopen", issue.Comments)
+	}
+	if !strings.Contains(issue.Comments[0], "default branch requires no reviews") {
+		t.Errorf("the update comment doesn't list the new violation: %q", issue.Comments[0])
+	}
+	if !strings.Contains(issue.Comments[1], "complies with policy **branch-protection** as of scan `scan-4`") {
+		t.Errorf("close comment = %q", issue.Comments[1])
+	}
+	if !strings.Contains(issue.Comments[2], "violates policy **branch-protection** again as of scan `scan-6`") {
+		t.Errorf("reopen comment = %q", issue.Comments[2])
+	}
+}
+
+func TestIssueSyncCentralRepository(t *testing.T) {
+	store := &fakeIssues{}
+	gh := newFakeGitHub(t, "acme", store.serve)
+	tracker := &issueTracker{config: IssuesConfig{Enabled: true, Repository: "acme/security"}}
+	ctx := context.Background()
+
+	tracker.sync(ctx, "", "branch-protection", issueScan("scan-1", failingRepo("api", "unprotected"), failingRepo("web", "unprotected")))
+	if len(store.issues) != 2 || store.issues[0].Repo != "acme/security" || store.issues[1].Repo != "acme/security" {
+		t.Fatalf("issues weren't opened in the central repository: %+v", store.issues)
+	}
+
+	seen := len(gh.received())
+	actions := issueActions(t, tracker.sync(ctx, "", "branch-protection", issueScan("scan-2", passingRepo("api"), passingRepo("web"), passingRepo("docs"))))
+	if want := []string{"acme/api closed", "acme/web closed"}; strings.Join(actions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got actions %q, want %q", actions, want)
+	}
+	var searches, lookups int
+	for _, request := range gh.received()[seen:] {
+		switch request {
+		case "GET /search/issues":
+			searches++
+		case "GET /repos/acme/security/issues":
+			lookups++
+		}
+	}
+	if searches != 1 {
+		t.Errorf("searched the open issues %d times, want once", searches)
+	}
+	if lookups != 2 {
+		t.Errorf("looked up %d issues, want only those of acme/api and acme/web", lookups)
+	}
+}
@@ -1,30 +1,50 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/joho/godotenv"
 )
 
-func loadEnv() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Warning: No .env file found!")
-	}
+func loadEnv() error {
+	return godotenv.Load()
 }
 
 func main() {
-	loadEnv()
+	envErr := loadEnv()
+
+	cfg, printOnly, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if printOnly {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("Failed to print configuration", "error", err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		fatal("Failed to set up logging", "error", err)
+	}
+	if envErr != nil {
+		slog.Warn("No .env file found")
+	}
+	configureGitHubEndpoints(cfg.GitHub.Endpoints)
 
-	org := os.Getenv("ORG_NAME")
-	if org == "" {
-		log.Fatal("ORG_NAME is required in .env")
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	fmt.Println("Starting gRPC Server for GitHub Scanner (Org:", org, ")")
+	fmt.Println("Starting gRPC Server for GitHub Scanner (Org:", cfg.Org, ")")
 
 	// Start the gRPC server
-	StartGRPCServer("50051")
+	StartGRPCServer(cfg)
 }
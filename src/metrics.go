@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	scansTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_scans_total",
+		Help: "Organization scans by outcome.",
+	}, []string{"org", "status"})
+
+	scanDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scanner_scan_duration_seconds",
+		Help:    "Duration of organization scans.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"org"})
+
+	reposProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_repositories_processed_total",
+		Help: "Repositories processed by scan stage (fetch, evaluate).",
+	}, []string{"stage"})
+
+	githubRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_github_requests_total",
+		Help: "Requests sent to the GitHub API by endpoint, route and HTTP status.",
+	}, []string{"github_endpoint", "route", "status"})
+
+	githubRateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scanner_github_rate_limit_remaining",
+		Help: "Remaining GitHub API rate limit as last reported by the API.",
+	}, []string{"github_endpoint", "resource"})
+
+	policyCompileDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scanner_policy_compile_seconds",
+		Help:    "Time spent compiling Rego policies.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	policyEvalDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scanner_policy_eval_seconds",
+		Help:    "Time spent evaluating a policy against one repository.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 14),
+	})
+
+	policyDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_policy_decisions_total",
+		Help: "Policy decisions by outcome (success, failure, error).",
+	}, []string{"outcome"})
+
+	shadowDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_shadow_decisions_total",
+		Help: "Decisions of shadow policy versions by outcome (success, failure, error).",
+	}, []string{"outcome"})
+
+	remediationChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_remediation_changes_total",
+		Help: "Remediation changes applied to GitHub by action and result (applied, failed).",
+	}, []string{"action", "result"})
+
+	issueUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_issue_updates_total",
+		Help: "Changes to the GitHub issues tracking violations by action (opened, reopened, updated, unchanged, closed, error).",
+	}, []string{"action"})
+
+	notificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_notifications_total",
+		Help: "Webhook notifications by webhook, event and result (delivered, failed).",
+	}, []string{"webhook", "event", "result"})
+
+	githubEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_github_events_total",
+		Help: "GitHub webhook deliveries by event and result (accepted, ignored, invalid_signature, invalid_payload, unavailable).",
+	}, []string{"event", "result"})
+
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_grpc_requests_total",
+		Help: "gRPC requests handled by method and status code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scanner_grpc_request_duration_seconds",
+		Help:    "Duration of gRPC requests by method.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 16),
+	}, []string{"method"})
+)
+
+// startMetricsServer serves /metrics on its own listener; the returned
+// function shuts it down
+func startMetricsServer(address string) func(context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		slog.Info("Metrics server listening", "listen", address)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	return srv.Shutdown
+}
+
+// metricsTransport counts GitHub API calls and records the rate limit headers
+type metricsTransport struct {
+	endpoint string
+	base     http.RoundTripper
+}
+
+func newMetricsTransport(endpoint string, base http.RoundTripper) http.RoundTripper {
+	return &metricsTransport{endpoint: endpoint, base: base}
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+			if n, err := strconv.ParseFloat(remaining, 64); err == nil {
+				resource := resp.Header.Get("X-RateLimit-Resource")
+				if resource == "" {
+					resource = "core"
+				}
+				githubRateLimitRemaining.WithLabelValues(t.endpoint, resource).Set(n)
+			}
+		}
+	}
+	githubRequests.WithLabelValues(t.endpoint, githubRoute(req.Method, req.URL.Path), code).Inc()
+	return resp, err
+}
+
+var (
+	routeParams = map[string][]int{
+		// first path segment -> positions (0-based, after the prefix) holding names
+		"repos": {1, 2},
+		"orgs":  {1},
+		"users": {1},
+	}
+	routeSubParams = map[string]bool{"collaborators": true, "teams": true, "members": true, "branches": true, "issues": true}
+)
+
+// githubRoute turns a request path into a low-cardinality route template,
+// e.g. GET /repos/{owner}/{repo}/collaborators/{name}/permission
+func githubRoute(method, path string) string {
+	// GHES serves the API below /api/v3 and /api/graphql
+	path = strings.TrimPrefix(path, "/api/v3")
+	if path == "/api/graphql" {
+		path = "/graphql"
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 {
+		for _, i := range routeParams[segments[0]] {
+			if i < len(segments) {
+				segments[i] = "{name}"
+			}
+		}
+	}
+	// Names that follow a collection segment (collaborators/{name}, teams/{slug}, ...)
+	for i := 1; i < len(segments); i++ {
+		if routeSubParams[segments[i-1]] && segments[i] != "{name}" {
+			segments[i] = "{name}"
+		}
+	}
+	return method + " /" + strings.Join(segments, "/")
+}
+
+// MetricsUnaryInterceptor records the count and latency of unary RPCs
+func MetricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+// MetricsStreamInterceptor records the count and latency of streaming RPCs
+func MetricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
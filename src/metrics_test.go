@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestGitHubRoute(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/orgs/acme/repos", "GET /orgs/{name}/repos"},
+		{"GET", "/api/v3/orgs/acme/actions/permissions", "GET /orgs/{name}/actions/permissions"},
+		{"POST", "/api/graphql", "POST /graphql"},
+		{"POST", "/graphql", "POST /graphql"},
+		{"GET", "/users/octocat", "GET /users/{name}"},
+		{"GET", "/repos/acme/api/collaborators/octocat/permission", "GET /repos/{name}/{name}/collaborators/{name}/permission"},
+		{"PUT", "/repos/acme/api/branches/main/protection", "PUT /repos/{name}/{name}/branches/{name}/protection"},
+		{"GET", "/repos/acme/api/teams", "GET /repos/{name}/{name}/teams"},
+		{"GET", "/orgs/acme/teams/platform/members", "GET /orgs/{name}/teams/{name}/members"},
+		{"GET", "/repos/acme/api/issues", "GET /repos/{name}/{name}/issues"},
+		{"PATCH", "/repos/acme/api/issues/42", "PATCH /repos/{name}/{name}/issues/{name}"},
+		{"POST", "/api/v3/repos/acme/api/issues/42/comments", "POST /repos/{name}/{name}/issues/{name}/comments"},
+		{"GET", "/search/issues", "GET /search/issues"},
+	}
+	for _, tt := range tests {
+		if got := githubRoute(tt.method, tt.path); got != tt.want {
+			t.Errorf("githubRoute(%s, %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
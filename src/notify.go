@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// Notification events
+const (
+	eventScanCompleted   = "scan_completed"
+	eventDecisionChanged = "decision_changed"
+)
+
+// Webhook payload formats
+const (
+	webhookJSON  = "json"
+	webhookSlack = "slack"
+	webhookTeams = "teams"
+)
+
+// signature of the payload, as GitHub signs its webhooks
+const signatureHeader = "X-Scanner-Signature-256"
+
+// each delivery attempt is cut off after this long
+const webhookTimeout = 10 * time.Second
+
+func (w WebhookConfig) format() string {
+	if w.Format == "" {
+		return webhookJSON
+	}
+	return w.Format
+}
+
+func (w WebhookConfig) wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// selects reports whether the webhook is notified of the policy's scans of org
+func (w WebhookConfig) selects(policy, org string) bool {
+	if len(w.Orgs) > 0 && !slices.ContainsFunc(w.Orgs, func(o string) bool { return strings.EqualFold(o, org) }) {
+		return false
+	}
+	if len(w.Policies) == 0 {
+		return true
+	}
+	for _, pattern := range w.Policies {
+		if ok, _ := path.Match(pattern, policy); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// severe reports whether a violation of the severity is at least the
+// webhook's minimum
+func (w WebhookConfig) severe(severity string) bool {
+	if w.MinSeverity == "" {
+		return true
+	}
+	minimum, _ := export.ParseSeverity(w.MinSeverity)
+	return export.SeverityWeight(severity) >= export.SeverityWeight(minimum)
+}
+
+func (c NotificationsConfig) validate(add func(format string, args ...interface{})) {
+	if len(c.Webhooks) == 0 {
+		return
+	}
+	if c.MaxAttempts < 1 {
+		add("notifications.max_attempts must be at least 1, got %d", c.MaxAttempts)
+	}
+	if c.Backoff.Duration <= 0 {
+		add("notifications.backoff must be positive")
+	}
+	if c.MaxBackoff.Duration < c.Backoff.Duration {
+		add("notifications.max_backoff must be at least notifications.backoff")
+	}
+	names := make(map[string]bool)
+	for i, w := range c.Webhooks {
+		field := fmt.Sprintf("notifications.webhooks[%d]", i)
+		switch {
+		case w.Name == "":
+			add("%s.name is required", field)
+		case names[w.Name]:
+			add("%s.name %q is used twice", field, w.Name)
+		}
+		names[w.Name] = true
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("%s.url must be an http(s) URL", field)
+		}
+		switch w.format() {
+		case webhookJSON, webhookSlack, webhookTeams:
+		default:
+			add("%s.format must be %q, %q or %q, got %q", field, webhookJSON, webhookSlack, webhookTeams, w.Format)
+		}
+		for _, event := range w.Events {
+			if event != eventScanCompleted && event != eventDecisionChanged {
+				add("%s.events: unknown event %q, use %s or %s", field, event, eventScanCompleted, eventDecisionChanged)
+			}
+		}
+		for _, pattern := range w.Policies {
+			if _, err := path.Match(pattern, ""); err != nil {
+				add("%s.policies: invalid glob %q", field, pattern)
+			}
+		}
+		if _, ok := export.ParseSeverity(w.MinSeverity); w.MinSeverity != "" && !ok {
+			add("%s.min_severity must be one of %s, got %q", field, strings.Join(export.Severities, ", "), w.MinSeverity)
+		}
+	}
+}
+
+// envName turns a webhook name into its part of an environment variable name
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// notification is the payload of json webhooks
+type notification struct {
+	Event         string    `json:"event"`
+	DeliveryID    string    `json:"delivery_id"`
+	Time          time.Time `json:"time"`
+	Org           string    `json:"org"`
+	Policy        string    `json:"policy"`
+	PolicyVersion string    `json:"policy_version,omitempty"`
+	ScanID        string    `json:"scan_id"`
+	// set when the scan failed
+	Error string `json:"error,omitempty"`
+	// scan_completed
+	Summary *notificationSummary `json:"summary,omitempty"`
+	// decision_changed: violations not notified before, and notified ones
+	// that were fixed or waived since
+	NewViolations []notifiedViolation `json:"new_violations,omitempty"`
+	Resolved      []notifiedViolation `json:"resolved,omitempty"`
+}
+
+type notificationSummary struct {
+	Repositories    int              `json:"repositories"`
+	Passed          int              `json:"passed"`
+	Failed          int              `json:"failed"`
+	Waived          int              `json:"waived"`
+	Errors          int              `json:"errors"`
+	ComplianceScore float64          `json:"compliance_score"`
+	RiskScore       int32            `json:"risk_score"`
+	Failures        map[string]int32 `json:"failures"`
+}
+
+type notifiedViolation struct {
+	Repository string `json:"repository"`
+	URL        string `json:"url"`
+	Severity   string `json:"severity"`
+	RiskScore  int32  `json:"risk_score,omitempty"`
+}
+
+// notifier posts scan notifications to webhooks. It remembers the violations
+// each webhook was notified of, so a violation is notified once, then again
+// when it is resolved. The memory is lost on restart.
+type notifier struct {
+	config NotificationsConfig
+	client *http.Client
+
+	mu sync.Mutex
+	// webhook name -> policy and repository -> violation
+	sent map[string]map[string]notifiedViolation
+
+	deliveries sync.WaitGroup
+	// cancelled once flush gives up on the deliveries in flight
+	stopped context.Context
+	stop    context.CancelFunc
+}
+
+func newNotifier(config NotificationsConfig) *notifier {
+	stopped, stop := context.WithCancel(context.Background())
+	return &notifier{
+		config:  config,
+		stopped: stopped,
+		stop:    stop,
+		client:  &http.Client{Timeout: webhookTimeout},
+		sent:    make(map[string]map[string]notifiedViolation),
+	}
+}
+
+func violationKey(policy, repository string) string {
+	return policy + "\x00" + strings.ToLower(repository)
+}
+
+// policyIdentity tells policies apart in the state kept across their scans:
+// by name, or by the SHA-256 of the source of unnamed inline policies, which
+// would otherwise share the empty name
+func policyIdentity(name, sha256 string) string {
+	if name != "" {
+		return name
+	}
+	return "sha256:" + sha256
+}
+
+// notify sends the notifications of a scan of org in the background
+func (n *notifier) notify(ctx context.Context, org string, resp *pb.PolicyResponse) {
+	n.dispatch(ctx, org, resp, true)
+}
+
+// notifyChanges sends the decision_changed notifications of a scan updated
+// by GitHub events
+func (n *notifier) notifyChanges(ctx context.Context, org string, resp *pb.PolicyResponse) {
+	n.dispatch(ctx, org, resp, false)
+}
+
+func (n *notifier) dispatch(ctx context.Context, org string, resp *pb.PolicyResponse, completed bool) {
+	if n == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, w := range n.config.Webhooks {
+		if !w.selects(resp.GetPolicyName(), org) {
+			continue
+		}
+		base := notification{
+			Org:           org,
+			Policy:        resp.GetPolicyName(),
+			PolicyVersion: resp.GetPolicyVersion(),
+			ScanID:        resp.GetScanId(),
+			Error:         resp.GetError(),
+		}
+		if completed && w.wants(eventScanCompleted) && (resp.GetError() != "" || n.hasSevere(w, resp)) {
+			msg := base
+			msg.Event = eventScanCompleted
+			msg.Summary = summarize(resp)
+			n.send(ctx, w, msg, nil)
+		}
+		if w.wants(eventDecisionChanged) && resp.GetError() == "" {
+			msg := base
+			msg.Event = eventDecisionChanged
+			var undo func()
+			msg.NewViolations, msg.Resolved, undo = n.changes(w, resp)
+			if len(msg.NewViolations) > 0 || len(msg.Resolved) > 0 {
+				n.send(ctx, w, msg, undo)
+			}
+		}
+	}
+}
+
+// hasSevere reports whether the scan matters to a webhook with a minimum
+// severity: without one every scan does
+func (n *notifier) hasSevere(w WebhookConfig, resp *pb.PolicyResponse) bool {
+	if w.MinSeverity == "" {
+		return true
+	}
+	for _, repo := range resp.GetRepositories() {
+		if export.Outcome(repo) == export.OutcomeFail && w.severe(repo.GetSeverity()) {
+			return true
+		}
+	}
+	return false
+}
+
+func summarize(resp *pb.PolicyResponse) *notificationSummary {
+	score := export.Score(resp.GetRepositories())
+	summary := &notificationSummary{
+		Repositories:    len(resp.GetRepositories()),
+		ComplianceScore: score.GetComplianceScore(),
+		RiskScore:       score.GetRiskScore(),
+		Failures:        score.GetFailures(),
+	}
+	for _, repo := range resp.GetRepositories() {
+		switch export.Outcome(repo) {
+		case export.OutcomePass:
+			summary.Passed++
+		case export.OutcomeFail:
+			summary.Failed++
+		case export.OutcomeWaived:
+			summary.Waived++
+		default:
+			summary.Errors++
+		}
+	}
+	return summary
+}
+
+// changes compares a scan with what the webhook was notified of, and records
+// the scan's violations as notified. A violation is new when it was not
+// notified before or its severity changed. undo forgets the record, for
+// deliveries that fail.
+func (n *notifier) changes(w WebhookConfig, resp *pb.PolicyResponse) (added, resolved []notifiedViolation, undo func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := n.sent[w.Name]
+	if sent == nil {
+		sent = make(map[string]notifiedViolation)
+		n.sent[w.Name] = sent
+	}
+
+	policy := policyIdentity(resp.GetPolicyName(), resp.GetPolicySha256())
+	previous := make(map[string]notifiedViolation)
+	for _, repo := range resp.GetRepositories() {
+		key := violationKey(policy, repo.GetFullName())
+		old, notified := sent[key]
+		switch export.Outcome(repo) {
+		case export.OutcomeFail:
+			if !w.severe(repo.GetSeverity()) {
+				continue
+			}
+			v := notifiedViolation{Repository: repo.GetFullName(), URL: repo.GetRepoUrl(), Severity: repo.GetSeverity(), RiskScore: repo.GetRiskScore()}
+			if notified && old.Severity == v.Severity {
+				continue
+			}
+			if notified {
+				previous[key] = old
+			}
+			sent[key] = v
+			added = append(added, v)
+		case export.OutcomePass, export.OutcomeWaived:
+			if notified {
+				previous[key] = old
+				delete(sent, key)
+				resolved = append(resolved, old)
+			}
+		}
+	}
+
+	undo = func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		for _, v := range added {
+			delete(sent, violationKey(policy, v.Repository))
+		}
+		for key, v := range previous {
+			sent[key] = v
+		}
+	}
+	return added, resolved, undo
+}
+
+// send delivers a notification in the background, retrying with backoff;
+// onFailure runs when every attempt failed
+func (n *notifier) send(ctx context.Context, w WebhookConfig, msg notification, onFailure func()) {
+	msg.DeliveryID = newID()
+	msg.Time = time.Now().UTC()
+	body, err := formatNotification(w.format(), msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to format a notification", "webhook", w.Name, "error", err)
+		return
+	}
+
+	n.deliveries.Add(1)
+	go func() {
+		defer n.deliveries.Done()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer context.AfterFunc(n.stopped, cancel)()
+
+		logger := slog.With("webhook", w.Name, "event", msg.Event, "delivery_id", msg.DeliveryID)
+		drop := func(attempts int, err error) {
+			notificationsSent.WithLabelValues(w.Name, msg.Event, "failed").Inc()
+			logger.WarnContext(ctx, "Notification dropped", "attempts", attempts, "error", err)
+			if onFailure != nil {
+				onFailure()
+			}
+		}
+		backoff := n.config.Backoff.Duration
+		for attempt := 1; ; attempt++ {
+			retryAfter, err := n.post(ctx, w, msg, body)
+			if err == nil {
+				notificationsSent.WithLabelValues(w.Name, msg.Event, "delivered").Inc()
+				logger.DebugContext(ctx, "Notification delivered", "attempt", attempt)
+				return
+			}
+			if retryAfter < 0 || attempt >= n.config.MaxAttempts {
+				drop(attempt, err)
+				return
+			}
+			wait := max(backoff, retryAfter)
+			logger.InfoContext(ctx, "Notification failed, retrying", "attempt", attempt, "retry_in", wait.String(), "error", err)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				drop(attempt, err)
+				return
+			}
+			backoff = min(backoff*2, n.config.MaxBackoff.Duration)
+		}
+	}()
+}
+
+// post makes one delivery attempt. On failure, retryAfter is the wait the
+// endpoint asked for, at most the maximum backoff, or negative when retrying
+// is pointless.
+func (n *notifier) post(ctx context.Context, w WebhookConfig, msg notification, body []byte) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "github-scanner")
+	req.Header.Set("X-Scanner-Event", msg.Event)
+	req.Header.Set("X-Scanner-Delivery", msg.DeliveryID)
+	if w.Secret != "" {
+		req.Header.Set(signatureHeader, signPayload(w.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		retryAfter = min(time.Duration(max(seconds, 0))*time.Second, n.config.MaxBackoff.Duration)
+		return retryAfter, fmt.Errorf("%s: %s", w.Name, resp.Status)
+	default:
+		return -1, fmt.Errorf("%s: %s", w.Name, resp.Status)
+	}
+}
+
+// signPayload is "sha256=" and the hex HMAC-SHA256 of the body
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// flush waits for the deliveries in flight, at most until ctx is done
+func (n *notifier) flush(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		n.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		n.stop()
+		slog.Warn("Notifications still in flight were dropped")
+	}
+}
+
+// formatNotification renders a notification as the webhook's format expects
+func formatNotification(format string, msg notification) ([]byte, error) {
+	switch format {
+	case webhookSlack:
+		return json.Marshal(map[string]string{"text": notificationText(msg, slackLink, slackBold)})
+	case webhookTeams:
+		return json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  notificationTitle(msg),
+			"title":    notificationTitle(msg),
+			"text":     notificationText(msg, markdownLink, markdownBold),
+		})
+	default:
+		return json.Marshal(msg)
+	}
+}
+
+func slackLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return "<" + url + "|" + text + ">"
+}
+
+func slackBold(text string) string {
+	return "*" + text + "*"
+}
+
+func markdownBold(text string) string {
+	return "**" + text + "**"
+}
+
+func markdownLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return "[" + text + "](" + url + ")"
+}
+
+func notificationTitle(msg notification) string {
+	switch {
+	case msg.Error != "":
+		return fmt.Sprintf("Scan of %s with policy %s failed", msg.Org, msg.Policy)
+	case msg.Event == eventScanCompleted:
+		return fmt.Sprintf("Scan of %s with policy %s completed", msg.Org, msg.Policy)
+	default:
+		return fmt.Sprintf("Policy %s in %s: %d new and %d resolved violations", msg.Policy, msg.Org, len(msg.NewViolations), len(msg.Resolved))
+	}
+}
+
+// notificationText is the chat message of a notification, with links and
+// bold text rendered by link and bold
+func notificationText(msg notification, link func(text, url string) string, bold func(text string) string) string {
+	var b strings.Builder
+	b.WriteString(bold(notificationTitle(msg)) + "\n")
+	switch {
+	case msg.Error != "":
+		fmt.Fprintf(&b, "%s\n", msg.Error)
+	case msg.Summary != nil:
+		s := msg.Summary
+		fmt.Fprintf(&b, "%d passed, %d failed, %d waived, %d errors. Compliance score %.1f, risk %d.\n",
+			s.Passed, s.Failed, s.Waived, s.Errors, s.ComplianceScore, s.RiskScore)
+	}
+	for _, v := range msg.NewViolations {
+		fmt.Fprintf(&b, "- %s violates the policy (%s)\n", link(v.Repository, v.URL), v.Severity)
+	}
+	for _, v := range msg.Resolved {
+		fmt.Fprintf(&b, "- %s complies again\n", link(v.Repository, v.URL))
+	}
+	fmt.Fprintf(&b, "Scan `%s`", msg.ScanID)
+	return b.String()
+}
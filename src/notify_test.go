@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github-scanner/src/pb"
+)
+
+// webhookServer answers 429 with a Retry-After of an hour until the
+// failures are used up, then 204
+func webhookServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &attempts
+}
+
+func TestNotifierCapsRetryAfter(t *testing.T) {
+	srv, attempts := webhookServer(t, 2)
+	n := newNotifier(NotificationsConfig{
+		MaxAttempts: 3,
+		Backoff:     Duration{time.Millisecond},
+		MaxBackoff:  Duration{10 * time.Millisecond},
+	})
+	w := WebhookConfig{Name: "test", URL: srv.URL}
+
+	retryAfter, err := n.post(context.Background(), w, notification{Event: eventScanCompleted}, []byte(`{}`))
+	if err == nil {
+		t.Fatal("a 429 response was delivered")
+	}
+	if retryAfter != 10*time.Millisecond {
+		t.Errorf("retryAfter = %s, want the maximum backoff", retryAfter)
+	}
+
+	failed := false
+	n.send(context.Background(), w, notification{Event: eventScanCompleted}, func() { failed = true })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n.flush(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("the retries waited for the Retry-After of the response")
+	}
+	// the post above used up the first failure: one retry after the second
+	if failed || attempts.Load() != 3 {
+		t.Errorf("failed %v after %d requests, want delivered on the third", failed, attempts.Load())
+	}
+}
+
+func TestNotifierFlushStopsRetries(t *testing.T) {
+	srv, attempts := webhookServer(t, 100)
+	n := newNotifier(NotificationsConfig{
+		MaxAttempts: 3,
+		Backoff:     Duration{time.Hour},
+		MaxBackoff:  Duration{time.Hour},
+	})
+
+	failed := make(chan struct{})
+	n.send(context.Background(), WebhookConfig{Name: "test", URL: srv.URL}, notification{Event: eventScanCompleted}, func() { close(failed) })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	n.flush(ctx)
+
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery kept waiting to retry after flush gave up")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestNotifierTellsUnnamedPoliciesApart(t *testing.T) {
+	n := newNotifier(NotificationsConfig{})
+	w := WebhookConfig{Name: "test"}
+	scan := func(sha256, result string) *pb.PolicyResponse {
+		return &pb.PolicyResponse{
+			PolicySha256: sha256,
+			Repositories: []*pb.RepositoryInfo{{FullName: "acme/api", ScanResult: result, Severity: "high"}},
+		}
+	}
+
+	added, _, _ := n.changes(w, scan("aaa", "Failure"))
+	if len(added) != 1 {
+		t.Fatalf("got %d new violations, want 1", len(added))
+	}
+	if _, resolved, _ := n.changes(w, scan("bbb", "Success")); len(resolved) > 0 {
+		t.Errorf("another unnamed policy resolved %v", resolved)
+	}
+	if added, _, _ := n.changes(w, scan("aaa", "Failure")); len(added) > 0 {
+		t.Errorf("the violation was notified again: %v", added)
+	}
+	if _, resolved, _ := n.changes(w, scan("aaa", "Success")); len(resolved) != 1 {
+		t.Errorf("got %d resolved violations, want 1", len(resolved))
+	}
+}
+
+func TestFormatNotificationBoldTitle(t *testing.T) {
+	msg := notification{Event: eventScanCompleted, Org: "acme", Policy: "visibility", ScanID: "s1", Summary: &notificationSummary{}}
+	for format, want := range map[string]string{
+		webhookSlack: `"text":"*Scan of acme with policy visibility completed*\n`,
+		webhookTeams: `"text":"**Scan of acme with policy visibility completed**\n`,
+	} {
+		body, err := formatNotification(format, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%s: %s doesn't contain %s", format, body, want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v69/github"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// query of the organization-level rules, unless a bundle names another
+const organizationEntrypoint = "data.organization"
+
+// OrganizationSettings is the input of the organization-level rules
+type OrganizationSettings struct {
+	Login                                string `json:"login"`
+	TwoFactorRequirementEnabled          bool   `json:"two_factor_requirement_enabled"`
+	DefaultRepositoryPermission          string `json:"default_repository_permission"`
+	MembersCanCreatePublicRepositories   bool   `json:"members_can_create_public_repositories"`
+	MembersCanCreatePrivateRepositories  bool   `json:"members_can_create_private_repositories"`
+	MembersCanCreateInternalRepositories bool   `json:"members_can_create_internal_repositories"`
+	MembersCanForkPrivateRepositories    bool   `json:"members_can_fork_private_repositories"`
+	WebCommitSignoffRequired             bool   `json:"web_commit_signoff_required"`
+	// nil when the token may not read the Actions permissions
+	Actions *ActionsSettings `json:"actions"`
+}
+
+type ActionsSettings struct {
+	EnabledRepositories string   `json:"enabled_repositories"`
+	AllowedActions      string   `json:"allowed_actions"`
+	GitHubOwnedAllowed  bool     `json:"github_owned_allowed"`
+	VerifiedAllowed     bool     `json:"verified_allowed"`
+	PatternsAllowed     []string `json:"patterns_allowed"`
+}
+
+func (p Policy) organizationEntrypoint() string {
+	if p.Bundle != nil {
+		return p.Bundle.OrganizationEntrypoint
+	}
+	return organizationEntrypoint
+}
+
+// hasOrganizationRules reports whether a module of the policy declares the
+// package of the organization-level rules
+func (p Policy) hasOrganizationRules() bool {
+	for _, m := range p.modules() {
+		module, err := ast.ParseModuleWithOpts(m.path, string(m.source), ast.ParserOptions{RegoVersion: ast.RegoV1})
+		if err == nil && module.Package.Path.String() == p.organizationEntrypoint() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOrganizationPolicy rejects an organization module that doesn't
+// compile or doesn't declare package organization
+func validateOrganizationPolicy(ctx context.Context, source string) error {
+	module, err := ast.ParseModuleWithOpts("organization.rego", source, ast.ParserOptions{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid organization_policy: %v", err)
+	}
+	if module.Package.Path.String() != organizationEntrypoint {
+		return status.Errorf(codes.InvalidArgument, "organization_policy must declare package organization, not %s", module.Package.Path)
+	}
+	r := rego.New(rego.Query(organizationEntrypoint), rego.Module("organization.rego", source))
+	if _, err := r.PrepareForEval(ctx); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid organization_policy: %v", err)
+	}
+	if _, err := (Policy{Organization: source}).severityOf(organizationEntrypoint); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid organization_policy: %v", err)
+	}
+	return nil
+}
+
+// FetchOrganizationSettings reads the organization-level controls. GitHub
+// leaves out the settings only owners may read for other tokens, which is an
+// error rather than false; Actions permissions are left out when they can't
+// be read.
+func FetchOrganizationSettings(ctx context.Context, org string, client *github.Client) (*OrganizationSettings, error) {
+	o, _, err := client.Organizations.Get(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching organization %s: %w", org, err)
+	}
+	if missing := ownerOnlySettings(o); len(missing) > 0 {
+		return nil, fmt.Errorf("organization %s: %s can only be read by an owner of the organization", org, strings.Join(missing, ", "))
+	}
+	settings := &OrganizationSettings{
+		Login:                                o.GetLogin(),
+		TwoFactorRequirementEnabled:          o.GetTwoFactorRequirementEnabled(),
+		DefaultRepositoryPermission:          o.GetDefaultRepoPermission(),
+		MembersCanCreatePublicRepositories:   o.GetMembersCanCreatePublicRepos(),
+		MembersCanCreatePrivateRepositories:  o.GetMembersCanCreatePrivateRepos(),
+		MembersCanCreateInternalRepositories: o.GetMembersCanCreateInternalRepos(),
+		MembersCanForkPrivateRepositories:    o.GetMembersCanForkPrivateRepos(),
+		WebCommitSignoffRequired:             o.GetWebCommitSignoffRequired(),
+	}
+
+	permissions, _, err := client.Actions.GetActionsPermissions(ctx, org)
+	if err != nil {
+		slog.WarnContext(ctx, "Error fetching Actions permissions", "org", org, "error", err)
+		return settings, nil
+	}
+	settings.Actions = &ActionsSettings{
+		EnabledRepositories: permissions.GetEnabledRepositories(),
+		AllowedActions:      permissions.GetAllowedActions(),
+	}
+	if permissions.GetAllowedActions() == "selected" {
+		allowed, _, err := client.Actions.GetActionsAllowed(ctx, org)
+		if err != nil {
+			slog.WarnContext(ctx, "Error fetching allowed Actions", "org", org, "error", err)
+			return settings, nil
+		}
+		settings.Actions.GitHubOwnedAllowed = allowed.GetGithubOwnedAllowed()
+		settings.Actions.VerifiedAllowed = allowed.GetVerifiedAllowed()
+		settings.Actions.PatternsAllowed = allowed.PatternsAllowed
+	}
+	return settings, nil
+}
+
+// ownerOnlySettings names the settings only owners may read that are missing
+// from the response. Internal repositories only exist in enterprise orgs, so
+// their setting may be missing for owners too.
+func ownerOnlySettings(o *github.Organization) []string {
+	fields := []struct {
+		name    string
+		missing bool
+	}{
+		{"two_factor_requirement_enabled", o.TwoFactorRequirementEnabled == nil},
+		{"default_repository_permission", o.DefaultRepoPermission == nil},
+		{"members_can_create_public_repositories", o.MembersCanCreatePublicRepos == nil},
+		{"members_can_create_private_repositories", o.MembersCanCreatePrivateRepos == nil},
+		{"members_can_fork_private_repositories", o.MembersCanForkPrivateRepos == nil},
+	}
+	var missing []string
+	for _, f := range fields {
+		if f.missing {
+			missing = append(missing, f.name)
+		}
+	}
+	return missing
+}
+
+// EvaluateOrganization fetches the settings of an org and evaluates the
+// policy's organization-level rules on them, once per scan. Failures are
+// recorded in the result, like those of repositories.
+func (s *Scanner) EvaluateOrganization(ctx context.Context, endpointName, org string, policy Policy) (result *pb.OrganizationResult) {
+	ctx, span := tracer.Start(ctx, "EvaluateOrganization", trace.WithAttributes(attribute.String("org", org)))
+	defer span.End()
+
+	result = &pb.OrganizationResult{}
+	endpoint, err := resolveEndpoint(endpointName, org)
+	if err != nil {
+		result.ScanResult = export.FetchErrorPrefix + err.Error()
+		return result
+	}
+	client, err := getGitHubClient(endpoint)
+	if err != nil {
+		result.ScanResult = export.FetchErrorPrefix + err.Error()
+		return result
+	}
+	settings, err := FetchOrganizationSettings(ctx, org, client)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to fetch the organization settings", "error", err)
+		span.RecordError(err)
+		policyDecisions.WithLabelValues("error").Inc()
+		result.ScanResult = export.FetchErrorPrefix + err.Error()
+		return result
+	}
+	result.Settings = settings.toProto()
+
+	entrypoint := policy.organizationEntrypoint()
+	decision, err := evaluateOrganization(ctx, policy, entrypoint, settings)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "Organization policy evaluation error", "error", err)
+		result.ScanResult = err.Error()
+		policyDecisions.WithLabelValues("error").Inc()
+	case decision.Allowed:
+		result.ScanResult = "Success"
+		policyDecisions.WithLabelValues("success").Inc()
+	default:
+		result.ScanResult = "Failure"
+		result.Severity = decision.Severity
+		result.Violations = decision.Violations
+		policyDecisions.WithLabelValues("failure").Inc()
+	}
+	slog.InfoContext(ctx, "Organization evaluated", "result", result.ScanResult, "violations", len(result.Violations))
+	return result
+}
+
+func evaluateOrganization(ctx context.Context, policy Policy, entrypoint string, settings *OrganizationSettings) (policyDecision, error) {
+	query, err := rego.New(policy.queryOptions(entrypoint)...).PrepareForEval(ctx)
+	if err != nil {
+		return policyDecision{}, fmt.Errorf("failed to prepare rego query: %w", err)
+	}
+	severity, err := policy.severityOf(entrypoint)
+	if err != nil {
+		return policyDecision{}, err
+	}
+	return evaluatePolicy(ctx, query, settings, severity)
+}
+
+// decisionViolations reads the messages of a "violations" set or array in
+// the policy output, sorted
+func decisionViolations(output map[string]interface{}) []string {
+	values, _ := output["violations"].([]interface{})
+	var violations []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			violations = append(violations, s)
+		} else {
+			violations = append(violations, fmt.Sprint(v))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+func (o *OrganizationSettings) toProto() *pb.OrganizationSettings {
+	settings := &pb.OrganizationSettings{
+		Login:                                o.Login,
+		TwoFactorRequirementEnabled:          o.TwoFactorRequirementEnabled,
+		DefaultRepositoryPermission:          o.DefaultRepositoryPermission,
+		MembersCanCreatePublicRepositories:   o.MembersCanCreatePublicRepositories,
+		MembersCanCreatePrivateRepositories:  o.MembersCanCreatePrivateRepositories,
+		MembersCanCreateInternalRepositories: o.MembersCanCreateInternalRepositories,
+		MembersCanForkPrivateRepositories:    o.MembersCanForkPrivateRepositories,
+		WebCommitSignoffRequired:             o.WebCommitSignoffRequired,
+	}
+	if a := o.Actions; a != nil {
+		settings.Actions = &pb.ActionsSettings{
+			EnabledRepositories: a.EnabledRepositories,
+			AllowedActions:      a.AllowedActions,
+			GithubOwnedAllowed:  a.GitHubOwnedAllowed,
+			VerifiedAllowed:     a.VerifiedAllowed,
+			PatternsAllowed:     a.PatternsAllowed,
+		}
+	}
+	return settings
+}
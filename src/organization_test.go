@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github-scanner/src/export"
+)
+
+const testOrganizationPolicy = `# METADATA
+# custom:
+#   severity: high
+package organization
+
+violations contains "two-factor authentication is not required" if not input.two_factor_requirement_enabled
+violations contains "members can create public repositories" if input.members_can_create_public_repositories
+violations contains "unverified actions are allowed" if input.actions.allowed_actions == "all"
+
+allow if count(violations) == 0
+`
+
+// ownerSettings is the organization as an owner's token reads it
+const ownerSettings = `{
+	"login": "acme",
+	"two_factor_requirement_enabled": %s,
+	"default_repository_permission": "read",
+	"members_can_create_public_repositories": false,
+	"members_can_create_private_repositories": true,
+	"members_can_fork_private_repositories": false
+}`
+
+func TestEvaluateOrganization(t *testing.T) {
+	tests := []struct {
+		name         string
+		organization string // body of GET /orgs/acme, "" for 404
+		actions      string // body of GET /orgs/acme/actions/permissions, "" for 403
+		result       string
+		severity     string
+		violations   []string
+		actionsRead  bool
+	}{
+		{
+			name:         "compliant",
+			organization: strings.Replace(ownerSettings, "%s", "true", 1),
+			actions:      `{"enabled_repositories": "all", "allowed_actions": "local_only"}`,
+			result:       "Success",
+			actionsRead:  true,
+		},
+		{
+			name:         "denied",
+			organization: strings.Replace(ownerSettings, "%s", "false", 1),
+			actions:      `{"enabled_repositories": "all", "allowed_actions": "all"}`,
+			result:       "Failure",
+			severity:     "high",
+			violations:   []string{"two-factor authentication is not required", "unverified actions are allowed"},
+			actionsRead:  true,
+		},
+		{
+			name:         "actions unreadable",
+			organization: strings.Replace(ownerSettings, "%s", "true", 1),
+			result:       "Success",
+		},
+		{
+			name:         "token of a member",
+			organization: `{"login": "acme", "web_commit_signoff_required": false}`,
+			result:       export.FetchErrorPrefix + "organization acme: two_factor_requirement_enabled, default_repository_permission, members_can_create_public_repositories, members_can_create_private_repositories, members_can_fork_private_repositories can only be read by an owner of the organization",
+		},
+		{
+			name:   "unknown organization",
+			result: export.FetchErrorPrefix + "error fetching organization acme",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "acme", func(w http.ResponseWriter, r *http.Request) {
+				var body string
+				switch r.URL.Path {
+				case "/orgs/acme":
+					body = tt.organization
+				case "/orgs/acme/actions/permissions":
+					if tt.actions == "" {
+						http.Error(w, `{"message": "Must have admin rights"}`, http.StatusForbidden)
+						return
+					}
+					body = tt.actions
+				}
+				if body == "" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(body))
+			})
+
+			result := NewScanner(defaultConfig()).EvaluateOrganization(context.Background(), gh.endpoint.Name, "acme", Policy{Source: "package repository\n\nallow := true\n", Organization: testOrganizationPolicy})
+			if !strings.HasPrefix(result.GetScanResult(), tt.result) {
+				t.Errorf("scan_result = %q, want %q", result.GetScanResult(), tt.result)
+			}
+			if result.GetSeverity() != tt.severity {
+				t.Errorf("severity = %q, want %q", result.GetSeverity(), tt.severity)
+			}
+			if !slices.Equal(result.GetViolations(), tt.violations) {
+				t.Errorf("violations = %q, want %q", result.GetViolations(), tt.violations)
+			}
+			if got := result.GetSettings().GetActions() != nil; got != tt.actionsRead {
+				t.Errorf("actions read = %v, want %v", got, tt.actionsRead)
+			}
+		})
+	}
+}
+
+func TestValidateOrganizationPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string // substring of the InvalidArgument message, "" when valid
+	}{
+		{
+			name:   "valid",
+			source: testOrganizationPolicy,
+		},
+		{
+			name:   "another package",
+			source: "package repository\n\nallow := true\n",
+			err:    "must declare package organization, not data.repository",
+		},
+		{
+			name:   "syntax error",
+			source: "package organization\n\nallow if {\n",
+			err:    "invalid organization_policy",
+		},
+		{
+			name:   "unsafe rule",
+			source: "package organization\n\nallow if x == input.login\n",
+			err:    "var x is unsafe",
+		},
+		{
+			name:   "unknown severity",
+			source: "# METADATA\n# custom:\n#   severity: urgent\npackage organization\n\nallow := true\n",
+			err:    "unknown severity urgent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOrganizationPolicy(context.Background(), tt.source)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+				return
+			}
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want InvalidArgument containing %q", err, tt.err)
+			}
+		})
+	}
+}
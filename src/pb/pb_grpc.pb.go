@@ -8,6 +8,7 @@ package pb
 
 import (
 	context "context"
+	httpbody "google.golang.org/genproto/googleapis/api/httpbody"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -20,6 +21,23 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	PolicyService_ScanRepositories_FullMethodName = "/pb.PolicyService/ScanRepositories"
+	PolicyService_GetScan_FullMethodName          = "/pb.PolicyService/GetScan"
+	PolicyService_EvaluatePolicy_FullMethodName   = "/pb.PolicyService/EvaluatePolicy"
+	PolicyService_CreatePolicy_FullMethodName     = "/pb.PolicyService/CreatePolicy"
+	PolicyService_UpdatePolicy_FullMethodName     = "/pb.PolicyService/UpdatePolicy"
+	PolicyService_GetPolicy_FullMethodName        = "/pb.PolicyService/GetPolicy"
+	PolicyService_ListPolicies_FullMethodName     = "/pb.PolicyService/ListPolicies"
+	PolicyService_DeletePolicy_FullMethodName     = "/pb.PolicyService/DeletePolicy"
+	PolicyService_SetShadowVersion_FullMethodName = "/pb.PolicyService/SetShadowVersion"
+	PolicyService_PromotePolicy_FullMethodName    = "/pb.PolicyService/PromotePolicy"
+	PolicyService_GetShadowReport_FullMethodName  = "/pb.PolicyService/GetShadowReport"
+	PolicyService_CreateWaiver_FullMethodName     = "/pb.PolicyService/CreateWaiver"
+	PolicyService_ListWaivers_FullMethodName      = "/pb.PolicyService/ListWaivers"
+	PolicyService_DeleteWaiver_FullMethodName     = "/pb.PolicyService/DeleteWaiver"
+	PolicyService_Remediate_FullMethodName        = "/pb.PolicyService/Remediate"
+	PolicyService_ListBundles_FullMethodName      = "/pb.PolicyService/ListBundles"
+	PolicyService_ExportScans_FullMethodName      = "/pb.PolicyService/ExportScans"
+	PolicyService_StreamExport_FullMethodName     = "/pb.PolicyService/StreamExport"
 )
 
 // PolicyServiceClient is the client API for PolicyService service.
@@ -27,6 +45,49 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PolicyServiceClient interface {
 	ScanRepositories(ctx context.Context, in *PolicyRequest, opts ...grpc.CallOption) (*PolicyResponse, error)
+	// returns the result of a recent scan by its ID
+	GetScan(ctx context.Context, in *GetScanRequest, opts ...grpc.CallOption) (*PolicyResponse, error)
+	// evaluates a policy against the repositories of a stored scan or supplied
+	// by the caller, without calling GitHub
+	EvaluatePolicy(ctx context.Context, in *EvaluateRequest, opts ...grpc.CallOption) (*PolicyResponse, error)
+	// stores a new policy in the registry as its version 1
+	CreatePolicy(ctx context.Context, in *CreatePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error)
+	// adds a version to a registered policy; unchanged source adds none. The
+	// new version becomes active, or the shadow version with shadow set.
+	UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error)
+	// returns a version of a registered policy with its source, the active
+	// one by default
+	GetPolicy(ctx context.Context, in *GetPolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error)
+	ListPolicies(ctx context.Context, in *ListPoliciesRequest, opts ...grpc.CallOption) (*ListPoliciesResponse, error)
+	// removes a policy with all its versions
+	DeletePolicy(ctx context.Context, in *DeletePolicyRequest, opts ...grpc.CallOption) (*DeletePolicyResponse, error)
+	// marks a version of a registered policy as its shadow version, evaluated
+	// alongside the active version without affecting results; version 0
+	// clears it
+	SetShadowVersion(ctx context.Context, in *SetShadowVersionRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error)
+	// makes the shadow version of a registered policy its active version
+	PromotePolicy(ctx context.Context, in *PromotePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error)
+	// lists the repositories of a stored scan whose decision would change if
+	// the shadow version evaluated with it were promoted
+	GetShadowReport(ctx context.Context, in *GetShadowReportRequest, opts ...grpc.CallOption) (*ShadowReport, error)
+	// exempts a repository, or a user's access to it, from a policy until the
+	// waiver expires
+	CreateWaiver(ctx context.Context, in *CreateWaiverRequest, opts ...grpc.CallOption) (*Waiver, error)
+	// lists the active waivers, and the expired ones on request
+	ListWaivers(ctx context.Context, in *ListWaiversRequest, opts ...grpc.CallOption) (*ListWaiversResponse, error)
+	// revokes a waiver
+	DeleteWaiver(ctx context.Context, in *DeleteWaiverRequest, opts ...grpc.CallOption) (*DeleteWaiverResponse, error)
+	// plans the remediation actions the policy of a stored scan returned for
+	// its failed repositories, and applies them to GitHub when confirmed
+	Remediate(ctx context.Context, in *RemediateRequest, opts ...grpc.CallOption) (*RemediateResponse, error)
+	// lists the policy bundles loaded by the server
+	ListBundles(ctx context.Context, in *ListBundlesRequest, opts ...grpc.CallOption) (*ListBundlesResponse, error)
+	// renders stored scans in a report format such as "sarif"
+	ExportScans(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*httpbody.HttpBody, error)
+	// like ExportScans, but streams the report in chunks as it is written, for
+	// the inventories (csv, xlsx) of large organizations. gRPC only: the
+	// gateway delimits stream messages, which would corrupt binary reports.
+	StreamExport(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[httpbody.HttpBody], error)
 }
 
 type policyServiceClient struct {
@@ -47,11 +108,233 @@ func (c *policyServiceClient) ScanRepositories(ctx context.Context, in *PolicyRe
 	return out, nil
 }
 
+func (c *policyServiceClient) GetScan(ctx context.Context, in *GetScanRequest, opts ...grpc.CallOption) (*PolicyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PolicyResponse)
+	err := c.cc.Invoke(ctx, PolicyService_GetScan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) EvaluatePolicy(ctx context.Context, in *EvaluateRequest, opts ...grpc.CallOption) (*PolicyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PolicyResponse)
+	err := c.cc.Invoke(ctx, PolicyService_EvaluatePolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) CreatePolicy(ctx context.Context, in *CreatePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisteredPolicy)
+	err := c.cc.Invoke(ctx, PolicyService_CreatePolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisteredPolicy)
+	err := c.cc.Invoke(ctx, PolicyService_UpdatePolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) GetPolicy(ctx context.Context, in *GetPolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisteredPolicy)
+	err := c.cc.Invoke(ctx, PolicyService_GetPolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) ListPolicies(ctx context.Context, in *ListPoliciesRequest, opts ...grpc.CallOption) (*ListPoliciesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPoliciesResponse)
+	err := c.cc.Invoke(ctx, PolicyService_ListPolicies_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) DeletePolicy(ctx context.Context, in *DeletePolicyRequest, opts ...grpc.CallOption) (*DeletePolicyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeletePolicyResponse)
+	err := c.cc.Invoke(ctx, PolicyService_DeletePolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) SetShadowVersion(ctx context.Context, in *SetShadowVersionRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisteredPolicy)
+	err := c.cc.Invoke(ctx, PolicyService_SetShadowVersion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) PromotePolicy(ctx context.Context, in *PromotePolicyRequest, opts ...grpc.CallOption) (*RegisteredPolicy, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisteredPolicy)
+	err := c.cc.Invoke(ctx, PolicyService_PromotePolicy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) GetShadowReport(ctx context.Context, in *GetShadowReportRequest, opts ...grpc.CallOption) (*ShadowReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShadowReport)
+	err := c.cc.Invoke(ctx, PolicyService_GetShadowReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) CreateWaiver(ctx context.Context, in *CreateWaiverRequest, opts ...grpc.CallOption) (*Waiver, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Waiver)
+	err := c.cc.Invoke(ctx, PolicyService_CreateWaiver_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) ListWaivers(ctx context.Context, in *ListWaiversRequest, opts ...grpc.CallOption) (*ListWaiversResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWaiversResponse)
+	err := c.cc.Invoke(ctx, PolicyService_ListWaivers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) DeleteWaiver(ctx context.Context, in *DeleteWaiverRequest, opts ...grpc.CallOption) (*DeleteWaiverResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteWaiverResponse)
+	err := c.cc.Invoke(ctx, PolicyService_DeleteWaiver_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) Remediate(ctx context.Context, in *RemediateRequest, opts ...grpc.CallOption) (*RemediateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemediateResponse)
+	err := c.cc.Invoke(ctx, PolicyService_Remediate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) ListBundles(ctx context.Context, in *ListBundlesRequest, opts ...grpc.CallOption) (*ListBundlesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListBundlesResponse)
+	err := c.cc.Invoke(ctx, PolicyService_ListBundles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) ExportScans(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*httpbody.HttpBody, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(httpbody.HttpBody)
+	err := c.cc.Invoke(ctx, PolicyService_ExportScans_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *policyServiceClient) StreamExport(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[httpbody.HttpBody], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PolicyService_ServiceDesc.Streams[0], PolicyService_StreamExport_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, httpbody.HttpBody]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PolicyService_StreamExportClient = grpc.ServerStreamingClient[httpbody.HttpBody]
+
 // PolicyServiceServer is the server API for PolicyService service.
 // All implementations must embed UnimplementedPolicyServiceServer
 // for forward compatibility.
 type PolicyServiceServer interface {
 	ScanRepositories(context.Context, *PolicyRequest) (*PolicyResponse, error)
+	// returns the result of a recent scan by its ID
+	GetScan(context.Context, *GetScanRequest) (*PolicyResponse, error)
+	// evaluates a policy against the repositories of a stored scan or supplied
+	// by the caller, without calling GitHub
+	EvaluatePolicy(context.Context, *EvaluateRequest) (*PolicyResponse, error)
+	// stores a new policy in the registry as its version 1
+	CreatePolicy(context.Context, *CreatePolicyRequest) (*RegisteredPolicy, error)
+	// adds a version to a registered policy; unchanged source adds none. The
+	// new version becomes active, or the shadow version with shadow set.
+	UpdatePolicy(context.Context, *UpdatePolicyRequest) (*RegisteredPolicy, error)
+	// returns a version of a registered policy with its source, the active
+	// one by default
+	GetPolicy(context.Context, *GetPolicyRequest) (*RegisteredPolicy, error)
+	ListPolicies(context.Context, *ListPoliciesRequest) (*ListPoliciesResponse, error)
+	// removes a policy with all its versions
+	DeletePolicy(context.Context, *DeletePolicyRequest) (*DeletePolicyResponse, error)
+	// marks a version of a registered policy as its shadow version, evaluated
+	// alongside the active version without affecting results; version 0
+	// clears it
+	SetShadowVersion(context.Context, *SetShadowVersionRequest) (*RegisteredPolicy, error)
+	// makes the shadow version of a registered policy its active version
+	PromotePolicy(context.Context, *PromotePolicyRequest) (*RegisteredPolicy, error)
+	// lists the repositories of a stored scan whose decision would change if
+	// the shadow version evaluated with it were promoted
+	GetShadowReport(context.Context, *GetShadowReportRequest) (*ShadowReport, error)
+	// exempts a repository, or a user's access to it, from a policy until the
+	// waiver expires
+	CreateWaiver(context.Context, *CreateWaiverRequest) (*Waiver, error)
+	// lists the active waivers, and the expired ones on request
+	ListWaivers(context.Context, *ListWaiversRequest) (*ListWaiversResponse, error)
+	// revokes a waiver
+	DeleteWaiver(context.Context, *DeleteWaiverRequest) (*DeleteWaiverResponse, error)
+	// plans the remediation actions the policy of a stored scan returned for
+	// its failed repositories, and applies them to GitHub when confirmed
+	Remediate(context.Context, *RemediateRequest) (*RemediateResponse, error)
+	// lists the policy bundles loaded by the server
+	ListBundles(context.Context, *ListBundlesRequest) (*ListBundlesResponse, error)
+	// renders stored scans in a report format such as "sarif"
+	ExportScans(context.Context, *ExportRequest) (*httpbody.HttpBody, error)
+	// like ExportScans, but streams the report in chunks as it is written, for
+	// the inventories (csv, xlsx) of large organizations. gRPC only: the
+	// gateway delimits stream messages, which would corrupt binary reports.
+	StreamExport(*ExportRequest, grpc.ServerStreamingServer[httpbody.HttpBody]) error
 	mustEmbedUnimplementedPolicyServiceServer()
 }
 
@@ -65,6 +348,57 @@ type UnimplementedPolicyServiceServer struct{}
 func (UnimplementedPolicyServiceServer) ScanRepositories(context.Context, *PolicyRequest) (*PolicyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ScanRepositories not implemented")
 }
+func (UnimplementedPolicyServiceServer) GetScan(context.Context, *GetScanRequest) (*PolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetScan not implemented")
+}
+func (UnimplementedPolicyServiceServer) EvaluatePolicy(context.Context, *EvaluateRequest) (*PolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EvaluatePolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) CreatePolicy(context.Context, *CreatePolicyRequest) (*RegisteredPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreatePolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) UpdatePolicy(context.Context, *UpdatePolicyRequest) (*RegisteredPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdatePolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) GetPolicy(context.Context, *GetPolicyRequest) (*RegisteredPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) ListPolicies(context.Context, *ListPoliciesRequest) (*ListPoliciesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPolicies not implemented")
+}
+func (UnimplementedPolicyServiceServer) DeletePolicy(context.Context, *DeletePolicyRequest) (*DeletePolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeletePolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) SetShadowVersion(context.Context, *SetShadowVersionRequest) (*RegisteredPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetShadowVersion not implemented")
+}
+func (UnimplementedPolicyServiceServer) PromotePolicy(context.Context, *PromotePolicyRequest) (*RegisteredPolicy, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromotePolicy not implemented")
+}
+func (UnimplementedPolicyServiceServer) GetShadowReport(context.Context, *GetShadowReportRequest) (*ShadowReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetShadowReport not implemented")
+}
+func (UnimplementedPolicyServiceServer) CreateWaiver(context.Context, *CreateWaiverRequest) (*Waiver, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWaiver not implemented")
+}
+func (UnimplementedPolicyServiceServer) ListWaivers(context.Context, *ListWaiversRequest) (*ListWaiversResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWaivers not implemented")
+}
+func (UnimplementedPolicyServiceServer) DeleteWaiver(context.Context, *DeleteWaiverRequest) (*DeleteWaiverResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWaiver not implemented")
+}
+func (UnimplementedPolicyServiceServer) Remediate(context.Context, *RemediateRequest) (*RemediateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remediate not implemented")
+}
+func (UnimplementedPolicyServiceServer) ListBundles(context.Context, *ListBundlesRequest) (*ListBundlesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBundles not implemented")
+}
+func (UnimplementedPolicyServiceServer) ExportScans(context.Context, *ExportRequest) (*httpbody.HttpBody, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportScans not implemented")
+}
+func (UnimplementedPolicyServiceServer) StreamExport(*ExportRequest, grpc.ServerStreamingServer[httpbody.HttpBody]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamExport not implemented")
+}
 func (UnimplementedPolicyServiceServer) mustEmbedUnimplementedPolicyServiceServer() {}
 func (UnimplementedPolicyServiceServer) testEmbeddedByValue()                       {}
 
@@ -104,6 +438,305 @@ func _PolicyService_ScanRepositories_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _PolicyService_GetScan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).GetScan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_GetScan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).GetScan(ctx, req.(*GetScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_EvaluatePolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvaluateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).EvaluatePolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_EvaluatePolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).EvaluatePolicy(ctx, req.(*EvaluateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_CreatePolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreatePolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).CreatePolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_CreatePolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).CreatePolicy(ctx, req.(*CreatePolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_UpdatePolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdatePolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).UpdatePolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_UpdatePolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).UpdatePolicy(ctx, req.(*UpdatePolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_GetPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).GetPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_GetPolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).GetPolicy(ctx, req.(*GetPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_ListPolicies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPoliciesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).ListPolicies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_ListPolicies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).ListPolicies(ctx, req.(*ListPoliciesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_DeletePolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).DeletePolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_DeletePolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).DeletePolicy(ctx, req.(*DeletePolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_SetShadowVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetShadowVersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).SetShadowVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_SetShadowVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).SetShadowVersion(ctx, req.(*SetShadowVersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_PromotePolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromotePolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).PromotePolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_PromotePolicy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).PromotePolicy(ctx, req.(*PromotePolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_GetShadowReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetShadowReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).GetShadowReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_GetShadowReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).GetShadowReport(ctx, req.(*GetShadowReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_CreateWaiver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWaiverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).CreateWaiver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_CreateWaiver_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).CreateWaiver(ctx, req.(*CreateWaiverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_ListWaivers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWaiversRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).ListWaivers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_ListWaivers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).ListWaivers(ctx, req.(*ListWaiversRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_DeleteWaiver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWaiverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).DeleteWaiver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_DeleteWaiver_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).DeleteWaiver(ctx, req.(*DeleteWaiverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_Remediate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemediateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).Remediate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_Remediate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).Remediate(ctx, req.(*RemediateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_ListBundles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBundlesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).ListBundles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_ListBundles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).ListBundles(ctx, req.(*ListBundlesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_ExportScans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PolicyServiceServer).ExportScans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PolicyService_ExportScans_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PolicyServiceServer).ExportScans(ctx, req.(*ExportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PolicyService_StreamExport_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PolicyServiceServer).StreamExport(m, &grpc.GenericServerStream[ExportRequest, httpbody.HttpBody]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PolicyService_StreamExportServer = grpc.ServerStreamingServer[httpbody.HttpBody]
+
 // PolicyService_ServiceDesc is the grpc.ServiceDesc for PolicyService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,7 +748,77 @@ var PolicyService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ScanRepositories",
 			Handler:    _PolicyService_ScanRepositories_Handler,
 		},
+		{
+			MethodName: "GetScan",
+			Handler:    _PolicyService_GetScan_Handler,
+		},
+		{
+			MethodName: "EvaluatePolicy",
+			Handler:    _PolicyService_EvaluatePolicy_Handler,
+		},
+		{
+			MethodName: "CreatePolicy",
+			Handler:    _PolicyService_CreatePolicy_Handler,
+		},
+		{
+			MethodName: "UpdatePolicy",
+			Handler:    _PolicyService_UpdatePolicy_Handler,
+		},
+		{
+			MethodName: "GetPolicy",
+			Handler:    _PolicyService_GetPolicy_Handler,
+		},
+		{
+			MethodName: "ListPolicies",
+			Handler:    _PolicyService_ListPolicies_Handler,
+		},
+		{
+			MethodName: "DeletePolicy",
+			Handler:    _PolicyService_DeletePolicy_Handler,
+		},
+		{
+			MethodName: "SetShadowVersion",
+			Handler:    _PolicyService_SetShadowVersion_Handler,
+		},
+		{
+			MethodName: "PromotePolicy",
+			Handler:    _PolicyService_PromotePolicy_Handler,
+		},
+		{
+			MethodName: "GetShadowReport",
+			Handler:    _PolicyService_GetShadowReport_Handler,
+		},
+		{
+			MethodName: "CreateWaiver",
+			Handler:    _PolicyService_CreateWaiver_Handler,
+		},
+		{
+			MethodName: "ListWaivers",
+			Handler:    _PolicyService_ListWaivers_Handler,
+		},
+		{
+			MethodName: "DeleteWaiver",
+			Handler:    _PolicyService_DeleteWaiver_Handler,
+		},
+		{
+			MethodName: "Remediate",
+			Handler:    _PolicyService_Remediate_Handler,
+		},
+		{
+			MethodName: "ListBundles",
+			Handler:    _PolicyService_ListBundles_Handler,
+		},
+		{
+			MethodName: "ExportScans",
+			Handler:    _PolicyService_ExportScans_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamExport",
+			Handler:       _PolicyService_StreamExport_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pb.proto",
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errPolicyNotFound  = errors.New("policy not found")
+	errPolicyExists    = errors.New("policy already exists")
+	errVersionNotFound = errors.New("policy version not found")
+	errInvalidPolicy   = errors.New("invalid policy")
+	errNoShadow        = errors.New("policy has no shadow version")
+)
+
+// IDs are used as file names and in "id@version" references
+var policyIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// registeredPolicy is a policy of the registry with all its versions. The
+// active version is what scans of the policy enforce; the shadow version,
+// when set, is evaluated alongside it without affecting results.
+type registeredPolicy struct {
+	ID          string          `json:"id"`
+	Description string          `json:"description"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Active      int             `json:"active_version"`
+	Shadow      int             `json:"shadow_version,omitempty"`
+	Versions    []policyVersion `json:"versions"`
+}
+
+// policyVersion is immutable once written; versions count up from 1
+type policyVersion struct {
+	Version   int       `json:"version"`
+	Source    string    `json:"source"`
+	SHA256    string    `json:"sha256"`
+	Author    string    `json:"author"`
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (p *registeredPolicy) latest() policyVersion {
+	return p.Versions[len(p.Versions)-1]
+}
+
+func (p *registeredPolicy) active() policyVersion {
+	return p.Versions[p.Active-1]
+}
+
+// version returns a version, or the active one for 0
+func (p *registeredPolicy) version(n int) (policyVersion, error) {
+	if n == 0 {
+		return p.active(), nil
+	}
+	if n < 0 || n > len(p.Versions) {
+		return policyVersion{}, fmt.Errorf("%w: %s@%d", errVersionNotFound, p.ID, n)
+	}
+	return p.Versions[n-1], nil
+}
+
+// shadowOf returns the shadow version evaluated alongside v, which only the
+// active version has
+func (p *registeredPolicy) shadowOf(v policyVersion) (policyVersion, bool) {
+	if p.Shadow == 0 || v.Version != p.Active {
+		return policyVersion{}, false
+	}
+	return p.Versions[p.Shadow-1], true
+}
+
+// policyRegistry stores policies as one JSON file per policy in a
+// directory, rewritten atomically on every change
+type policyRegistry struct {
+	dir string
+
+	mu       sync.Mutex
+	policies map[string]*registeredPolicy
+}
+
+// openPolicyRegistry loads the policies stored in dir, creating it if needed
+func openPolicyRegistry(dir string) (*policyRegistry, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &policyRegistry{dir: dir, policies: make(map[string]*registeredPolicy)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var p registeredPolicy
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(p.Versions) == 0 {
+			return nil, fmt.Errorf("%s: policy has no versions", path)
+		}
+		// policies stored before versions could be shadowed activated the latest
+		if p.Active == 0 {
+			p.Active = len(p.Versions)
+		}
+		if p.Active > len(p.Versions) || p.Shadow < 0 || p.Shadow > len(p.Versions) {
+			return nil, fmt.Errorf("%s: active or shadow version out of range", path)
+		}
+		r.policies[p.ID] = &p
+	}
+	slog.Info("Opened policy registry", "dir", dir, "policies", len(r.policies))
+	return r, nil
+}
+
+func policyHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// parsePolicyRef splits "id@version"; a missing version means the active one
+func parsePolicyRef(ref string) (string, int, error) {
+	id, version, found := strings.Cut(ref, "@")
+	if !found {
+		return id, 0, nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("%w reference %q, expected policy_id@version", errInvalidPolicy, ref)
+	}
+	return id, n, nil
+}
+
+// create stores a new policy with its first version
+func (r *policyRegistry) create(id, description, source, author, comment string) (*registeredPolicy, error) {
+	if !policyIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w id %q: use lowercase letters, digits, '.', '_' and '-'", errInvalidPolicy, id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.policies[id]; ok {
+		return nil, fmt.Errorf("%w: %s", errPolicyExists, id)
+	}
+	now := time.Now().UTC()
+	p := &registeredPolicy{
+		ID:          id,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Active:      1,
+		Versions: []policyVersion{{
+			Version: 1, Source: source, SHA256: policyHash(source), Author: author, Comment: comment, CreatedAt: now,
+		}},
+	}
+	if err := r.write(p); err != nil {
+		return nil, err
+	}
+	r.policies[id] = p
+	return clonePolicy(p), nil
+}
+
+// update adds a version to a policy, which becomes the active version, or
+// the shadow version with shadow set. Source unchanged from the latest
+// version adds no version.
+func (r *policyRegistry) update(id, description, source, author, comment string, shadow bool) (*registeredPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.policies[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPolicyNotFound, id)
+	}
+
+	p := clonePolicy(existing)
+	hash := policyHash(source)
+	changed := false
+	if description != "" && description != p.Description {
+		p.Description = description
+		changed = true
+	}
+	if hash != p.latest().SHA256 {
+		p.Versions = append(p.Versions, policyVersion{
+			Version: len(p.Versions) + 1, Source: source, SHA256: hash, Author: author, Comment: comment, CreatedAt: time.Now().UTC(),
+		})
+		if shadow {
+			p.Shadow = len(p.Versions)
+		} else {
+			p.Active = len(p.Versions)
+			if p.Shadow == p.Active {
+				p.Shadow = 0
+			}
+		}
+		changed = true
+	}
+	if !changed {
+		return p, nil
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if err := r.write(p); err != nil {
+		return nil, err
+	}
+	r.policies[id] = p
+	return clonePolicy(p), nil
+}
+
+// setShadow marks a version as the shadow version; 0 clears it
+func (r *policyRegistry) setShadow(id string, version int) (*registeredPolicy, error) {
+	return r.modify(id, func(p *registeredPolicy) error {
+		if version != 0 {
+			if _, err := p.version(version); err != nil {
+				return err
+			}
+			if version == p.Active {
+				return fmt.Errorf("%w: %s@%d is the active version", errInvalidPolicy, id, version)
+			}
+		}
+		p.Shadow = version
+		return nil
+	})
+}
+
+// promote makes the shadow version the active one
+func (r *policyRegistry) promote(id string) (*registeredPolicy, error) {
+	return r.modify(id, func(p *registeredPolicy) error {
+		if p.Shadow == 0 {
+			return fmt.Errorf("%w: %s", errNoShadow, id)
+		}
+		p.Active, p.Shadow = p.Shadow, 0
+		return nil
+	})
+}
+
+// modify applies change to a copy of a policy and stores it
+func (r *policyRegistry) modify(id string, change func(*registeredPolicy) error) (*registeredPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.policies[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPolicyNotFound, id)
+	}
+
+	p := clonePolicy(existing)
+	if err := change(p); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if err := r.write(p); err != nil {
+		return nil, err
+	}
+	r.policies[id] = p
+	return clonePolicy(p), nil
+}
+
+func (r *policyRegistry) get(id string) (*registeredPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.policies[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPolicyNotFound, id)
+	}
+	return clonePolicy(p), nil
+}
+
+// resolve looks up the policy and the version a "id@version" reference
+// points at
+func (r *policyRegistry) resolve(ref string) (*registeredPolicy, policyVersion, error) {
+	id, n, err := parsePolicyRef(ref)
+	if err != nil {
+		return nil, policyVersion{}, err
+	}
+	p, err := r.get(id)
+	if err != nil {
+		return nil, policyVersion{}, err
+	}
+	v, err := p.version(n)
+	return p, v, err
+}
+
+// list returns the policies sorted by ID
+func (r *policyRegistry) list() []*registeredPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	policies := make([]*registeredPolicy, 0, len(r.policies))
+	for _, p := range r.policies {
+		policies = append(policies, clonePolicy(p))
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+	return policies
+}
+
+// delete removes a policy with all its versions
+func (r *policyRegistry) delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.policies[id]; !ok {
+		return fmt.Errorf("%w: %s", errPolicyNotFound, id)
+	}
+	if err := os.Remove(r.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(r.policies, id)
+	return nil
+}
+
+func (r *policyRegistry) path(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// write replaces the policy's file
+func (r *policyRegistry) write(p *registeredPolicy) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path(p.ID), data)
+}
+
+// writeFileAtomic replaces a file through a synced temporary file, so a
+// crash never leaves it partially written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func clonePolicy(p *registeredPolicy) *registeredPolicy {
+	clone := *p
+	clone.Versions = append([]policyVersion(nil), p.Versions...)
+	return &clone
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// Remediation actions
+const (
+	actionEnableBranchProtection = "enable_branch_protection"
+	actionSetCollaboratorRole    = "set_collaborator_role"
+	actionRemoveCollaborator     = "remove_collaborator"
+	actionArchive                = "archive"
+)
+
+// collaborator roles as the GitHub API names them; the permission levels
+// reported for collaborators (read, write) are accepted as well
+var collaboratorRoles = map[string]string{
+	"pull":     "pull",
+	"read":     "pull",
+	"triage":   "triage",
+	"push":     "push",
+	"write":    "push",
+	"maintain": "maintain",
+	"admin":    "admin",
+}
+
+// Remediation is a change a policy asks for to fix a failed repository, as
+// returned by its "remediations" rule
+type Remediation struct {
+	Action           string            `json:"action"`
+	User             string            `json:"user,omitempty"`
+	Role             string            `json:"role,omitempty"`
+	BranchProtection *BranchProtection `json:"branch_protection,omitempty"`
+}
+
+func (r *Remediation) validate() error {
+	switch r.Action {
+	case actionEnableBranchProtection, actionArchive:
+	case actionSetCollaboratorRole:
+		role, ok := collaboratorRoles[strings.ToLower(r.Role)]
+		if !ok {
+			return fmt.Errorf("%s: unknown role %q", r.Action, r.Role)
+		}
+		r.Role = role
+		fallthrough
+	case actionRemoveCollaborator:
+		if r.User == "" {
+			return fmt.Errorf("%s: user is required", r.Action)
+		}
+	default:
+		return fmt.Errorf("unknown remediation action %q", r.Action)
+	}
+	return nil
+}
+
+// decisionRemediations reads the "remediations" rule of a policy's output,
+// a set or array of actions; invalid actions are logged and dropped
+func decisionRemediations(output map[string]interface{}) []Remediation {
+	value, ok := output["remediations"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var remediations []Remediation
+	for _, v := range value {
+		data, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		var r Remediation
+		if err := json.Unmarshal(data, &r); err != nil {
+			slog.Warn("Ignoring invalid remediation in the policy output", "remediation", string(data), "error", err)
+			continue
+		}
+		if err := r.validate(); err != nil {
+			slog.Warn("Ignoring invalid remediation in the policy output", "remediation", string(data), "error", err)
+			continue
+		}
+		remediations = append(remediations, r)
+	}
+	return remediations
+}
+
+func remediationsToProto(remediations []Remediation) []*pb.RemediationAction {
+	var actions []*pb.RemediationAction
+	for _, r := range remediations {
+		action := &pb.RemediationAction{Action: r.Action, User: r.User, Role: r.Role}
+		if bp := r.BranchProtection; bp != nil {
+			action.BranchProtection = &pb.BranchProtection{
+				RequiredApprovingReviewCount: int32(bp.RequiredApprovingReviewCount),
+				RequiresCodeOwnerReviews:     bp.RequiresCodeOwnerReviews,
+				DismissesStaleReviews:        bp.DismissesStaleReviews,
+				RequiresStatusChecks:         bp.RequiresStatusChecks,
+				EnforceAdmins:                bp.EnforceAdmins,
+				AllowsForcePushes:            bp.AllowsForcePushes,
+				AllowsDeletions:              bp.AllowsDeletions,
+				RequiresLinearHistory:        bp.RequiresLinearHistory,
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// planChange describes the GitHub API call an action makes on a repository.
+// Actions that can't be planned carry the reason in Error.
+func planChange(repo *pb.RepositoryInfo, action *pb.RemediationAction) *pb.PlannedChange {
+	change := &pb.PlannedChange{Repository: repo.GetFullName(), Action: action}
+	base := "/repos/" + repo.GetFullName()
+	switch action.GetAction() {
+	case actionEnableBranchProtection:
+		branch := repo.GetDefaultBranch()
+		change.Method, change.Path = http.MethodPut, base+"/branches/"+branch+"/protection"
+		change.Description = fmt.Sprintf("protect branch %s (%s)", branch, describeProtection(action.GetBranchProtection()))
+		if repo.GetBranchProtection() != nil {
+			change.Description = fmt.Sprintf("tighten the protection of branch %s (%s), keeping its stricter rules, status checks and restrictions",
+				branch, describeProtection(action.GetBranchProtection()))
+		}
+		if branch == "" {
+			change.Error = "the default branch of the repository is unknown"
+		}
+	case actionSetCollaboratorRole:
+		change.Method, change.Path = http.MethodPut, base+"/collaborators/"+action.GetUser()
+		change.Description = fmt.Sprintf("set the role of %s to %s", action.GetUser(), action.GetRole())
+		if perm := collaboratorPermission(repo, action.GetUser()); perm != nil {
+			change.Description = fmt.Sprintf("change the role of %s from %s to %s", action.GetUser(), perm.GetRole(), action.GetRole())
+			change.Error = indirectAccessError(perm)
+		}
+	case actionRemoveCollaborator:
+		change.Method, change.Path = http.MethodDelete, base+"/collaborators/"+action.GetUser()
+		change.Description = "remove collaborator " + action.GetUser()
+		if perm := collaboratorPermission(repo, action.GetUser()); perm != nil {
+			change.Description += " (" + perm.GetRole() + ")"
+			change.Error = indirectAccessError(perm)
+		}
+	case actionArchive:
+		change.Method, change.Path = http.MethodPatch, base
+		change.Description = "archive the repository"
+	default:
+		change.Error = fmt.Sprintf("unknown remediation action %q", action.GetAction())
+	}
+	return change
+}
+
+// collaboratorPermission is the user's permission in the scanned
+// permissions, nil when the user has none
+func collaboratorPermission(repo *pb.RepositoryInfo, user string) *pb.RepositoryPermissions {
+	for _, perm := range repo.GetPermissions() {
+		if strings.EqualFold(perm.GetUsername(), user) {
+			return perm
+		}
+	}
+	return nil
+}
+
+// indirectAccessError refuses collaborator changes on access the user gets
+// from elsewhere than the repository, such as a team: GitHub would accept
+// them, and the user would keep the access
+func indirectAccessError(perm *pb.RepositoryPermissions) string {
+	if source := perm.GetSource(); source != "" && source != "user" {
+		return fmt.Sprintf("%s has %s access through %s, which collaborator changes can't lower or remove", perm.GetUsername(), perm.GetRole(), source)
+	}
+	return ""
+}
+
+func describeProtection(bp *pb.BranchProtection) string {
+	var settings []string
+	if n := bp.GetRequiredApprovingReviewCount(); n > 0 {
+		settings = append(settings, fmt.Sprintf("%d approving reviews", n))
+	}
+	for _, s := range []struct {
+		on   bool
+		name string
+	}{
+		{bp.GetRequiresCodeOwnerReviews(), "code owner reviews"},
+		{bp.GetDismissesStaleReviews(), "dismiss stale reviews"},
+		{bp.GetRequiresStatusChecks(), "status checks"},
+		{bp.GetEnforceAdmins(), "enforce admins"},
+		{bp.GetAllowsForcePushes(), "allow force pushes"},
+		{bp.GetAllowsDeletions(), "allow deletions"},
+		{bp.GetRequiresLinearHistory(), "linear history"},
+	} {
+		if s.on {
+			settings = append(settings, s.name)
+		}
+	}
+	if len(settings) == 0 {
+		return "no rules"
+	}
+	return strings.Join(settings, ", ")
+}
+
+// applyChange makes the planned change through the GitHub API
+func applyChange(ctx context.Context, client *github.Client, repo *pb.RepositoryInfo, change *pb.PlannedChange) error {
+	owner, name := repo.GetOwner(), repo.GetName()
+	action := change.GetAction()
+	var err error
+	switch action.GetAction() {
+	case actionEnableBranchProtection:
+		branch := repo.GetDefaultBranch()
+		current, _, getErr := client.Repositories.GetBranchProtection(ctx, owner, name, branch)
+		if getErr != nil && !errors.Is(getErr, github.ErrBranchNotProtected) {
+			return fmt.Errorf("reading the protection of branch %s: %w", branch, getErr)
+		}
+		_, _, err = client.Repositories.UpdateBranchProtection(ctx, owner, name, branch, protectionRequest(current, action.GetBranchProtection()))
+	case actionSetCollaboratorRole:
+		_, _, err = client.Repositories.AddCollaborator(ctx, owner, name, action.GetUser(), &github.RepositoryAddCollaboratorOptions{Permission: action.GetRole()})
+	case actionRemoveCollaborator:
+		_, err = client.Repositories.RemoveCollaborator(ctx, owner, name, action.GetUser())
+	case actionArchive:
+		_, _, err = client.Repositories.Edit(ctx, owner, name, &github.Repository{Archived: github.Ptr(true)})
+	}
+	return err
+}
+
+// protectionRequest overlays the policy's protection onto the current one
+// of the branch, nil when unprotected. PUT replaces the whole protection, so
+// the request keeps what the policy doesn't describe (status checks, push
+// restrictions, review bypasses) and only ever tightens the rules it does.
+func protectionRequest(current *github.Protection, bp *pb.BranchProtection) *github.ProtectionRequest {
+	if current == nil {
+		current = &github.Protection{}
+	}
+	req := &github.ProtectionRequest{
+		EnforceAdmins:                  bp.GetEnforceAdmins() || (current.EnforceAdmins != nil && current.EnforceAdmins.Enabled),
+		AllowForcePushes:               github.Ptr(bp.GetAllowsForcePushes()),
+		AllowDeletions:                 github.Ptr(bp.GetAllowsDeletions()),
+		RequireLinearHistory:           github.Ptr(bp.GetRequiresLinearHistory() || (current.RequireLinearHistory != nil && current.RequireLinearHistory.Enabled)),
+		RequiredConversationResolution: github.Ptr(current.RequiredConversationResolution != nil && current.RequiredConversationResolution.Enabled),
+	}
+	if current.AllowForcePushes != nil {
+		req.AllowForcePushes = github.Ptr(current.AllowForcePushes.Enabled && bp.GetAllowsForcePushes())
+	}
+	if current.AllowDeletions != nil {
+		req.AllowDeletions = github.Ptr(current.AllowDeletions.Enabled && bp.GetAllowsDeletions())
+	}
+	if current.BlockCreations != nil {
+		req.BlockCreations = github.Ptr(current.BlockCreations.GetEnabled())
+	}
+	if current.LockBranch != nil {
+		req.LockBranch = github.Ptr(current.LockBranch.GetEnabled())
+	}
+	if current.AllowForkSyncing != nil {
+		req.AllowForkSyncing = github.Ptr(current.AllowForkSyncing.GetEnabled())
+	}
+
+	reviews := current.GetRequiredPullRequestReviews()
+	if reviews != nil || bp.GetRequiredApprovingReviewCount() > 0 || bp.GetRequiresCodeOwnerReviews() || bp.GetDismissesStaleReviews() {
+		r := &github.PullRequestReviewsEnforcementRequest{
+			RequiredApprovingReviewCount: int(bp.GetRequiredApprovingReviewCount()),
+			RequireCodeOwnerReviews:      bp.GetRequiresCodeOwnerReviews(),
+			DismissStaleReviews:          bp.GetDismissesStaleReviews(),
+		}
+		if reviews != nil {
+			r.RequiredApprovingReviewCount = max(r.RequiredApprovingReviewCount, reviews.RequiredApprovingReviewCount)
+			r.RequireCodeOwnerReviews = r.RequireCodeOwnerReviews || reviews.RequireCodeOwnerReviews
+			r.DismissStaleReviews = r.DismissStaleReviews || reviews.DismissStaleReviews
+			r.RequireLastPushApproval = github.Ptr(reviews.RequireLastPushApproval)
+			if a := reviews.BypassPullRequestAllowances; a != nil {
+				users, teams, apps := actorNames(a.Users, a.Teams, a.Apps)
+				r.BypassPullRequestAllowancesRequest = &github.BypassPullRequestAllowancesRequest{Users: users, Teams: teams, Apps: apps}
+			}
+			if d := reviews.DismissalRestrictions; d != nil {
+				users, teams, apps := actorNames(d.Users, d.Teams, d.Apps)
+				r.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{Users: &users, Teams: &teams, Apps: &apps}
+			}
+		}
+		req.RequiredPullRequestReviews = r
+	}
+
+	if checks := current.GetRequiredStatusChecks(); checks != nil {
+		// contexts are the deprecated form of checks: send only one of them
+		req.RequiredStatusChecks = &github.RequiredStatusChecks{Strict: checks.Strict || bp.GetRequiresStatusChecks()}
+		if checks.Checks != nil {
+			req.RequiredStatusChecks.Checks = checks.Checks
+		} else {
+			req.RequiredStatusChecks.Contexts = github.Ptr(checks.GetContexts())
+		}
+	} else if bp.GetRequiresStatusChecks() {
+		req.RequiredStatusChecks = &github.RequiredStatusChecks{Strict: true, Contexts: &[]string{}}
+	}
+
+	if restrictions := current.GetRestrictions(); restrictions != nil {
+		users, teams, apps := actorNames(restrictions.Users, restrictions.Teams, restrictions.Apps)
+		req.Restrictions = &github.BranchRestrictionsRequest{Users: users, Teams: teams, Apps: apps}
+	}
+	return req
+}
+
+// actorNames are the user logins, team slugs and app slugs a protection
+// request names actors by
+func actorNames(users []*github.User, teams []*github.Team, apps []*github.App) ([]string, []string, []string) {
+	logins, slugs, appSlugs := []string{}, []string{}, []string{}
+	for _, u := range users {
+		logins = append(logins, u.GetLogin())
+	}
+	for _, t := range teams {
+		slugs = append(slugs, t.GetSlug())
+	}
+	for _, a := range apps {
+		appSlugs = append(appSlugs, a.GetSlug())
+	}
+	return logins, slugs, appSlugs
+}
+
+// auditEntry records a change Remediate applied, or failed to apply
+type auditEntry struct {
+	Time        time.Time             `json:"time"`
+	Actor       string                `json:"actor,omitempty"`
+	ScanID      string                `json:"scan_id"`
+	Policy      string                `json:"policy"`
+	Repository  string                `json:"repository"`
+	Action      *pb.RemediationAction `json:"action"`
+	Method      string                `json:"method"`
+	Path        string                `json:"path"`
+	Description string                `json:"description"`
+	Result      string                `json:"result"` // applied or failed
+	Error       string                `json:"error,omitempty"`
+}
+
+// auditLog appends one JSON line per change to a file that is only ever
+// appended to
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+// record writes the entry and syncs it to disk before the next change
+func (l *auditLog) record(entry auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Remediate plans the remediation actions of the failed repositories of a
+// stored scan. With confirm, it applies them and records each in the audit
+// log; changes are applied one at a time and a failure doesn't stop the
+// others. Only scans ScanRepositories fetched from GitHub are remediated,
+// never repositories a caller supplied, and each change is authorized for
+// the repository's owner.
+func (s *Server) Remediate(ctx context.Context, req *pb.RemediateRequest) (*pb.RemediateResponse, error) {
+	scan, origin, err := s.storedScan(ctx, req.GetScanId())
+	if err != nil {
+		return nil, err
+	}
+	if !origin.fetched {
+		return nil, status.Errorf(codes.FailedPrecondition, "scan %s was not fetched from GitHub by ScanRepositories and can't be remediated", req.GetScanId())
+	}
+	if req.GetConfirm() && s.audit == nil {
+		return nil, status.Error(codes.FailedPrecondition, "applying remediations requires an audit log (remediation.audit_log)")
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range req.GetRepositories() {
+		selected[strings.ToLower(name)] = false
+	}
+	var repos []*pb.RepositoryInfo
+	for _, repo := range scan.GetRepositories() {
+		name := strings.ToLower(repo.GetFullName())
+		if _, ok := selected[name]; ok {
+			selected[name] = true
+		} else if len(selected) > 0 {
+			continue
+		}
+		if export.Outcome(repo) == export.OutcomeFail {
+			repos = append(repos, repo)
+		}
+	}
+	for _, name := range req.GetRepositories() {
+		if !selected[strings.ToLower(name)] {
+			return nil, status.Errorf(codes.InvalidArgument, "repository %q is not in scan %s", name, req.GetScanId())
+		}
+	}
+
+	resp := &pb.RemediateResponse{ScanId: req.GetScanId(), DryRun: !req.GetConfirm()}
+	denied := make(map[string]error)
+	for _, repo := range repos {
+		owner := strings.ToLower(repo.GetOwner())
+		if _, ok := denied[owner]; !ok {
+			denied[owner] = s.auth.authorizeOrg(ctx, repo.GetOwner())
+		}
+		for _, action := range repo.GetRemediations() {
+			change := planChange(repo, action)
+			if err := denied[owner]; err != nil && change.Error == "" {
+				change.Error = status.Convert(err).Message()
+			}
+			resp.Changes = append(resp.Changes, change)
+		}
+	}
+	ctx = withLogAttrs(ctx, "scan_id", req.GetScanId())
+	if resp.DryRun {
+		slog.InfoContext(ctx, "Remediation planned", "changes", len(resp.Changes))
+		return resp, nil
+	}
+
+	if !s.beginScan() {
+		return nil, status.Error(codes.Unavailable, "server is shutting down")
+	}
+	defer s.inflight.Done()
+
+	actor := policyAuthor(ctx, "")
+	byName := make(map[string]*pb.RepositoryInfo, len(repos))
+	for _, repo := range repos {
+		byName[repo.GetFullName()] = repo
+	}
+	changedOrgs := make(map[string]bool)
+	for _, change := range resp.Changes {
+		if change.Error != "" {
+			continue
+		}
+		repo := byName[change.GetRepository()]
+		err := s.applyRemediation(ctx, req.GetEndpoint(), repo, change)
+		entry := auditEntry{
+			Time:        time.Now().UTC(),
+			Actor:       actor,
+			ScanID:      req.GetScanId(),
+			Policy:      scan.GetPolicyName(),
+			Repository:  change.GetRepository(),
+			Action:      change.GetAction(),
+			Method:      change.GetMethod(),
+			Path:        change.GetPath(),
+			Description: change.GetDescription(),
+			Result:      "applied",
+		}
+		if err != nil {
+			change.Error = err.Error()
+			entry.Result, entry.Error = "failed", err.Error()
+			slog.WarnContext(ctx, "Remediation failed", "repo", change.GetRepository(), "action", change.GetAction().GetAction(), "error", err)
+		} else {
+			change.Applied = true
+			changedOrgs[repo.GetOwner()] = true
+			slog.InfoContext(ctx, "Remediation applied", "repo", change.GetRepository(), "action", change.GetAction().GetAction(),
+				"description", change.GetDescription(), "actor", actor)
+		}
+		remediationChanges.WithLabelValues(change.GetAction().GetAction(), entry.Result).Inc()
+		if err := s.audit.record(entry); err != nil {
+			// the change is made but unrecorded: stop before making more
+			slog.ErrorContext(ctx, "Failed to write the remediation audit log", "error", err)
+			return nil, status.Errorf(codes.Internal, "remediation audit log: %v", err)
+		}
+	}
+	// later scans must see the changes, not cached repository data
+	for org := range changedOrgs {
+		s.scanner.cache.invalidate(org)
+	}
+	return resp, nil
+}
+
+// applyRemediation applies a change with the client of the endpoint serving
+// the repository's owner
+func (s *Server) applyRemediation(ctx context.Context, endpointName string, repo *pb.RepositoryInfo, change *pb.PlannedChange) error {
+	endpoint, err := resolveEndpoint(endpointName, repo.GetOwner())
+	if err != nil {
+		return err
+	}
+	client, err := getGitHubClient(endpoint)
+	if err != nil {
+		return err
+	}
+	return applyChange(ctx, client, repo, change)
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v69/github"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github-scanner/src/pb"
+)
+
+// remediationScan is a scan of acme with two failed repositories and one
+// that passed
+func remediationScan() *pb.PolicyResponse {
+	return &pb.PolicyResponse{
+		ScanId:     "scan-1",
+		PolicyName: "collaborators",
+		Repositories: []*pb.RepositoryInfo{
+			{
+				Name:       "api",
+				Owner:      "acme",
+				FullName:   "acme/api",
+				ScanResult: "Failure",
+				Permissions: []*pb.RepositoryPermissions{
+					{Username: "bob", Role: "admin", Source: "user"},
+				},
+				Remediations: []*pb.RemediationAction{
+					{Action: actionRemoveCollaborator, User: "bob"},
+					{Action: actionArchive},
+				},
+			},
+			{
+				Name:       "web",
+				Owner:      "acme",
+				FullName:   "acme/web",
+				ScanResult: "Failure",
+				Remediations: []*pb.RemediationAction{
+					{Action: actionSetCollaboratorRole, User: "carol", Role: "push"},
+				},
+			},
+			{
+				Name:         "docs",
+				Owner:        "acme",
+				FullName:     "acme/docs",
+				ScanResult:   "Success",
+				Remediations: []*pb.RemediationAction{{Action: actionArchive}},
+			},
+		},
+	}
+}
+
+// newRemediationServer stores the scan as fetched from acme and returns a
+// server writing its audit log to the returned path; without audit the
+// server has no audit log
+func newRemediationServer(t *testing.T, scan *pb.PolicyResponse, origin scanOrigin, auth *Authenticator, audit bool) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	var log *auditLog
+	if audit {
+		var err error
+		if log, err = openAuditLog(path); err != nil {
+			t.Fatalf("openAuditLog: %v", err)
+		}
+		t.Cleanup(func() { log.file.Close() })
+	}
+	s := NewServer(defaultConfig(), auth, nil, nil, nil, log)
+	s.scans.put(scan, origin)
+	return s, path
+}
+
+func readAuditLog(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening the audit log: %v", err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func githubOK(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write([]byte(`{}`))
+}
+
+func TestRemediateDryRun(t *testing.T) {
+	gh := newFakeGitHub(t, "acme", githubOK)
+	s, path := newRemediationServer(t, remediationScan(), scanOrigin{org: "acme", fetched: true}, nil, true)
+
+	resp, err := s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1"})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	if !resp.GetDryRun() {
+		t.Error("a request without confirm isn't a dry run")
+	}
+	want := []string{
+		"DELETE /repos/acme/api/collaborators/bob",
+		"PATCH /repos/acme/api",
+		"PUT /repos/acme/web/collaborators/carol",
+	}
+	var got []string
+	for _, change := range resp.GetChanges() {
+		got = append(got, change.GetMethod()+" "+change.GetPath())
+		if change.GetApplied() || change.GetError() != "" {
+			t.Errorf("planned change %s: applied %v, error %q", change.GetPath(), change.GetApplied(), change.GetError())
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("planned %q, want %q", got, want)
+	}
+	if got := resp.GetChanges()[0].GetDescription(); got != "remove collaborator bob (admin)" {
+		t.Errorf("description = %q", got)
+	}
+	if requests := gh.received(); len(requests) > 0 {
+		t.Errorf("a dry run called GitHub: %q", requests)
+	}
+	if entries := readAuditLog(t, path); len(entries) > 0 {
+		t.Errorf("a dry run wrote %d audit entries", len(entries))
+	}
+}
+
+func TestRemediateConfirm(t *testing.T) {
+	gh := newFakeGitHub(t, "acme", githubOK)
+	s, path := newRemediationServer(t, remediationScan(), scanOrigin{org: "acme", fetched: true}, nil, true)
+	ctx := context.WithValue(context.Background(), principalKey{}, &Principal{Subject: "alice"})
+
+	resp, err := s.Remediate(ctx, &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	if resp.GetDryRun() {
+		t.Error("a confirmed request is reported as a dry run")
+	}
+	for _, change := range resp.GetChanges() {
+		if !change.GetApplied() || change.GetError() != "" {
+			t.Errorf("change %s: applied %v, error %q", change.GetPath(), change.GetApplied(), change.GetError())
+		}
+	}
+	want := []string{
+		"DELETE /repos/acme/api/collaborators/bob",
+		"PATCH /repos/acme/api",
+		"PUT /repos/acme/web/collaborators/carol",
+	}
+	if got := gh.received(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GitHub received %q, want %q", got, want)
+	}
+
+	entries := readAuditLog(t, path)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if got := entry.Method + " " + entry.Path; got != want[i] {
+			t.Errorf("audit entry %d is for %q, want %q", i, got, want[i])
+		}
+		if entry.Result != "applied" || entry.Error != "" {
+			t.Errorf("audit entry %d: result %q, error %q", i, entry.Result, entry.Error)
+		}
+		if entry.Actor != "alice" || entry.ScanID != "scan-1" || entry.Policy != "collaborators" {
+			t.Errorf("audit entry %d: actor %q, scan %q, policy %q", i, entry.Actor, entry.ScanID, entry.Policy)
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("audit entry %d has no time", i)
+		}
+	}
+}
+
+func TestRemediateRefusesAccessFromTeams(t *testing.T) {
+	gh := newFakeGitHub(t, "acme", githubOK)
+	scan := remediationScan()
+	scan.Repositories[0].Permissions[0].Source = "team:platform"
+	scan.Repositories[1].Permissions = []*pb.RepositoryPermissions{{Username: "carol", Role: "admin", Source: "team:admins"}}
+	s, _ := newRemediationServer(t, scan, scanOrigin{org: "acme", fetched: true}, nil, true)
+
+	resp, err := s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	changeErrors := map[string]string{}
+	for _, change := range resp.GetChanges() {
+		changeErrors[change.GetMethod()+" "+change.GetPath()] = change.GetError()
+		if change.GetApplied() == (change.GetError() != "") {
+			t.Errorf("change %s: applied %v, error %q", change.GetPath(), change.GetApplied(), change.GetError())
+		}
+	}
+	for change, want := range map[string]string{
+		"DELETE /repos/acme/api/collaborators/bob": "bob has admin access through team:platform",
+		"PUT /repos/acme/web/collaborators/carol":  "carol has admin access through team:admins",
+		"PATCH /repos/acme/api":                    "",
+	} {
+		if got := changeErrors[change]; (want == "") != (got == "") || !strings.Contains(got, want) {
+			t.Errorf("%s: error %q, want %q", change, got, want)
+		}
+	}
+	if got, want := gh.received(), []string{"PATCH /repos/acme/api"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GitHub received %q, want %q", got, want)
+	}
+}
+
+func TestRemediatePartialFailure(t *testing.T) {
+	gh := newFakeGitHub(t, "acme", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Must have admin rights to Repository."}`))
+			return
+		}
+		githubOK(w, r)
+	})
+	s, path := newRemediationServer(t, remediationScan(), scanOrigin{org: "acme", fetched: true}, nil, true)
+
+	resp, err := s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	changes := resp.GetChanges()
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3", len(changes))
+	}
+	if changes[0].GetApplied() || !strings.Contains(changes[0].GetError(), "Must have admin rights") {
+		t.Errorf("failed change: applied %v, error %q", changes[0].GetApplied(), changes[0].GetError())
+	}
+	for _, change := range changes[1:] {
+		if !change.GetApplied() {
+			t.Errorf("change %s after the failure wasn't applied: %q", change.GetPath(), change.GetError())
+		}
+	}
+	if got := len(gh.received()); got != 3 {
+		t.Errorf("GitHub received %d requests, want 3", got)
+	}
+
+	var results []string
+	for _, entry := range readAuditLog(t, path) {
+		results = append(results, entry.Result)
+	}
+	if want := []string{"failed", "applied", "applied"}; strings.Join(results, ",") != strings.Join(want, ",") {
+		t.Errorf("audit results %q, want %q", results, want)
+	}
+	if entry := readAuditLog(t, path)[0]; !strings.Contains(entry.Error, "Must have admin rights") {
+		t.Errorf("failed audit entry error = %q", entry.Error)
+	}
+}
+
+func TestRemediateRefusals(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin scanOrigin
+		audit  bool
+		req    *pb.RemediateRequest
+		code   codes.Code
+	}{
+		{
+			name:   "confirm without an audit log",
+			origin: scanOrigin{org: "acme", fetched: true},
+			req:    &pb.RemediateRequest{ScanId: "scan-1", Confirm: true},
+			code:   codes.FailedPrecondition,
+		},
+		{
+			name:   "scan not fetched from GitHub",
+			origin: scanOrigin{org: "acme"},
+			audit:  true,
+			req:    &pb.RemediateRequest{ScanId: "scan-1", Confirm: true},
+			code:   codes.FailedPrecondition,
+		},
+		{
+			name:   "dry run of a scan not fetched from GitHub",
+			origin: scanOrigin{org: "acme"},
+			audit:  true,
+			req:    &pb.RemediateRequest{ScanId: "scan-1"},
+			code:   codes.FailedPrecondition,
+		},
+		{
+			name:   "unknown scan",
+			origin: scanOrigin{org: "acme", fetched: true},
+			audit:  true,
+			req:    &pb.RemediateRequest{ScanId: "scan-2", Confirm: true},
+			code:   codes.NotFound,
+		},
+		{
+			name:   "repository not in the scan",
+			origin: scanOrigin{org: "acme", fetched: true},
+			audit:  true,
+			req:    &pb.RemediateRequest{ScanId: "scan-1", Confirm: true, Repositories: []string{"acme/missing"}},
+			code:   codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := newFakeGitHub(t, "acme", githubOK)
+			s, _ := newRemediationServer(t, remediationScan(), tt.origin, nil, tt.audit)
+
+			_, err := s.Remediate(context.Background(), tt.req)
+			if status.Code(err) != tt.code {
+				t.Fatalf("Remediate error = %v, want %s", err, tt.code)
+			}
+			if requests := gh.received(); len(requests) > 0 {
+				t.Errorf("a refused request called GitHub: %q", requests)
+			}
+		})
+	}
+}
+
+func TestRemediateAuthorizesRepositoryOwner(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "authz.rego")
+	if err := os.WriteFile(policy, []byte(`package authz
+
+default allow := false
+
+allow if input.org == "acme"
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := NewAuthenticator(AuthConfig{PolicyFile: policy}, "acme")
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	scan := remediationScan()
+	scan.Repositories = append(scan.Repositories, &pb.RepositoryInfo{
+		Name:         "tools",
+		Owner:        "contoso",
+		FullName:     "contoso/tools",
+		ScanResult:   "Failure",
+		Remediations: []*pb.RemediationAction{{Action: actionArchive}},
+	})
+	gh := newFakeGitHub(t, "acme", githubOK)
+	s, path := newRemediationServer(t, scan, scanOrigin{org: "acme", fetched: true}, auth, true)
+	ctx := context.WithValue(context.Background(), principalKey{}, &Principal{Subject: "alice"})
+
+	resp, err := s.Remediate(ctx, &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	for _, change := range resp.GetChanges() {
+		denied := change.GetRepository() == "contoso/tools"
+		if change.GetApplied() == denied {
+			t.Errorf("change %s: applied %v", change.GetPath(), change.GetApplied())
+		}
+		if denied && !strings.Contains(change.GetError(), "alice is not allowed") {
+			t.Errorf("denied change error = %q", change.GetError())
+		}
+	}
+	for _, request := range gh.received() {
+		if strings.Contains(request, "contoso") {
+			t.Errorf("GitHub received a denied change: %s", request)
+		}
+	}
+	for _, entry := range readAuditLog(t, path) {
+		if entry.Repository == "contoso/tools" {
+			t.Error("a denied change was recorded in the audit log")
+		}
+	}
+}
+
+// protectionServer serves the current protection of acme/api's main branch,
+// "Branch not protected" when current is empty, and records the PUT body
+func protectionServer(t *testing.T, current string) (*fakeGitHub, *github.ProtectionRequest) {
+	t.Helper()
+	put := &github.ProtectionRequest{}
+	gh := newFakeGitHub(t, "acme", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && current == "":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Branch not protected"}`))
+		case r.Method == http.MethodGet:
+			w.Write([]byte(current))
+		case r.Method == http.MethodPut:
+			if err := json.NewDecoder(r.Body).Decode(put); err != nil {
+				t.Errorf("decoding the protection request: %v", err)
+			}
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return gh, put
+}
+
+func protectionScan(protected bool) *pb.PolicyResponse {
+	repo := &pb.RepositoryInfo{
+		Name:          "api",
+		Owner:         "acme",
+		FullName:      "acme/api",
+		DefaultBranch: "main",
+		ScanResult:    "Failure",
+		Remediations: []*pb.RemediationAction{{
+			Action: actionEnableBranchProtection,
+			BranchProtection: &pb.BranchProtection{
+				RequiredApprovingReviewCount: 2,
+				EnforceAdmins:                true,
+				RequiresStatusChecks:         true,
+			},
+		}},
+	}
+	if protected {
+		repo.BranchProtection = &pb.BranchProtection{RequiredApprovingReviewCount: 1, RequiresStatusChecks: true, AllowsForcePushes: true}
+	}
+	return &pb.PolicyResponse{ScanId: "scan-1", PolicyName: "branch-protection", Repositories: []*pb.RepositoryInfo{repo}}
+}
+
+func TestRemediateBranchProtectionKeepsExistingRules(t *testing.T) {
+	gh, put := protectionServer(t, `{
+		"required_status_checks": {"strict": false, "checks": [{"context": "ci/build", "app_id": 15368}]},
+		"required_pull_request_reviews": {
+			"required_approving_review_count": 1,
+			"require_code_owner_reviews": true,
+			"require_last_push_approval": true,
+			"bypass_pull_request_allowances": {"users": [{"login": "release-bot"}], "teams": [], "apps": []}
+		},
+		"enforce_admins": {"enabled": false},
+		"restrictions": {"users": [{"login": "deployer"}], "teams": [{"slug": "release"}], "apps": [{"slug": "ci-app"}]},
+		"required_linear_history": {"enabled": true},
+		"allow_force_pushes": {"enabled": true},
+		"allow_deletions": {"enabled": false},
+		"required_conversation_resolution": {"enabled": true}
+	}`)
+	s, _ := newRemediationServer(t, protectionScan(true), scanOrigin{org: "acme", fetched: true}, nil, true)
+
+	resp, err := s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1"})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	if d := resp.GetChanges()[0].GetDescription(); !strings.Contains(d, "keeping its stricter rules, status checks and restrictions") {
+		t.Errorf("the dry run doesn't say the current protection is kept: %q", d)
+	}
+
+	resp, err = s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	if change := resp.GetChanges()[0]; !change.GetApplied() {
+		t.Fatalf("the protection wasn't applied: %q", change.GetError())
+	}
+	want := []string{"GET /repos/acme/api/branches/main/protection", "PUT /repos/acme/api/branches/main/protection"}
+	if got := gh.received(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("GitHub received %q, want %q", got, want)
+	}
+
+	checks := put.RequiredStatusChecks
+	if checks == nil || !checks.Strict || checks.Checks == nil || len(*checks.Checks) != 1 || (*checks.Checks)[0].Context != "ci/build" || checks.Contexts != nil {
+		t.Errorf("status checks = %+v, want ci/build kept and strict", checks)
+	}
+	r := put.Restrictions
+	if r == nil || strings.Join(r.Users, ",") != "deployer" || strings.Join(r.Teams, ",") != "release" || strings.Join(r.Apps, ",") != "ci-app" {
+		t.Errorf("restrictions = %+v, want the current ones", r)
+	}
+	reviews := put.RequiredPullRequestReviews
+	if reviews == nil || reviews.RequiredApprovingReviewCount != 2 || !reviews.RequireCodeOwnerReviews || !reviews.GetRequireLastPushApproval() {
+		t.Errorf("reviews = %+v, want 2 approvals and the current code owner and last push rules", reviews)
+	}
+	if reviews != nil && (reviews.BypassPullRequestAllowancesRequest == nil || strings.Join(reviews.BypassPullRequestAllowancesRequest.Users, ",") != "release-bot") {
+		t.Errorf("review bypass allowances = %+v, want release-bot kept", reviews.BypassPullRequestAllowancesRequest)
+	}
+	if !put.EnforceAdmins || !put.GetRequireLinearHistory() || !put.GetRequiredConversationResolution() {
+		t.Errorf("enforce admins %v, linear history %v, conversation resolution %v: want all kept or enabled",
+			put.EnforceAdmins, put.GetRequireLinearHistory(), put.GetRequiredConversationResolution())
+	}
+	if put.GetAllowForcePushes() || put.GetAllowDeletions() {
+		t.Error("the protection was loosened to allow force pushes or deletions")
+	}
+}
+
+func TestRemediateBranchProtectionOfUnprotectedBranch(t *testing.T) {
+	_, put := protectionServer(t, "")
+	s, _ := newRemediationServer(t, protectionScan(false), scanOrigin{org: "acme", fetched: true}, nil, true)
+
+	resp, err := s.Remediate(context.Background(), &pb.RemediateRequest{ScanId: "scan-1", Confirm: true})
+	if err != nil {
+		t.Fatalf("Remediate: %v", err)
+	}
+	if change := resp.GetChanges()[0]; !change.GetApplied() {
+		t.Fatalf("the protection wasn't applied: %q", change.GetError())
+	}
+	if put.RequiredPullRequestReviews == nil || put.RequiredPullRequestReviews.RequiredApprovingReviewCount != 2 || !put.EnforceAdmins {
+		t.Errorf("protection request = %+v, want the policy's rules", put)
+	}
+	if put.RequiredStatusChecks == nil || !put.RequiredStatusChecks.Strict || put.Restrictions != nil {
+		t.Errorf("status checks %+v, restrictions %+v", put.RequiredStatusChecks, put.Restrictions)
+	}
+}
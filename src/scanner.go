@@ -2,12 +2,18 @@ package main
 
 import (
     "context"
+    "errors"
     "fmt"
-    "log"
+    "log/slog"
     "strings"
+    "sync"
+    "time"
 
     "github.com/google/go-github/v69/github"
     "github.com/open-policy-agent/opa/v1/rego"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
+    "github-scanner/src/export"
     pb "github-scanner/src/pb"
 )
 
@@ -20,25 +26,91 @@ type RepositoryPermissions struct {
 
 // repository data
 type RepositoryInfo struct {
-    Name          string                  `json:"name"`
-    FullName      string                  `json:"full_name"`
-    Owner         string                  `json:"owner"`
-    Visibility    string                  `json:"visibility"`
-    Private       bool                    `json:"private"`
-    Description   string                  `json:"description"`
-    RepoURL       string                  `json:"repo_url"`
-    DefaultBranch string                  `json:"default_branch"`
-    LastUpdated   string                  `json:"last_updated"`
-    Permissions   []RepositoryPermissions `json:"permissions"`
-    ScanResult    string                  `json:"scan_result"`
+    Name             string                  `json:"name"`
+    FullName         string                  `json:"full_name"`
+    Owner            string                  `json:"owner"`
+    Visibility       string                  `json:"visibility"`
+    Private          bool                    `json:"private"`
+    Description      string                  `json:"description"`
+    RepoURL          string                  `json:"repo_url"`
+    DefaultBranch    string                  `json:"default_branch"`
+    LastUpdated      string                  `json:"last_updated"`
+    Permissions      []RepositoryPermissions `json:"permissions"`
+    ScanResult       string                  `json:"scan_result"`
+    BranchProtection *BranchProtection       `json:"branch_protection"`
+    // set when the repository details could not be fetched; not part of the policy input
+    FetchError       string                  `json:"-"`
+    // severity of a failure; not part of the policy input
+    Severity         string                  `json:"-"`
+    // changes the policy asks for to fix a failure; not part of the policy input
+    Remediations     []Remediation           `json:"-"`
+    // messages explaining a failure; not part of the policy input
+    Violations       []string                `json:"-"`
+}
+
+// protection settings of the default branch
+type BranchProtection struct {
+    RequiredApprovingReviewCount int  `json:"required_approving_review_count"`
+    RequiresCodeOwnerReviews     bool `json:"requires_code_owner_reviews"`
+    DismissesStaleReviews        bool `json:"dismisses_stale_reviews"`
+    RequiresStatusChecks         bool `json:"requires_status_checks"`
+    EnforceAdmins                bool `json:"enforce_admins"`
+    AllowsForcePushes            bool `json:"allows_force_pushes"`
+    AllowsDeletions              bool `json:"allows_deletions"`
+    RequiresLinearHistory        bool `json:"requires_linear_history"`
+}
+
+// Scanner runs scans with the server-wide scan and cache settings
+type Scanner struct {
+    concurrency int
+    backend     string
+    cache       *repoCache
+    // GraphQL rate-limit budget of each endpoint, shared by its scans
+    planners    *queryPlanners
+}
+
+func NewScanner(cfg *Config) *Scanner {
+    s := &Scanner{
+        concurrency: cfg.Scan.Concurrency,
+        backend:     cfg.Scan.Backend,
+        planners:    newQueryPlanners(),
+    }
+    if cfg.Cache.Enabled {
+        s.cache = newRepoCache(cfg.Cache.TTL.Duration)
+    }
+    return s
+}
+
+// ScanRequest describes a single scan of an organization
+type ScanRequest struct {
+    Endpoint string // named GitHub endpoint, empty to resolve from the org
+    Org      string
+    Policy   Policy
+    Backend  string // empty for the configured default
 }
 
 // calls ScanOrganization and converts results for gRPC
-func ScanOrganizationForGRPC(org string, policy string) []*pb.RepositoryInfo {
-    scannedRepos := ScanOrganization(org, policy)
+func (s *Scanner) ScanOrganizationForGRPC(ctx context.Context, req ScanRequest) ([]*pb.RepositoryInfo, error) {
+    scannedRepos, err := s.ScanOrganization(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    return repositoriesToProto(scannedRepos), nil
+}
+
+// evaluates the policy against repositories supplied by the caller, without fetching from GitHub
+func (s *Scanner) EvaluateRepositoriesForGRPC(ctx context.Context, policy Policy, repos []*pb.RepositoryInfo) ([]*pb.RepositoryInfo, error) {
+    evaluated, err := s.EvaluateRepositories(ctx, policy, repositoriesFromProto(repos))
+    if err != nil {
+        return nil, err
+    }
+    return repositoriesToProto(evaluated), nil
+}
+
+func repositoriesToProto(repos []RepositoryInfo) []*pb.RepositoryInfo {
     var grpcRepos []*pb.RepositoryInfo
 
-    for _, repo := range scannedRepos {
+    for _, repo := range repos {
         pbRepoInfo := &pb.RepositoryInfo{
             Name:          repo.Name,
             FullName:      repo.FullName,
@@ -50,6 +122,20 @@ func ScanOrganizationForGRPC(org string, policy string) []*pb.RepositoryInfo {
             DefaultBranch: repo.DefaultBranch,
             LastUpdated:   repo.LastUpdated,
             ScanResult:    repo.ScanResult,
+            Severity:      repo.Severity,
+            Violations:    repo.Violations,
+        }
+        if bp := repo.BranchProtection; bp != nil {
+            pbRepoInfo.BranchProtection = &pb.BranchProtection{
+                RequiredApprovingReviewCount: int32(bp.RequiredApprovingReviewCount),
+                RequiresCodeOwnerReviews:     bp.RequiresCodeOwnerReviews,
+                DismissesStaleReviews:        bp.DismissesStaleReviews,
+                RequiresStatusChecks:         bp.RequiresStatusChecks,
+                EnforceAdmins:                bp.EnforceAdmins,
+                AllowsForcePushes:            bp.AllowsForcePushes,
+                AllowsDeletions:              bp.AllowsDeletions,
+                RequiresLinearHistory:        bp.RequiresLinearHistory,
+            }
         }
         // Convert permissions
         for _, perm := range repo.Permissions {
@@ -59,98 +145,370 @@ func ScanOrganizationForGRPC(org string, policy string) []*pb.RepositoryInfo {
                 Source:   perm.Source,
             })
         }
+        pbRepoInfo.Remediations = remediationsToProto(repo.Remediations)
+        pbRepoInfo.RiskScore = export.RiskScore(pbRepoInfo)
         grpcRepos = append(grpcRepos, pbRepoInfo)
     }
 
     return grpcRepos
 }
 
+func repositoriesFromProto(grpcRepos []*pb.RepositoryInfo) []RepositoryInfo {
+    repos := make([]RepositoryInfo, 0, len(grpcRepos))
+    for _, r := range grpcRepos {
+        repo := RepositoryInfo{
+            Name:          r.GetName(),
+            FullName:      r.GetFullName(),
+            Owner:         r.GetOwner(),
+            Visibility:    r.GetVisibility(),
+            Private:       r.GetPrivate(),
+            Description:   r.GetDescription(),
+            RepoURL:       r.GetRepoUrl(),
+            DefaultBranch: r.GetDefaultBranch(),
+            LastUpdated:   r.GetLastUpdated(),
+        }
+        if bp := r.GetBranchProtection(); bp != nil {
+            repo.BranchProtection = &BranchProtection{
+                RequiredApprovingReviewCount: int(bp.GetRequiredApprovingReviewCount()),
+                RequiresCodeOwnerReviews:     bp.GetRequiresCodeOwnerReviews(),
+                DismissesStaleReviews:        bp.GetDismissesStaleReviews(),
+                RequiresStatusChecks:         bp.GetRequiresStatusChecks(),
+                EnforceAdmins:                bp.GetEnforceAdmins(),
+                AllowsForcePushes:            bp.GetAllowsForcePushes(),
+                AllowsDeletions:              bp.GetAllowsDeletions(),
+                RequiresLinearHistory:        bp.GetRequiresLinearHistory(),
+            }
+        }
+        for _, perm := range r.GetPermissions() {
+            repo.Permissions = append(repo.Permissions, RepositoryPermissions{
+                Username: perm.GetUsername(),
+                Role:     perm.GetRole(),
+                Source:   perm.GetSource(),
+            })
+        }
+        repos = append(repos, repo)
+    }
+    return repos
+}
+
 // fetches repositories and evaluates them against the policy
-func ScanOrganization(org string, policy string) []RepositoryInfo {
-    client := getGitHubClient()
+func (s *Scanner) ScanOrganization(ctx context.Context, req ScanRequest) (_ []RepositoryInfo, err error) {
+    org, policy := req.Org, req.Policy
+    backend := req.Backend
+    if backend == "" {
+        backend = s.backend
+    }
 
-    ctx := context.Background()
-    opt := &github.RepositoryListByOrgOptions{Type: "all"}
-    var allRepos []*github.Repository
-    var scannedRepos []RepositoryInfo
+    ctx, span := tracer.Start(ctx, "ScanOrganization", trace.WithAttributes(
+        attribute.String("org", org),
+        attribute.String("backend", backend),
+    ))
+    defer func() { endSpan(span, err) }()
 
-    log.Printf("Fetching repositories for organization: %s", org)
+    start := time.Now()
+    defer func() {
+        scanDuration.WithLabelValues(org).Observe(time.Since(start).Seconds())
+    }()
 
-    // Fetch all repositories in the organization
-    for {
-        repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
-        if err != nil {
-            log.Fatalf("Error fetching repositories for %s: %v", org, err)
-        }
+    allRepos, err := s.fetchRepositories(ctx, req.Endpoint, org, backend)
+    if err != nil {
+        scansTotal.WithLabelValues(org, "error").Inc()
+        return nil, err
+    }
 
-        allRepos = append(allRepos, repos...)
-        log.Printf("Fetched %d repositories so far...", len(allRepos))
+    slog.InfoContext(ctx, "Repositories found", "count", len(allRepos))
+    reposProcessed.WithLabelValues("fetch").Add(float64(len(allRepos)))
 
-        if resp.NextPage == 0 {
-            log.Println("No more pages to fetch.")
-            break
-        }
-        opt.Page = resp.NextPage
+    scannedRepos, err := s.EvaluateRepositories(ctx, policy, allRepos)
+    if err != nil {
+        scansTotal.WithLabelValues(org, "error").Inc()
+        return nil, fmt.Errorf("scan of %s aborted: %w", org, err)
     }
 
-    log.Printf("Total repositories found: %d", len(allRepos))
+    scansTotal.WithLabelValues(org, "success").Inc()
+    slog.InfoContext(ctx, "Scan complete", "repositories", len(scannedRepos))
+    return scannedRepos, nil
+}
+
+// evaluates every repository against the policy and records the outcome in
+// ScanResult; only a cancelled context aborts the evaluation
+func (s *Scanner) EvaluateRepositories(ctx context.Context, policy Policy, repos []RepositoryInfo) ([]RepositoryInfo, error) {
+    var scannedRepos []RepositoryInfo
+
+    // Compile once; a broken policy is reported on every repository
+    query, prepareErr := preparePolicy(ctx, policy)
+    severity, severityErr := policy.annotatedSeverity()
+    if prepareErr == nil {
+        prepareErr = severityErr
+    }
+
+    // Decisions of shadow versions don't count as enforced decisions
+    decisions := policyDecisions
+    if policy.Shadow {
+        decisions = shadowDecisions
+    }
 
     // Process each repository
-    for _, repo := range allRepos {
-        repoInfo := scanRepository(ctx, org, repo, client)
-        log.Printf("Processing repository: %s", repoInfo.FullName)
+    for _, repoInfo := range repos {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        slog.DebugContext(ctx, "Processing repository", "repo", repoInfo.FullName)
+
+        // Repositories whose details could not be fetched are not evaluated
+        if repoInfo.FetchError != "" {
+            repoInfo.ScanResult = export.FetchErrorPrefix + repoInfo.FetchError
+            decisions.WithLabelValues("error").Inc()
+            reposProcessed.WithLabelValues("evaluate").Inc()
+            scannedRepos = append(scannedRepos, repoInfo)
+            continue
+        }
 
         // Evaluate the repository against the policy
-        success, err := evaluatePolicy(policy, repoInfo)
+        var decision policyDecision
+        err := prepareErr
+        if err == nil {
+            evalCtx, evalSpan := tracer.Start(ctx, "evaluatePolicy", trace.WithAttributes(attribute.String("repo", repoInfo.FullName)))
+            decision, err = evaluatePolicy(evalCtx, query, repoInfo, severity)
+            endSpan(evalSpan, err)
+        }
         if err != nil {
-            log.Printf("Policy evaluation error for %s: %v", repoInfo.FullName, err)
+            slog.WarnContext(ctx, "Policy evaluation error", "repo", repoInfo.FullName, "error", err)
             if strings.Contains(err.Error(), "rego_parse_error") {
                 repoInfo.ScanResult = "Rego Parsing Error"
             } else {
                 repoInfo.ScanResult = err.Error() // General error
             }
-        } else if success {
+            decisions.WithLabelValues("error").Inc()
+        } else if decision.Allowed {
             repoInfo.ScanResult = "Success"
+            decisions.WithLabelValues("success").Inc()
         } else {
             repoInfo.ScanResult = "Failure"
+            repoInfo.Severity = decision.Severity
+            repoInfo.Remediations = decision.Remediations
+            repoInfo.Violations = decision.Violations
+            decisions.WithLabelValues("failure").Inc()
         }
 
+        reposProcessed.WithLabelValues("evaluate").Inc()
         scannedRepos = append(scannedRepos, repoInfo)
     }
+    return scannedRepos, nil
+}
+
+// fetches the org's repositories, from the cache when a recent copy exists
+func (s *Scanner) fetchRepositories(ctx context.Context, endpointName string, org string, backend string) (_ []RepositoryInfo, err error) {
+    ctx, span := tracer.Start(ctx, "FetchRepositories")
+    defer func() { endSpan(span, err) }()
+
+    endpoint, err := resolveEndpoint(endpointName, org)
+    if err != nil {
+        return nil, err
+    }
+    span.SetAttributes(attribute.String("github.endpoint", endpoint.Name))
+
+    cacheKey := repoCacheKey(endpoint.Name, org, strings.ToLower(backend))
+    repos, cached := s.cache.get(cacheKey)
+    span.SetAttributes(attribute.Bool("cache_hit", cached))
+    if cached {
+        slog.InfoContext(ctx, "Using cached repositories", "github_endpoint", endpoint.Name)
+        return repos, nil
+    }
+
+    client, err := getGitHubClient(endpoint)
+    if err != nil {
+        return nil, err
+    }
+    fetcher, err := newRepositoryFetcher(backend, client, s.concurrency, s.planners.get(endpoint.Name))
+    if err != nil {
+        return nil, err
+    }
+
+    slog.InfoContext(ctx, "Fetching repositories", "github_endpoint", endpoint.Name, "backend", fetcher.Name())
+
+    repos, err = fetcher.FetchRepositories(ctx, org)
+    if err != nil {
+        return nil, err
+    }
+    span.SetAttributes(attribute.Int("repositories", len(repos)))
+    s.cache.put(cacheKey, repos)
+    return repos, nil
+}
+
+// fetch backends accepted in PolicyRequest.backend
+const (
+    BackendREST    = "rest"
+    BackendGraphQL = "graphql"
+)
+
+// RepositoryFetcher loads the normalized repository data of an organization
+type RepositoryFetcher interface {
+    Name() string
+    FetchRepositories(ctx context.Context, org string) ([]RepositoryInfo, error)
+}
+
+func newRepositoryFetcher(backend string, client *github.Client, concurrency int, planner *queryPlanner) (RepositoryFetcher, error) {
+    switch strings.ToLower(backend) {
+    case "", BackendREST:
+        return &restFetcher{client: client, concurrency: concurrency}, nil
+    case BackendGraphQL:
+        return newGraphQLFetcher(client, planner), nil
+    default:
+        return nil, fmt.Errorf("unknown fetch backend %q", backend)
+    }
+}
+
+// restFetcher walks the REST API repository by repository, fetching up to
+// concurrency repositories at a time
+type restFetcher struct {
+    client      *github.Client
+    concurrency int
+}
 
-    log.Println("Scan complete. Returning results.")
-    return scannedRepos
+func (f *restFetcher) Name() string {
+    return BackendREST
+}
+
+func (f *restFetcher) FetchRepositories(ctx context.Context, org string) ([]RepositoryInfo, error) {
+    opt := &github.RepositoryListByOrgOptions{Type: "all"}
+    var allRepos []*github.Repository
+
+    // Fetch all repositories in the organization
+    for {
+        repos, resp, err := f.client.Repositories.ListByOrg(ctx, org, opt)
+        if err != nil {
+            return nil, fmt.Errorf("error fetching repositories for %s: %w", org, err)
+        }
+
+        allRepos = append(allRepos, repos...)
+        slog.DebugContext(ctx, "Fetched repositories page", "fetched", len(allRepos))
+
+        if resp.NextPage == 0 {
+            slog.DebugContext(ctx, "No more pages to fetch")
+            break
+        }
+        opt.Page = resp.NextPage
+    }
+
+    workers := f.concurrency
+    if workers < 1 {
+        workers = 1
+    }
+    repoInfos := make([]RepositoryInfo, len(allRepos))
+    sem := make(chan struct{}, workers)
+    var wg sync.WaitGroup
+    for i, repo := range allRepos {
+        wg.Add(1)
+        sem <- struct{}{}
+        go func() {
+            defer wg.Done()
+            defer func() { <-sem }()
+            repoInfos[i] = scanRepository(ctx, org, repo, f.client)
+        }()
+    }
+    wg.Wait()
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("error fetching repositories for %s: %w", org, err)
+    }
+    return repoInfos, nil
 }
 
 // fetches repo metadata and permissions
 func scanRepository(ctx context.Context, org string, repo *github.Repository, client *github.Client) RepositoryInfo {
+    ctx, span := tracer.Start(ctx, "scanRepository", trace.WithAttributes(attribute.String("repo", repo.GetFullName())))
+    defer span.End()
+
     repoDetails, _, err := client.Repositories.Get(ctx, org, repo.GetName())
     if err != nil {
-        log.Printf("Skipping %s due to error: %v", repo.GetName(), err)
-        return RepositoryInfo{}
+        slog.WarnContext(ctx, "Failed to fetch repository", "repo", repo.GetName(), "error", err)
+        span.RecordError(err)
+        return RepositoryInfo{
+            Name:       repo.GetName(),
+            FullName:   repo.GetFullName(),
+            Owner:      repo.GetOwner().GetLogin(),
+            Visibility: repo.GetVisibility(),
+            Private:    repo.GetPrivate(),
+            RepoURL:    repo.GetHTMLURL(),
+            FetchError: err.Error(),
+        }
     }
 
+    return describeRepository(ctx, org, repoDetails, client)
+}
+
+// fetches the permissions and branch protection of a repository and
+// normalizes its data
+func describeRepository(ctx context.Context, org string, repoDetails *github.Repository, client *github.Client) RepositoryInfo {
     // collaborator/team permissions
     permissions := FetchRepositoryPermissions(ctx, repoDetails, org, client)
 
     // Return normalized data
-    return NormalizeRepoData(repoDetails, permissions)
+    repoInfo := NormalizeRepoData(repoDetails, permissions)
+    bp, err := FetchBranchProtection(ctx, repoDetails, client)
+    if err != nil {
+        // policies would read a missing protection as an unprotected branch
+        slog.WarnContext(ctx, "Error fetching branch protection", "repo", repoDetails.GetName(), "error", err)
+        repoInfo.FetchError = branchProtectionError(repoDetails.GetDefaultBranch(), err.Error())
+    }
+    repoInfo.BranchProtection = bp
+    return repoInfo
+}
+
+// branchProtectionError is the fetch error of a repository whose branch
+// protection is unknown
+func branchProtectionError(branch, reason string) string {
+    return fmt.Sprintf("branch protection of %s is unknown: %s", branch, reason)
+}
+
+// retrieves the protection of the default branch, nil if it is unprotected.
+// Other errors, such as the 403 or 404 of a token that can't administer the
+// repository, are returned: the protection is unknown, not absent.
+func FetchBranchProtection(ctx context.Context, repo *github.Repository, client *github.Client) (*BranchProtection, error) {
+    ctx, span := tracer.Start(ctx, "FetchBranchProtection")
+    defer span.End()
+
+    protection, _, err := client.Repositories.GetBranchProtection(ctx, repo.GetOwner().GetLogin(), repo.GetName(), repo.GetDefaultBranch())
+    if errors.Is(err, github.ErrBranchNotProtected) {
+        return nil, nil
+    }
+    if err != nil {
+        span.RecordError(err)
+        return nil, err
+    }
+
+    bp := &BranchProtection{
+        RequiresStatusChecks:  protection.RequiredStatusChecks != nil,
+        EnforceAdmins:         protection.GetEnforceAdmins().Enabled,
+        AllowsForcePushes:     protection.GetAllowForcePushes().Enabled,
+        AllowsDeletions:       protection.GetAllowDeletions().Enabled,
+        RequiresLinearHistory: protection.GetRequireLinearHistory().Enabled,
+    }
+    if reviews := protection.RequiredPullRequestReviews; reviews != nil {
+        bp.RequiredApprovingReviewCount = reviews.RequiredApprovingReviewCount
+        bp.RequiresCodeOwnerReviews = reviews.RequireCodeOwnerReviews
+        bp.DismissesStaleReviews = reviews.DismissStaleReviews
+    }
+    return bp, nil
 }
 
 // retrieves collaborator permissions for a repository
 func FetchRepositoryPermissions(ctx context.Context, repo *github.Repository, org string, client *github.Client) []RepositoryPermissions {
+    ctx, span := tracer.Start(ctx, "FetchRepositoryPermissions")
+    defer span.End()
+
     owner := repo.GetOwner().GetLogin()
     repoName := repo.GetName()
 
     collaborators, _, err := client.Repositories.ListCollaborators(ctx, owner, repoName, nil)
     if err != nil {
-        log.Printf("Error fetching collaborators for %s: %v", repoName, err)
+        slog.WarnContext(ctx, "Error fetching collaborators", "repo", repoName, "error", err)
         return nil
     }
 
     teams, _, err := client.Repositories.ListTeams(ctx, owner, repoName, nil)
     if err != nil {
-        log.Printf("Error fetching teams for %s: %v", repoName, err)
+        slog.WarnContext(ctx, "Error fetching teams", "repo", repoName, "error", err)
     }
 
     // Map team members to their respective teams
@@ -159,7 +517,7 @@ func FetchRepositoryPermissions(ctx context.Context, repo *github.Repository, or
         teamSlug := team.GetSlug()
         members, _, err := client.Teams.ListTeamMembersBySlug(ctx, org, teamSlug, nil)
         if err != nil {
-            log.Printf("Error fetching members for team %s: %v", teamSlug, err)
+            slog.WarnContext(ctx, "Error fetching team members", "team", teamSlug, "error", err)
             continue
         }
         for _, member := range members {
@@ -172,7 +530,7 @@ func FetchRepositoryPermissions(ctx context.Context, repo *github.Repository, or
     for _, collab := range collaborators {
         perm, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repoName, collab.GetLogin())
         if err != nil {
-            log.Printf("Error fetching permissions for %s in %s: %v", collab.GetLogin(), repoName, err)
+            slog.WarnContext(ctx, "Error fetching permission level", "repo", repoName, "user", collab.GetLogin(), "error", err)
             continue
         }
 
@@ -191,43 +549,68 @@ func FetchRepositoryPermissions(ctx context.Context, repo *github.Repository, or
     return permissions
 }
 
-// evaluatePolicy runs the repository data against the provided Rego policy
-func evaluatePolicy(policy string, input interface{}) (bool, error) {
-    ctx := context.Background()
+// preparePolicy compiles the Rego policy once so it can be evaluated for every repository
+func preparePolicy(ctx context.Context, policy Policy) (_ rego.PreparedEvalQuery, err error) {
+    ctx, span := tracer.Start(ctx, "preparePolicy")
+    defer func() { endSpan(span, err) }()
 
-    r := rego.New(
-        rego.Query("data.repository"),
-        rego.Module("repository.rego", policy),
-        rego.Input(input),
-    )
+    start := time.Now()
+    defer func() {
+        policyCompileDuration.Observe(time.Since(start).Seconds())
+    }()
+
+    r := rego.New(policy.regoOptions()...)
 
     query, err := r.PrepareForEval(ctx)
     if err != nil {
-        return false, fmt.Errorf("failed to prepare rego query: %w", err)
+        return query, fmt.Errorf("failed to prepare rego query: %w", err)
     }
+    return query, nil
+}
+
+// policyDecision is the outcome of a policy for one repository
+type policyDecision struct {
+    Allowed bool
+    // severity of a denial
+    Severity string
+    // actions that fix a denial
+    Remediations []Remediation
+    // messages of the policy's violations rule
+    Violations []string
+}
 
-    rs, err := query.Eval(ctx)
+// evaluatePolicy runs the repository data against the prepared Rego policy.
+// A "severity" in the policy output overrides the annotated severity.
+func evaluatePolicy(ctx context.Context, query rego.PreparedEvalQuery, input interface{}, severity string) (policyDecision, error) {
+    start := time.Now()
+    defer func() {
+        policyEvalDuration.Observe(time.Since(start).Seconds())
+    }()
+
+    rs, err := query.Eval(ctx, rego.EvalInput(input))
     if err != nil {
-        return false, fmt.Errorf("failed to evaluate policy: %w", err)
+        return policyDecision{}, fmt.Errorf("failed to evaluate policy: %w", err)
     }
 
+    decision := policyDecision{Severity: severity}
     if len(rs) > 0 && len(rs[0].Expressions) > 0 {
         policyResults, ok := rs[0].Expressions[0].Value.(map[string]interface{})
         if !ok {
-            return false, fmt.Errorf("invalid policy evaluation result format")
-        }
-
-        // Check for deny
-        if deny, exists := policyResults["deny"].(bool); exists && deny {
-            return false, nil
+            return policyDecision{}, fmt.Errorf("invalid policy evaluation result format")
         }
-        // Check for allow
-        if allow, exists := policyResults["allow"].(bool); exists && allow {
-            return true, nil
+        // Check for allow, unless denied
+        deny, _ := policyResults["deny"].(bool)
+        if allow, exists := policyResults["allow"].(bool); exists && allow && !deny {
+            decision.Allowed = true
+            return decision, nil
         }
+        // only a denial is described
+        decision.Severity = decisionSeverity(policyResults, severity)
+        decision.Remediations = decisionRemediations(policyResults)
+        decision.Violations = decisionViolations(policyResults)
     }
     // Default: deny if no explicit allow
-    return false, nil
+    return decision, nil
 }
 
 func NormalizeRepoData(repo *github.Repository, permissions []RepositoryPermissions) RepositoryInfo {
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+const decisionTestPolicy = `package repo
+
+allow if input.private
+
+severity := "high"
+
+violations contains "repository is public" if not input.private
+
+violations contains "repository has no description" if input.description == ""
+
+remediations contains {"action": "archive"} if not input.private
+`
+
+func TestEvaluatePolicyDescribesOnlyDenials(t *testing.T) {
+	ctx := context.Background()
+	query, err := rego.New(rego.Query("data.repo"), rego.Module("repo.rego", decisionTestPolicy)).PrepareForEval(ctx)
+	if err != nil {
+		t.Fatalf("preparing the policy: %v", err)
+	}
+
+	allowed, err := evaluatePolicy(ctx, query, map[string]interface{}{"private": true, "description": ""}, "low")
+	if err != nil {
+		t.Fatalf("evaluatePolicy: %v", err)
+	}
+	if !allowed.Allowed || allowed.Violations != nil || allowed.Remediations != nil {
+		t.Errorf("allowed decision = %+v, want no violations or remediations", allowed)
+	}
+
+	denied, err := evaluatePolicy(ctx, query, map[string]interface{}{"private": false, "description": ""}, "low")
+	if err != nil {
+		t.Fatalf("evaluatePolicy: %v", err)
+	}
+	if denied.Allowed {
+		t.Fatal("a public repository was allowed")
+	}
+	if want := []string{"repository has no description", "repository is public"}; !slices.Equal(denied.Violations, want) {
+		t.Errorf("violations = %q, want %q", denied.Violations, want)
+	}
+	if denied.Severity != "high" || len(denied.Remediations) != 1 {
+		t.Errorf("denied decision = %+v, want high severity and one remediation", denied)
+	}
+}
+
+// fixtureRepo is a repository both backends are served from
+type fixtureRepo struct {
+	name, visibility, description string
+	admin                         bool // the token can administer it
+	protection                    string
+	collaborators                 []fixtureCollaborator
+}
+
+type fixtureCollaborator struct {
+	login, permission, team string // permission as GraphQL names it
+}
+
+// protection of a fixture repository
+const (
+	fixtureProtected   = "protected"
+	fixtureUnprotected = "unprotected"
+	fixtureForbidden   = "forbidden" // reading the protection fails
+)
+
+var fetchFixture = []fixtureRepo{
+	{
+		name: "api", visibility: "private", description: "API server", admin: true, protection: fixtureProtected,
+		collaborators: []fixtureCollaborator{{"alice", "ADMIN", ""}, {"bob", "WRITE", "devs"}},
+	},
+	{
+		name: "web", visibility: "public", admin: true, protection: fixtureUnprotected,
+		collaborators: []fixtureCollaborator{{"carol", "READ", ""}},
+	},
+	// without admin rights the protection can't be read: REST answers 404,
+	// GraphQL a null rule
+	{
+		name: "docs", visibility: "internal", protection: fixtureProtected,
+		collaborators: []fixtureCollaborator{{"dave", "READ", ""}},
+	},
+	{
+		name: "lib", visibility: "public", admin: true, protection: fixtureForbidden,
+		collaborators: []fixtureCollaborator{{"erin", "WRITE", ""}},
+	},
+}
+
+const fixtureUpdatedAt = "2026-01-02T03:04:05Z"
+
+func fixtureREST(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	fail := func(code int, message string) {
+		w.WriteHeader(code)
+		reply(map[string]string{"message": message})
+	}
+	restPermission := map[string]string{"ADMIN": "admin", "WRITE": "write", "READ": "read"}
+
+	if r.URL.Path == "/orgs/acme/repos" {
+		var repos []map[string]interface{}
+		for _, repo := range fetchFixture {
+			repos = append(repos, map[string]interface{}{"name": repo.name, "full_name": "acme/" + repo.name, "owner": map[string]string{"login": "acme"}})
+		}
+		reply(repos)
+		return
+	}
+	if members, ok := strings.CutPrefix(r.URL.Path, "/orgs/acme/teams/"); ok {
+		team := strings.TrimSuffix(members, "/members")
+		var users []map[string]string
+		for _, repo := range fetchFixture {
+			for _, c := range repo.collaborators {
+				if c.team == team {
+					users = append(users, map[string]string{"login": c.login})
+				}
+			}
+		}
+		reply(users)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/acme/"), "/")
+	i := slices.IndexFunc(fetchFixture, func(repo fixtureRepo) bool { return repo.name == parts[0] })
+	if i < 0 {
+		fail(http.StatusNotFound, "Not Found")
+		return
+	}
+	repo := fetchFixture[i]
+	switch {
+	case len(parts) == 1:
+		reply(map[string]interface{}{
+			"name":           repo.name,
+			"full_name":      "acme/" + repo.name,
+			"owner":          map[string]string{"login": "acme"},
+			"visibility":     repo.visibility,
+			"private":        repo.visibility == "private",
+			"description":    repo.description,
+			"html_url":       "https://github.com/acme/" + repo.name,
+			"default_branch": "main",
+			"updated_at":     fixtureUpdatedAt,
+		})
+	case parts[1] == "collaborators" && len(parts) == 2:
+		var users []map[string]string
+		for _, c := range repo.collaborators {
+			users = append(users, map[string]string{"login": c.login})
+		}
+		reply(users)
+	case parts[1] == "collaborators" && len(parts) == 4:
+		for _, c := range repo.collaborators {
+			if c.login == parts[2] {
+				reply(map[string]interface{}{"permission": restPermission[c.permission], "user": map[string]string{"login": c.login}})
+				return
+			}
+		}
+		fail(http.StatusNotFound, "Not Found")
+	case parts[1] == "teams":
+		teams := []map[string]string{}
+		for _, c := range repo.collaborators {
+			if c.team != "" && !slices.ContainsFunc(teams, func(t map[string]string) bool { return t["slug"] == c.team }) {
+				teams = append(teams, map[string]string{"slug": c.team})
+			}
+		}
+		reply(teams)
+	case parts[1] == "branches" && len(parts) == 4 && parts[3] == "protection":
+		switch {
+		case repo.protection == fixtureForbidden:
+			fail(http.StatusForbidden, "Resource not accessible by integration")
+		case !repo.admin:
+			fail(http.StatusNotFound, "Not Found")
+		case repo.protection == fixtureUnprotected:
+			fail(http.StatusNotFound, "Branch not protected")
+		default:
+			reply(map[string]interface{}{
+				"required_status_checks":        map[string]interface{}{"strict": true, "contexts": []string{"ci"}},
+				"required_pull_request_reviews": map[string]interface{}{"required_approving_review_count": 2, "require_code_owner_reviews": true},
+				"enforce_admins":                map[string]bool{"enabled": true},
+				"allow_force_pushes":            map[string]bool{"enabled": false},
+				"allow_deletions":               map[string]bool{"enabled": false},
+				"required_linear_history":       map[string]bool{"enabled": true},
+			})
+		}
+	default:
+		fail(http.StatusNotFound, "Not Found")
+	}
+}
+
+func fixtureGraphQL(w http.ResponseWriter, r *http.Request) {
+	var nodes []map[string]interface{}
+	var errs []map[string]interface{}
+	for i, repo := range fetchFixture {
+		var rule interface{}
+		if repo.admin && repo.protection == fixtureProtected {
+			rule = map[string]interface{}{
+				"requiresApprovingReviews":     true,
+				"requiredApprovingReviewCount": 2,
+				"requiresCodeOwnerReviews":     true,
+				"dismissesStaleReviews":        false,
+				"requiresStatusChecks":         true,
+				"isAdminEnforced":              true,
+				"allowsForcePushes":            false,
+				"allowsDeletions":              false,
+				"requiresLinearHistory":        true,
+			}
+		}
+		if repo.protection == fixtureForbidden {
+			errs = append(errs, map[string]interface{}{
+				"type":    "FORBIDDEN",
+				"message": "Resource not accessible by integration",
+				"path":    []interface{}{"organization", "repositories", "nodes", i, "defaultBranchRef", "branchProtectionRule"},
+			})
+		}
+		var edges []map[string]interface{}
+		for _, c := range repo.collaborators {
+			sources := []map[string]interface{}{{"source": map[string]string{"__typename": "Repository"}}}
+			if c.team != "" {
+				sources = append([]map[string]interface{}{{"source": map[string]string{"__typename": "Team", "slug": c.team}}}, sources...)
+			}
+			edges = append(edges, map[string]interface{}{"permission": c.permission, "node": map[string]string{"login": c.login}, "permissionSources": sources})
+		}
+		nodes = append(nodes, map[string]interface{}{
+			"name":                repo.name,
+			"nameWithOwner":       "acme/" + repo.name,
+			"owner":               map[string]string{"login": "acme"},
+			"visibility":          strings.ToUpper(repo.visibility),
+			"isPrivate":           repo.visibility == "private",
+			"description":         repo.description,
+			"url":                 "https://github.com/acme/" + repo.name,
+			"updatedAt":           fixtureUpdatedAt,
+			"viewerCanAdminister": repo.admin,
+			"defaultBranchRef":    map[string]interface{}{"name": "main", "branchProtectionRule": rule},
+			"collaborators":       map[string]interface{}{"pageInfo": map[string]interface{}{"hasNextPage": false}, "edges": edges},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"rateLimit": map[string]interface{}{"cost": 1, "remaining": 4999, "resetAt": "2030-01-01T00:00:00Z"},
+			"organization": map[string]interface{}{
+				"repositories": map[string]interface{}{"pageInfo": map[string]interface{}{"hasNextPage": false}, "nodes": nodes},
+			},
+		},
+		"errors": errs,
+	})
+}
+
+func TestFetchBackendsAgree(t *testing.T) {
+	gh := newFakeGitHub(t, "acme", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/graphql" {
+			fixtureGraphQL(w, r)
+			return
+		}
+		fixtureREST(w, r)
+	})
+	client, err := getGitHubClient(gh.endpoint)
+	if err != nil {
+		t.Fatalf("getGitHubClient: %v", err)
+	}
+
+	fetched := make(map[string][]RepositoryInfo)
+	for _, backend := range []string{BackendREST, BackendGraphQL} {
+		fetcher, err := newRepositoryFetcher(backend, client, 2, newQueryPlanner())
+		if err != nil {
+			t.Fatalf("newRepositoryFetcher(%s): %v", backend, err)
+		}
+		repos, err := fetcher.FetchRepositories(context.Background(), "acme")
+		if err != nil {
+			t.Fatalf("%s: FetchRepositories: %v", backend, err)
+		}
+		fetched[backend] = repos
+	}
+
+	rest, graphql := fetched[BackendREST], fetched[BackendGraphQL]
+	if len(rest) != len(fetchFixture) || len(graphql) != len(fetchFixture) {
+		t.Fatalf("got %d REST and %d GraphQL repositories, want %d", len(rest), len(graphql), len(fetchFixture))
+	}
+	for i := range fetchFixture {
+		r, g := rest[i], graphql[i]
+		// the reasons are worded by each API; both must fail the repository
+		unknown := fetchFixture[i].protection == fixtureForbidden || !fetchFixture[i].admin
+		for backend, repo := range map[string]RepositoryInfo{BackendREST: r, BackendGraphQL: g} {
+			if got := strings.HasPrefix(repo.FetchError, "branch protection of main is unknown: "); got != unknown {
+				t.Errorf("%s %s: fetch error %q", backend, repo.FullName, repo.FetchError)
+			}
+		}
+		r.FetchError, g.FetchError = "", ""
+		if !reflect.DeepEqual(r, g) {
+			t.Errorf("%s differs between the backends:\nREST:    %+v\nGraphQL: %+v", fetchFixture[i].name, r, g)
+		}
+	}
+
+	api := rest[0]
+	if api.BranchProtection == nil || api.BranchProtection.RequiredApprovingReviewCount != 2 || !api.BranchProtection.RequiresStatusChecks {
+		t.Errorf("acme/api protection = %+v", api.BranchProtection)
+	}
+	if rest[1].BranchProtection != nil {
+		t.Errorf("acme/web is unprotected, got %+v", rest[1].BranchProtection)
+	}
+	if want := []RepositoryPermissions{{"alice", "admin", "user"}, {"bob", "write", "team:devs"}}; !reflect.DeepEqual(api.Permissions, want) {
+		t.Errorf("acme/api permissions = %+v, want %+v", api.Permissions, want)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github-scanner/src/pb"
+)
+
+// scanStore keeps the results of the most recent scans so they can be
+// fetched again by ID (GetScan, GET /v1/scans/{id})
+type scanStore struct {
+	limit int
+
+	mu    sync.Mutex
+	order []string
+	scans map[string]storedScan
+}
+
+type storedScan struct {
+	resp   *pb.PolicyResponse
+	origin scanOrigin
+}
+
+// scanOrigin records what a stored scan was made from; it isn't returned
+// to callers
+type scanOrigin struct {
+	// organization the scan's caller was authorized for, which RPCs
+	// naming the scan rather than an org are authorized against
+	org string
+	// the repositories were fetched from GitHub by ScanRepositories rather
+	// than supplied by the caller
+	fetched bool
+}
+
+func newScanStore(limit int) *scanStore {
+	return &scanStore{limit: limit, scans: make(map[string]storedScan)}
+}
+
+// put stores a copy of the response under its scan ID, evicting the oldest
+// scan once the limit is reached
+func (s *scanStore) put(resp *pb.PolicyResponse, origin scanOrigin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := resp.GetScanId()
+	if _, ok := s.scans[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.scans[id] = storedScan{resp: proto.Clone(resp).(*pb.PolicyResponse), origin: origin}
+	for len(s.order) > s.limit {
+		delete(s.scans, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// get returns a copy of the stored response and its origin
+func (s *scanStore) get(id string) (*pb.PolicyResponse, scanOrigin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scan, ok := s.scans[id]
+	if !ok {
+		return nil, scanOrigin{}, false
+	}
+	return proto.Clone(scan.resp).(*pb.PolicyResponse), scan.origin, true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+
+	"github-scanner/src/export"
+)
+
+// policyModule is a Rego module of a policy, by path
+type policyModule struct {
+	path   string
+	source []byte
+}
+
+func (p Policy) entrypoint() string {
+	if p.Bundle != nil {
+		return p.Bundle.Entrypoint
+	}
+	return defaultEntrypoint
+}
+
+func (p Policy) modules() []policyModule {
+	if p.Bundle == nil {
+		modules := []policyModule{{path: "repository.rego", source: []byte(p.Source)}}
+		if p.Organization != "" {
+			modules = append(modules, policyModule{path: "organization.rego", source: []byte(p.Organization)})
+		}
+		return modules
+	}
+	modules := make([]policyModule, 0, len(p.Bundle.bundle.Modules))
+	for _, m := range p.Bundle.bundle.Modules {
+		modules = append(modules, policyModule{path: m.Path, source: m.Raw})
+	}
+	return modules
+}
+
+// annotatedSeverity reads "custom.severity" from the METADATA annotations of
+// the entrypoint package, where annotations of its allow and deny rules win
+// over the package's. Policies without one get the default severity.
+func (p Policy) annotatedSeverity() (string, error) {
+	return p.severityOf(p.entrypoint())
+}
+
+// severityOf is the annotated severity of the rules of a package
+func (p Policy) severityOf(entrypoint string) (string, error) {
+	var packageSeverity, ruleSeverity string
+	for _, m := range p.modules() {
+		module, err := ast.ParseModuleWithOpts(m.path, string(m.source), ast.ParserOptions{ProcessAnnotation: true, RegoVersion: ast.RegoV1})
+		if err != nil || module.Package.Path.String() != entrypoint {
+			continue
+		}
+		for _, a := range module.Annotations {
+			value, ok := a.Custom["severity"]
+			if !ok {
+				continue
+			}
+			s, _ := value.(string)
+			severity, known := export.ParseSeverity(s)
+			if !known {
+				return "", fmt.Errorf("%s:%d: unknown severity %v, use one of %v", m.path, a.Location.Row, value, export.Severities)
+			}
+			switch target := a.GetTargetPath().String(); {
+			case a.Scope == "package" || a.Scope == "subpackages":
+				packageSeverity = severity
+			case target == "allow" || target == "deny":
+				ruleSeverity = severity
+			}
+		}
+	}
+	for _, severity := range []string{ruleSeverity, packageSeverity} {
+		if severity != "" {
+			return severity, nil
+		}
+	}
+	return export.DefaultSeverity, nil
+}
+
+// decisionSeverity is the severity a policy's rule output declares for a
+// repository, if any, else the annotated one
+func decisionSeverity(output map[string]interface{}, annotated string) string {
+	value, ok := output["severity"]
+	if !ok {
+		return annotated
+	}
+	s, _ := value.(string)
+	severity, known := export.ParseSeverity(s)
+	if !known {
+		slog.Warn("Ignoring unknown severity in the policy output", "severity", value)
+		return annotated
+	}
+	return severity
+}
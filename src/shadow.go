@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+// evaluateShadow evaluates a shadow version against the repositories the
+// active version decided on. Repositories that could not be fetched keep
+// their result.
+func (s *Server) evaluateShadow(ctx context.Context, shadow resolvedPolicy, active []*pb.RepositoryInfo) *pb.ShadowEvaluation {
+	eval := &pb.ShadowEvaluation{PolicyVersion: shadow.version, PolicySha256: shadow.sha256}
+
+	var repos []*pb.RepositoryInfo
+	for _, repo := range active {
+		if !export.IsFetchError(repo) {
+			repos = append(repos, repo)
+		}
+	}
+	evaluated, err := s.scanner.EvaluateRepositoriesForGRPC(ctx, shadow.Policy, repos)
+	if err != nil {
+		slog.WarnContext(ctx, "Shadow evaluation failed", "policy_version", shadow.version, "error", err)
+		eval.Error = err.Error()
+		return eval
+	}
+	// waivers cover the decisions of the shadow version as well
+	if s.waivers != nil && shadow.waiverKey != "" {
+		s.waivers.apply(ctx, shadow.waiverKey, shadow.Policy, evaluated)
+	}
+	results := make(map[string]string, len(evaluated))
+	for _, repo := range evaluated {
+		results[repo.GetFullName()] = repo.GetScanResult()
+	}
+
+	changed := 0
+	for _, repo := range active {
+		result, ok := results[repo.GetFullName()]
+		if !ok {
+			result = repo.GetScanResult()
+		}
+		decision := &pb.ShadowDecision{
+			Repository:   repo.GetFullName(),
+			ScanResult:   result,
+			ActiveResult: repo.GetScanResult(),
+			Changed:      outcomeOf(result) != export.Outcome(repo),
+		}
+		if decision.Changed {
+			changed++
+		}
+		eval.Decisions = append(eval.Decisions, decision)
+	}
+	slog.InfoContext(ctx, "Shadow version evaluated", "policy_version", shadow.version, "repositories", len(eval.Decisions), "changed", changed)
+	return eval
+}
+
+// GetShadowReport lists the repositories of a scan whose decision would
+// change if its shadow version were promoted
+func (s *Server) GetShadowReport(ctx context.Context, req *pb.GetShadowReportRequest) (*pb.ShadowReport, error) {
+	scan, _, err := s.storedScan(ctx, req.GetScanId())
+	if err != nil {
+		return nil, err
+	}
+	shadow := scan.GetShadow()
+	if shadow == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "scan %q evaluated no shadow version", req.GetScanId())
+	}
+
+	report := &pb.ShadowReport{
+		ScanId:        scan.GetScanId(),
+		PolicyName:    scan.GetPolicyName(),
+		ActiveVersion: scan.GetPolicyVersion(),
+		ShadowVersion: shadow.GetPolicyVersion(),
+		Error:         shadow.GetError(),
+	}
+	for _, d := range shadow.GetDecisions() {
+		if !export.IsFetchError(&pb.RepositoryInfo{ScanResult: d.GetActiveResult()}) {
+			report.Evaluated++
+		}
+		if !d.GetChanged() {
+			continue
+		}
+		switch was, would := outcomeOf(d.GetActiveResult()), outcomeOf(d.GetScanResult()); {
+		case was == export.OutcomePass && would == export.OutcomeFail:
+			report.NewFailures++
+		case was == export.OutcomeFail && would == export.OutcomePass:
+			report.NewPasses++
+		}
+		report.Changes = append(report.Changes, d)
+	}
+	return report, nil
+}
+
+// outcomeOf classifies a scan_result
+func outcomeOf(scanResult string) string {
+	return export.Outcome(&pb.RepositoryInfo{ScanResult: scanResult})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// ServerTLSConfig points at the PEM files used to serve gRPC over TLS
+type ServerTLSConfig struct {
+	CertFile     string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" toml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"` // when set, clients must present a certificate signed by this CA
+}
+
+func (c ServerTLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// certReloader serves the certificate and client CA from disk and reloads
+// them when the files change, so rotated certificates are picked up without
+// a restart
+type certReloader struct {
+	config ServerTLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func newCertReloader(config ServerTLSConfig) (*certReloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("both a TLS certificate and key file are required")
+	}
+	r := &certReloader{config: config}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the server configuration; every handshake asks the
+// reloader for the current certificate and CA pool
+func (r *certReloader) TLSConfig() *tls.Config {
+	return r.tlsConfig(true)
+}
+
+// PublicTLSConfig serves the current certificate without asking for client
+// certificates, for callers like GitHub that can't present one
+func (r *certReloader) PublicTLSConfig() *tls.Config {
+	return r.tlsConfig(false)
+}
+
+func (r *certReloader) tlsConfig(clientCertificates bool) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if clientCertificates && r.clientCAs != nil {
+				cfg.ClientCAs = r.clientCAs
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// reloads the files when any modification time differs from the last load.
+// A failed reload keeps serving the previous certificate.
+func (r *certReloader) maybeReload() {
+	r.mu.RLock()
+	changed := false
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err == nil && !info.ModTime().Equal(r.modTimes[f]) {
+			changed = true
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	if !changed {
+		return
+	}
+	if err := r.reload(); err != nil {
+		slog.Error("Failed to reload TLS certificates, keeping the previous ones", "error", err)
+		return
+	}
+	slog.Info("Reloaded TLS certificates")
+}
+
+func (r *certReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
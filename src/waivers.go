@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github-scanner/src/export"
+	pb "github-scanner/src/pb"
+)
+
+var (
+	errWaiverNotFound = errors.New("waiver not found")
+	errInvalidWaiver  = errors.New("invalid waiver")
+)
+
+// waiver exempts a repository, or one user's access to it, from a policy
+// until it expires
+type waiver struct {
+	ID            string    `json:"id"`
+	Policy        string    `json:"policy"`
+	Repository    string    `json:"repository"`
+	User          string    `json:"user,omitempty"`
+	Justification string    `json:"justification"`
+	Approver      string    `json:"approver"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedBy     string    `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// owner of the waived repository, the org callers must be authorized for
+func (w *waiver) owner() string {
+	owner, _, _ := strings.Cut(w.Repository, "/")
+	return owner
+}
+
+func (w *waiver) expired(now time.Time) bool {
+	return !now.Before(w.ExpiresAt)
+}
+
+// covers reports whether the waiver is about the policy's decision on the
+// repository; GitHub names are case-insensitive
+func (w *waiver) covers(policy string, repo *pb.RepositoryInfo) bool {
+	return w.Policy == policy && strings.EqualFold(w.Repository, repo.GetFullName())
+}
+
+// waiverStore keeps the waivers in a JSON file, rewritten atomically on
+// every change. Expired waivers stay until they are deleted, so reports can
+// surface them.
+type waiverStore struct {
+	path string
+
+	mu      sync.Mutex
+	waivers []*waiver
+}
+
+// openWaiverStore loads the waivers of path; a missing file is an empty store
+func openWaiverStore(path string) (*waiverStore, error) {
+	s := &waiverStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.waivers); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	slog.Info("Loaded waivers", "path", path, "waivers", len(s.waivers))
+	return s, nil
+}
+
+// parseExpiry accepts RFC 3339 timestamps, and dates for a waiver valid
+// through that day (UTC)
+func parseExpiry(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w expires_at %q: use RFC 3339 or YYYY-MM-DD", errInvalidWaiver, value)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// create validates and stores a new waiver
+func (s *waiverStore) create(w *waiver) error {
+	switch {
+	case w.Policy == "":
+		return fmt.Errorf("%w: policy is required", errInvalidWaiver)
+	case strings.Count(w.Repository, "/") != 1:
+		return fmt.Errorf("%w repository %q: use the full name, owner/name", errInvalidWaiver, w.Repository)
+	case strings.TrimSpace(w.Justification) == "":
+		return fmt.Errorf("%w: justification is required", errInvalidWaiver)
+	case w.Approver == "":
+		return fmt.Errorf("%w: approver is required", errInvalidWaiver)
+	case w.expired(w.CreatedAt):
+		return fmt.Errorf("%w: expires_at %s is in the past", errInvalidWaiver, w.ExpiresAt.Format(time.RFC3339))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waivers := append(append([]*waiver(nil), s.waivers...), w)
+	if err := s.write(waivers); err != nil {
+		return err
+	}
+	s.waivers = waivers
+	return nil
+}
+
+// list returns the waivers of a policy, or of every policy, sorted by expiry
+func (s *waiverStore) list(policy string, includeExpired bool, now time.Time) []waiver {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var waivers []waiver
+	for _, w := range s.waivers {
+		if (policy == "" || w.Policy == policy) && (includeExpired || !w.expired(now)) {
+			waivers = append(waivers, *w)
+		}
+	}
+	sort.SliceStable(waivers, func(i, j int) bool { return waivers[i].ExpiresAt.Before(waivers[j].ExpiresAt) })
+	return waivers
+}
+
+func (s *waiverStore) get(id string) (waiver, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.waivers {
+		if w.ID == id {
+			return *w, true
+		}
+	}
+	return waiver{}, false
+}
+
+func (s *waiverStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.waivers {
+		if w.ID != id {
+			continue
+		}
+		waivers := append(append([]*waiver(nil), s.waivers[:i]...), s.waivers[i+1:]...)
+		if err := s.write(waivers); err != nil {
+			return err
+		}
+		s.waivers = waivers
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errWaiverNotFound, id)
+}
+
+func (s *waiverStore) write(waivers []*waiver) error {
+	data, err := json.MarshalIndent(waivers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// apply reports the failures of repos that active waivers of the policy
+// cover as waived. A repository-wide waiver covers any failure; waivers
+// naming users cover it when the repository complies without their
+// access. It returns the waivers applied, and the expired ones that would
+// have covered a repository.
+func (s *waiverStore) apply(ctx context.Context, policyName string, policy Policy, repos []*pb.RepositoryInfo) (applied, expired []waiver) {
+	now := time.Now()
+	all := s.list(policyName, true, now)
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	var query *rego.PreparedEvalQuery
+	used := make(map[string]bool)
+	use := func(w waiver, list *[]waiver) {
+		if !used[w.ID] {
+			used[w.ID] = true
+			*list = append(*list, w)
+		}
+	}
+	for _, repo := range repos {
+		var repoWide, byUser []waiver
+		for _, w := range all {
+			if !w.covers(policyName, repo) {
+				continue
+			}
+			switch {
+			case w.expired(now):
+				use(w, &expired)
+			case w.User == "":
+				repoWide = append(repoWide, w)
+			default:
+				byUser = append(byUser, w)
+			}
+		}
+		if export.Outcome(repo) != export.OutcomeFail {
+			continue
+		}
+
+		var covering []waiver
+		switch {
+		case len(repoWide) > 0:
+			covering = repoWide[:1]
+		case len(byUser) > 0:
+			if query == nil {
+				prepared, err := preparePolicy(ctx, policy)
+				if err != nil {
+					slog.WarnContext(ctx, "Waivers not applied, the policy did not compile", "error", err)
+					return applied, expired
+				}
+				query = &prepared
+			}
+			if compliesWithout(ctx, *query, repo, byUser) {
+				covering = byUser
+			}
+		}
+		if len(covering) == 0 {
+			continue
+		}
+		repo.ScanResult = export.ResultWaived
+		repo.RiskScore = 0
+		for _, w := range covering {
+			repo.WaiverIds = append(repo.WaiverIds, w.ID)
+			use(w, &applied)
+		}
+	}
+	return applied, expired
+}
+
+// compliesWithout evaluates the policy again with the waived users' access
+// removed from the repository
+func compliesWithout(ctx context.Context, query rego.PreparedEvalQuery, repo *pb.RepositoryInfo, waivers []waiver) bool {
+	input := repositoriesFromProto([]*pb.RepositoryInfo{repo})[0]
+	var permissions []RepositoryPermissions
+	for _, perm := range input.Permissions {
+		waived := false
+		for _, w := range waivers {
+			waived = waived || strings.EqualFold(w.User, perm.Username)
+		}
+		if !waived {
+			permissions = append(permissions, perm)
+		}
+	}
+	input.Permissions = permissions
+
+	decision, err := evaluatePolicy(ctx, query, input, export.DefaultSeverity)
+	if err != nil {
+		slog.WarnContext(ctx, "Policy evaluation error", "repo", repo.GetFullName(), "error", err)
+		return false
+	}
+	return decision.Allowed
+}
+
+func waiverToProto(w waiver, now time.Time) *pb.Waiver {
+	return &pb.Waiver{
+		WaiverId:      w.ID,
+		Policy:        w.Policy,
+		Repository:    w.Repository,
+		User:          w.User,
+		Justification: w.Justification,
+		Approver:      w.Approver,
+		ExpiresAt:     w.ExpiresAt.Format(time.RFC3339),
+		CreatedBy:     w.CreatedBy,
+		CreatedAt:     w.CreatedAt.Format(time.RFC3339),
+		Expired:       w.expired(now),
+	}
+}
+
+func waiversToProto(waivers []waiver) []*pb.Waiver {
+	now := time.Now()
+	var list []*pb.Waiver
+	for _, w := range waivers {
+		list = append(list, waiverToProto(w, now))
+	}
+	return list
+}
+
+var errWaiversDisabled = status.Error(codes.FailedPrecondition, "waivers are not configured (policies.waivers)")
+
+func waiverError(err error) error {
+	switch {
+	case errors.Is(err, errWaiverNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errInvalidWaiver):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "waivers: %v", err)
+	}
+}
+
+// CreateWaiver stores a waiver; the caller is recorded as its creator
+func (s *Server) CreateWaiver(ctx context.Context, req *pb.CreateWaiverRequest) (*pb.Waiver, error) {
+	if s.waivers == nil {
+		return nil, errWaiversDisabled
+	}
+	expiresAt, err := parseExpiry(req.GetExpiresAt())
+	if err != nil {
+		return nil, waiverError(err)
+	}
+	w := &waiver{
+		ID:            newID(),
+		Policy:        req.GetPolicy(),
+		Repository:    req.GetRepository(),
+		User:          req.GetUser(),
+		Justification: req.GetJustification(),
+		Approver:      req.GetApprover(),
+		ExpiresAt:     expiresAt,
+		CreatedBy:     policyAuthor(ctx, ""),
+		CreatedAt:     time.Now().UTC(),
+	}
+	// The request names no org; the caller must be allowed on the repository's
+	if err := s.auth.authorizeOrg(ctx, w.owner()); err != nil {
+		return nil, err
+	}
+	if !s.waivablePolicy(w.Policy) {
+		return nil, status.Errorf(codes.InvalidArgument, "policy %q is neither a registered policy nor a bundle; inline policies can't be waived", w.Policy)
+	}
+	if err := s.waivers.create(w); err != nil {
+		return nil, waiverError(err)
+	}
+	slog.InfoContext(ctx, "Waiver created", "waiver_id", w.ID, "policy", w.Policy, "repository", w.Repository, "user", w.User,
+		"approver", w.Approver, "expires_at", w.ExpiresAt)
+	return waiverToProto(*w, w.CreatedAt), nil
+}
+
+// waivablePolicy reports whether waivers may name the policy: registered
+// policies and bundles are, inline policies named by callers are not
+func (s *Server) waivablePolicy(name string) bool {
+	if _, ok := s.bundles.get(name); ok {
+		return true
+	}
+	if s.registry == nil {
+		return false
+	}
+	_, err := s.registry.get(name)
+	return err == nil
+}
+
+func (s *Server) ListWaivers(ctx context.Context, req *pb.ListWaiversRequest) (*pb.ListWaiversResponse, error) {
+	if s.waivers == nil {
+		return nil, errWaiversDisabled
+	}
+	// Only the waivers of repositories in orgs the caller is allowed on
+	var waivers []waiver
+	allowed := make(map[string]bool)
+	for _, w := range s.waivers.list(req.GetPolicy(), req.GetIncludeExpired(), time.Now()) {
+		owner := strings.ToLower(w.owner())
+		ok, seen := allowed[owner]
+		if !seen {
+			ok = s.auth.authorizeOrg(ctx, w.owner()) == nil
+			allowed[owner] = ok
+		}
+		if ok {
+			waivers = append(waivers, w)
+		}
+	}
+	return &pb.ListWaiversResponse{Waivers: waiversToProto(waivers)}, nil
+}
+
+func (s *Server) DeleteWaiver(ctx context.Context, req *pb.DeleteWaiverRequest) (*pb.DeleteWaiverResponse, error) {
+	if s.waivers == nil {
+		return nil, errWaiversDisabled
+	}
+	w, ok := s.waivers.get(req.GetWaiverId())
+	if !ok {
+		return nil, waiverError(fmt.Errorf("%w: %s", errWaiverNotFound, req.GetWaiverId()))
+	}
+	if err := s.auth.authorizeOrg(ctx, w.owner()); err != nil {
+		return nil, err
+	}
+	if err := s.waivers.delete(req.GetWaiverId()); err != nil {
+		return nil, waiverError(err)
+	}
+	slog.InfoContext(ctx, "Waiver deleted", "waiver_id", req.GetWaiverId())
+	return &pb.DeleteWaiverResponse{}, nil
+}
+
+// applyWaivers applies the waivers of the scan's policy to its repositories;
+// inline policies are never waived
+func (s *Server) applyWaivers(ctx context.Context, policy resolvedPolicy, resp *pb.PolicyResponse) {
+	if s.waivers == nil || policy.waiverKey == "" {
+		return
+	}
+	applied, expired := s.waivers.apply(ctx, policy.waiverKey, policy.Policy, resp.GetRepositories())
+	resp.Waivers = waiversToProto(applied)
+	resp.ExpiredWaivers = waiversToProto(expired)
+	for _, w := range expired {
+		slog.WarnContext(ctx, "Waiver expired", "waiver_id", w.ID, "policy", w.Policy, "repository", w.Repository, "expired_at", w.ExpiresAt)
+	}
+	if len(applied) > 0 {
+		slog.InfoContext(ctx, "Waivers applied", "waivers", len(applied))
+	}
+}